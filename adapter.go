@@ -0,0 +1,141 @@
+package shardmap
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by the Get methods of Store when the key has no
+// value, like the cache stores of other libraries.
+var ErrNotFound = errors.New("shardmap: value not found")
+
+// Store adapts a map to a store API taking a context and reporting failures
+// as errors instead of panicking, with typed keys and values and a ttl
+// argument. It implements no interface of another library as is, and is
+// meant to back the shims of frameworks expecting such a store.
+type Store[K comparable, V any] struct {
+	m *Map[K, V]
+}
+
+// NewStore returns a Store backed by m.
+func NewStore[K comparable, V any](m *Map[K, V]) *Store[K, V] {
+	return &Store[K, V]{m: m}
+}
+
+// Map returns the underlying Map.
+func (s *Store[K, V]) Map() *Map[K, V] {
+	return s.m
+}
+
+// Get returns the value of a key, or ErrNotFound.
+func (s *Store[K, V]) Get(ctx context.Context, key K) (V, error) {
+	if value, ok := s.m.Get(key); ok {
+		return value, nil
+	}
+	var zero V
+	return zero, ErrNotFound
+}
+
+// GetWithTTL returns the value of a key and the time left before it expires,
+// 0 when it never expires, or ErrNotFound.
+func (s *Store[K, V]) GetWithTTL(ctx context.Context, key K) (V, time.Duration, error) {
+	if value, ttl, ok := s.m.getWithTTL(key); ok {
+		return value, ttl, nil
+	}
+	var zero V
+	return zero, 0, ErrNotFound
+}
+
+// Set assigns a value to a key which expires after ttl, a ttl <= 0 means the
+// value never expires.
+// Returns ErrClosed or ErrReadOnly when the map can't be written.
+func (s *Store[K, V]) Set(ctx context.Context, key K, value V, ttl time.Duration) error {
+	return s.m.writeErr(func() bool {
+		_, _, ok := s.m.setWithTTL(key, value, ttl)
+		return ok
+	})
+}
+
+// Delete deletes the value of a key, which may be absent.
+// Returns ErrClosed or ErrReadOnly when the map can't be written.
+func (s *Store[K, V]) Delete(ctx context.Context, key K) error {
+	return s.m.writeErr(func() bool {
+		_, _, ok := s.m.deleteHashed(s.m.hash(key), key)
+		return ok
+	})
+}
+
+// Clear deletes all the values.
+// Returns ErrClosed or ErrReadOnly when the map can't be written.
+func (s *Store[K, V]) Clear(ctx context.Context) error {
+	return s.m.writeErr(s.m.clearAll)
+}
+
+// GetType returns the name of the store, "shardmap".
+func (s *Store[K, V]) GetType() string {
+	return "shardmap"
+}
+
+// TTLCache adapts a map to the Get, Set with a ttl and Delete interface of
+// in-memory caches, which a TTLCache[string, any] implements like the Cache
+// of go-cache.
+type TTLCache[K comparable, V any] struct {
+	m   *Map[K, V]
+	ttl time.Duration
+}
+
+// NewTTLCache returns a TTLCache backed by m, assigning values which expire
+// after ttl by default, a ttl <= 0 means they never expire.
+func NewTTLCache[K comparable, V any](m *Map[K, V], ttl time.Duration) *TTLCache[K, V] {
+	return &TTLCache[K, V]{m: m, ttl: ttl}
+}
+
+// Map returns the underlying Map.
+func (c *TTLCache[K, V]) Map() *Map[K, V] {
+	return c.m
+}
+
+// Get returns the value of a key.
+// Returns false when the key has no value.
+func (c *TTLCache[K, V]) Get(key K) (V, bool) {
+	return c.m.Get(key)
+}
+
+// Set assigns a value to a key which expires after ttl, the default ttl when
+// ttl is 0, or never when ttl < 0.
+func (c *TTLCache[K, V]) Set(key K, value V, ttl time.Duration) {
+	if ttl == 0 {
+		ttl = c.ttl
+	}
+	c.m.SetWithTTL(key, value, ttl)
+}
+
+// SetDefault assigns a value to a key which expires after the default ttl.
+func (c *TTLCache[K, V]) SetDefault(key K, value V) {
+	c.m.SetWithTTL(key, value, c.ttl)
+}
+
+// Delete deletes the value of a key.
+func (c *TTLCache[K, V]) Delete(key K) {
+	c.m.Delete(key)
+}
+
+// writeErr runs the write fn, which returns false when the map is read-only,
+// and returns the error of a map that can't be written instead of its panic.
+// The state is checked by fn under the shard lock, so that a map switched to
+// read-only or closed meanwhile is reported too.
+func (m *Map[K, V]) writeErr(fn func() bool) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if r != ErrClosed && r != ErrReadOnly {
+				panic(r)
+			}
+			err = r.(error)
+		}
+	}()
+	if !fn() {
+		return ErrReadOnly
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package shardmap
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// the methods of the Cache of go-cache used to get, set and delete values
+var _ interface {
+	Get(k string) (interface{}, bool)
+	Set(k string, x interface{}, d time.Duration)
+	SetDefault(k string, x interface{})
+	Delete(k string)
+} = &TTLCache[string, any]{}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	s := NewStore(New[string, int](0))
+	if _, err := s.Get(ctx, "a"); err != ErrNotFound {
+		t.Fatalf("expected '%v', got '%v'", ErrNotFound, err)
+	}
+	if err := s.Set(ctx, "a", 1, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set(ctx, "b", 2, 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, ttl, err := s.GetWithTTL(ctx, "a"); err != nil || v != 1 || ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("expected '%v', got '%v' '%v' '%v'", 1, v, ttl, err)
+	}
+	if v, ttl, err := s.GetWithTTL(ctx, "b"); err != nil || v != 2 || ttl != 0 {
+		t.Fatalf("expected '%v', got '%v' '%v' '%v'", 2, v, ttl, err)
+	}
+	if err := s.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.GetWithTTL(ctx, "a"); err != ErrNotFound {
+		t.Fatalf("expected '%v', got '%v'", ErrNotFound, err)
+	}
+	if err := s.Clear(ctx); err != nil || s.Map().Len() != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, s.Map().Len())
+	}
+	s.Map().SetReadOnly(true)
+	if err := s.Set(ctx, "a", 1, 0); err != ErrReadOnly {
+		t.Fatalf("expected '%v', got '%v'", ErrReadOnly, err)
+	}
+	s.Map().SetReadOnly(false)
+	s.Map().Close()
+	if err := s.Delete(ctx, "a"); err != ErrClosed {
+		t.Fatalf("expected '%v', got '%v'", ErrClosed, err)
+	}
+}
+
+func TestTTLCache(t *testing.T) {
+	c := NewTTLCache(New[string, int](0), time.Nanosecond)
+	c.SetDefault("a", 1)
+	c.Set("b", 2, -1)
+	c.Set("c", 3, time.Hour)
+	time.Sleep(time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Fatalf("expected '%v', got '%v'", false, ok)
+	}
+	if v, ok := c.Get("b"); !ok || v != 2 {
+		t.Fatalf("expected '%v', got '%v'", 2, v)
+	}
+	if ttl, _ := c.Map().TTL("b"); ttl != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, ttl)
+	}
+	c.Delete("c")
+	if _, ok := c.Get("c"); ok {
+		t.Fatalf("expected '%v', got '%v'", false, ok)
+	}
+}
+
+func TestStoreClosing(t *testing.T) {
+	// writes racing with Close fail with ErrClosed instead of panicking
+	ctx := context.Background()
+	s := NewStore(New[int, int](0))
+	errs := make(chan error, 1)
+	go func() {
+		for i := 0; ; i++ {
+			if err := s.Set(ctx, i, i, 0); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	time.Sleep(time.Millisecond)
+	s.Map().Close()
+	if err := <-errs; err != ErrClosed {
+		t.Fatalf("expected '%v', got '%v'", ErrClosed, err)
+	}
+	if err := s.Clear(ctx); err != ErrClosed {
+		t.Fatalf("expected '%v', got '%v'", ErrClosed, err)
+	}
+}
@@ -173,6 +173,26 @@ func main() {
 
 	println()
 
+	println("-- github.com/phuslu/shardmap SwissMap --")
+	swm := shardmap.NewSwiss[string, int](0)
+	print("set: ")
+	lotsa.Ops(N, runtime.NumCPU(), func(i, _ int) {
+		swm.Set(keys[i], i)
+	})
+	print("get: ")
+	lotsa.Ops(N, runtime.NumCPU(), func(i, _ int) {
+		v, _ := swm.Get(keys[i])
+		if v != i {
+			panic("bad news")
+		}
+	})
+	print("del: ")
+	lotsa.Ops(N, runtime.NumCPU(), func(i, _ int) {
+		swm.Delete(keys[i])
+	})
+
+	println()
+
 }
 EOF
 
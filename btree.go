@@ -0,0 +1,322 @@
+package shardmap
+
+import "fmt"
+
+// Ordered is the constraint of the keys of an OrderedMap.
+type Ordered interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64 | ~string
+}
+
+const (
+	btreeMaxItems = 63 // must be odd
+	btreeMinItems = btreeMaxItems / 2
+)
+
+// btree is a B-tree of entries ordered by key.
+type btree[K Ordered, V any] struct {
+	root   *bnode[K, V]
+	length int
+}
+
+type bnode[K Ordered, V any] struct {
+	items    []Entry[K, V]
+	children []*bnode[K, V] // nil for leaves
+}
+
+// find returns the index of the first item not less than key, and whether
+// it equals key.
+func (n *bnode[K, V]) find(key K) (int, bool) {
+	i, j := 0, len(n.items)
+	for i < j {
+		h := int(uint(i+j) >> 1)
+		if n.items[h].Key < key {
+			i = h + 1
+		} else {
+			j = h
+		}
+	}
+	return i, i < len(n.items) && n.items[i].Key == key
+}
+
+// Get returns a value for a key.
+func (t *btree[K, V]) Get(key K) (value V, ok bool) {
+	for n := t.root; n != nil; {
+		i, found := n.find(key)
+		if found {
+			return n.items[i].Value, true
+		}
+		if n.children == nil {
+			break
+		}
+		n = n.children[i]
+	}
+	return value, false
+}
+
+// Set assigns a value to a key.
+// Returns the previous value, or false when no value was assigned.
+func (t *btree[K, V]) Set(key K, value V) (prev V, replaced bool) {
+	if t.root == nil {
+		t.root = &bnode[K, V]{}
+	}
+	if len(t.root.items) == btreeMaxItems {
+		t.root = &bnode[K, V]{children: []*bnode[K, V]{t.root}}
+		t.root.split(0)
+	}
+	n := t.root
+	for {
+		i, found := n.find(key)
+		if found {
+			prev, n.items[i].Value = n.items[i].Value, value
+			return prev, true
+		}
+		if n.children == nil {
+			n.items = append(n.items, Entry[K, V]{})
+			copy(n.items[i+1:], n.items[i:])
+			n.items[i] = Entry[K, V]{key, value}
+			t.length++
+			return prev, false
+		}
+		if len(n.children[i].items) == btreeMaxItems {
+			n.split(i)
+			if n.items[i].Key == key {
+				prev, n.items[i].Value = n.items[i].Value, value
+				return prev, true
+			}
+			if n.items[i].Key < key {
+				i++
+			}
+		}
+		n = n.children[i]
+	}
+}
+
+// split splits the full child i in two around its middle item, which moves up
+// to n.
+func (n *bnode[K, V]) split(i int) {
+	c := n.children[i]
+	const mid = btreeMaxItems / 2
+	item := c.items[mid]
+	right := &bnode[K, V]{items: append([]Entry[K, V](nil), c.items[mid+1:]...)}
+	c.items = truncItems(c.items, mid)
+	if c.children != nil {
+		right.children = append([]*bnode[K, V](nil), c.children[mid+1:]...)
+		c.children = truncChildren(c.children, mid+1)
+	}
+	n.items = append(n.items, Entry[K, V]{})
+	copy(n.items[i+1:], n.items[i:])
+	n.items[i] = item
+	n.children = append(n.children, nil)
+	copy(n.children[i+2:], n.children[i+1:])
+	n.children[i+1] = right
+}
+
+// Delete deletes a value for a key.
+// Returns the deleted value, or false when no value was assigned.
+func (t *btree[K, V]) Delete(key K) (prev V, deleted bool) {
+	if t.root == nil {
+		return
+	}
+	prev, deleted = t.root.delete(key)
+	if len(t.root.items) == 0 && t.root.children != nil {
+		t.root = t.root.children[0]
+	}
+	if deleted {
+		t.length--
+	}
+	return prev, deleted
+}
+
+// delete deletes key from the subtree of n, which holds more than the
+// minimum number of items unless it's the root.
+func (n *bnode[K, V]) delete(key K) (prev V, deleted bool) {
+	i, found := n.find(key)
+	if n.children == nil {
+		if !found {
+			return
+		}
+		prev = n.items[i].Value
+		copy(n.items[i:], n.items[i+1:])
+		n.items = truncItems(n.items, len(n.items)-1)
+		return prev, true
+	}
+	if found {
+		prev = n.items[i].Value
+		switch {
+		case len(n.children[i].items) > btreeMinItems:
+			// replace the item with its predecessor
+			c := n.children[i]
+			for c.children != nil {
+				c = c.children[len(c.children)-1]
+			}
+			n.items[i] = c.items[len(c.items)-1]
+			n.children[i].delete(n.items[i].Key)
+		case len(n.children[i+1].items) > btreeMinItems:
+			// replace the item with its successor
+			c := n.children[i+1]
+			for c.children != nil {
+				c = c.children[0]
+			}
+			n.items[i] = c.items[0]
+			n.children[i+1].delete(n.items[i].Key)
+		default:
+			n.merge(i)
+			n.children[i].delete(key)
+		}
+		return prev, true
+	}
+	// make sure the child holds more than the minimum before descending
+	if len(n.children[i].items) <= btreeMinItems {
+		switch {
+		case i > 0 && len(n.children[i-1].items) > btreeMinItems:
+			n.rotateRight(i - 1)
+		case i < len(n.children)-1 && len(n.children[i+1].items) > btreeMinItems:
+			n.rotateLeft(i)
+		default:
+			if i == len(n.children)-1 {
+				i--
+			}
+			n.merge(i)
+		}
+	}
+	return n.children[i].delete(key)
+}
+
+// merge merges the child i+1 and the item i into the child i.
+func (n *bnode[K, V]) merge(i int) {
+	left, right := n.children[i], n.children[i+1]
+	left.items = append(left.items, n.items[i])
+	left.items = append(left.items, right.items...)
+	left.children = append(left.children, right.children...)
+	copy(n.items[i:], n.items[i+1:])
+	n.items = truncItems(n.items, len(n.items)-1)
+	copy(n.children[i+1:], n.children[i+2:])
+	n.children = truncChildren(n.children, len(n.children)-1)
+}
+
+// rotateRight moves the last item of the child i up to n, and the item i of
+// n down to the child i+1.
+func (n *bnode[K, V]) rotateRight(i int) {
+	left, right := n.children[i], n.children[i+1]
+	right.items = append(right.items, Entry[K, V]{})
+	copy(right.items[1:], right.items)
+	right.items[0] = n.items[i]
+	n.items[i] = left.items[len(left.items)-1]
+	left.items = truncItems(left.items, len(left.items)-1)
+	if left.children != nil {
+		right.children = append(right.children, nil)
+		copy(right.children[1:], right.children)
+		right.children[0] = left.children[len(left.children)-1]
+		left.children = truncChildren(left.children, len(left.children)-1)
+	}
+}
+
+// rotateLeft moves the first item of the child i+1 up to n, and the item i
+// of n down to the child i.
+func (n *bnode[K, V]) rotateLeft(i int) {
+	left, right := n.children[i], n.children[i+1]
+	left.items = append(left.items, n.items[i])
+	n.items[i] = right.items[0]
+	copy(right.items, right.items[1:])
+	right.items = truncItems(right.items, len(right.items)-1)
+	if right.children != nil {
+		left.children = append(left.children, right.children[0])
+		copy(right.children, right.children[1:])
+		right.children = truncChildren(right.children, len(right.children)-1)
+	}
+}
+
+// Ascend iterates over the entries with keys in [lo, hi) in ascending order,
+// hasLo and hasHi tell whether the bounds are set.
+func (t *btree[K, V]) Ascend(lo, hi K, hasLo, hasHi bool, iter func(key K, value V) bool) {
+	if t.root != nil {
+		t.root.ascend(lo, hi, hasLo, hasHi, iter)
+	}
+}
+
+func (n *bnode[K, V]) ascend(lo, hi K, hasLo, hasHi bool, iter func(key K, value V) bool) bool {
+	i := 0
+	if hasLo {
+		i, _ = n.find(lo)
+	}
+	for ; i < len(n.items); i++ {
+		if n.children != nil && !n.children[i].ascend(lo, hi, hasLo, hasHi, iter) {
+			return false
+		}
+		if hasHi && !(n.items[i].Key < hi) {
+			return false
+		}
+		if !iter(n.items[i].Key, n.items[i].Value) {
+			return false
+		}
+	}
+	if n.children != nil {
+		return n.children[len(n.items)].ascend(lo, hi, hasLo, hasHi, iter)
+	}
+	return true
+}
+
+// verify checks the B-tree invariants.
+func (t *btree[K, V]) verify() error {
+	if t.root == nil {
+		return nil
+	}
+	var n, depth int
+	var last *K
+	var walk func(b *bnode[K, V], d int, root bool) error
+	walk = func(b *bnode[K, V], d int, root bool) error {
+		if len(b.items) > btreeMaxItems || !root && len(b.items) < btreeMinItems {
+			return fmt.Errorf("node with %d items", len(b.items))
+		}
+		if b.children == nil {
+			if depth == 0 {
+				depth = d
+			} else if depth != d {
+				return fmt.Errorf("leaf at depth %d, want %d", d, depth)
+			}
+		} else if len(b.children) != len(b.items)+1 {
+			return fmt.Errorf("node with %d items and %d children", len(b.items), len(b.children))
+		}
+		for i := range b.items {
+			if b.children != nil {
+				if err := walk(b.children[i], d+1, false); err != nil {
+					return err
+				}
+			}
+			if last != nil && !(*last < b.items[i].Key) {
+				return fmt.Errorf("key %v after %v", b.items[i].Key, *last)
+			}
+			last = &b.items[i].Key
+			n++
+		}
+		if b.children != nil {
+			return walk(b.children[len(b.items)], d+1, false)
+		}
+		return nil
+	}
+	if err := walk(t.root, 1, true); err != nil {
+		return err
+	}
+	if n != t.length {
+		return fmt.Errorf("length %d, but %d items", t.length, n)
+	}
+	return nil
+}
+
+// truncItems truncates items to n, zeroing the items left out.
+func truncItems[K Ordered, V any](items []Entry[K, V], n int) []Entry[K, V] {
+	for i := n; i < len(items); i++ {
+		items[i] = Entry[K, V]{}
+	}
+	return items[:n]
+}
+
+// truncChildren truncates children to n, zeroing the children left out.
+func truncChildren[K Ordered, V any](children []*bnode[K, V], n int) []*bnode[K, V] {
+	for i := n; i < len(children); i++ {
+		children[i] = nil
+	}
+	return children[:n]
+}
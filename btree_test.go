@@ -0,0 +1,67 @@
+package shardmap
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestBTree(t *testing.T) {
+	var tr btree[int, int]
+	ref := make(map[int]int)
+	for i := 0; i < 100000; i++ {
+		key := rand.Intn(5000)
+		switch rand.Intn(3) {
+		case 0, 1:
+			prev, replaced := tr.Set(key, i)
+			want, ok := ref[key]
+			if replaced != ok || prev != want {
+				t.Fatalf("expected '%v', got '%v'", want, prev)
+			}
+			ref[key] = i
+		case 2:
+			prev, deleted := tr.Delete(key)
+			want, ok := ref[key]
+			if deleted != ok || prev != want {
+				t.Fatalf("expected '%v', got '%v'", want, prev)
+			}
+			delete(ref, key)
+		}
+		if i%1000 == 0 {
+			if err := tr.verify(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tr.verify(); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range ref {
+		if v, ok := tr.Get(key); !ok || v != want {
+			t.Fatalf("expected '%v', got '%v'", want, v)
+		}
+	}
+	last, n := -1, 0
+	tr.Ascend(1000, 2000, true, true, func(key, value int) bool {
+		if key <= last || key < 1000 || key >= 2000 {
+			t.Fatalf("unexpected key '%v' after '%v'", key, last)
+		}
+		last = key
+		n++
+		return true
+	})
+	var want int
+	for key := range ref {
+		if key >= 1000 && key < 2000 {
+			want++
+		}
+	}
+	if n != want {
+		t.Fatalf("expected '%v', got '%v'", want, n)
+	}
+	for key := range ref {
+		tr.Delete(key)
+	}
+	if err := tr.verify(); err != nil || tr.length != 0 {
+		t.Fatalf("expected empty tree, got '%v' %v", tr.length, err)
+	}
+}
@@ -0,0 +1,267 @@
+package shardmap
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// UpdateWhere replaces all values for which pred returns true by the result of
+// fn, shard by shard under the write lock.
+// The pred and fn functions are called under the shard lock and must not
+// access the map.
+// Returns the number of updated values.
+func (m *Map[K, V]) UpdateWhere(pred func(key K, value V) bool, fn func(key K, value V) V) (n int) {
+	m.lazyInit()
+	var buf []entry[K, V]
+	for i := 0; i < len(m.mus); i++ {
+		var updated int
+		if !m.writeShard(i, func(s *shard[K, V]) { updated, buf = s.UpdateWhere(pred, fn, buf) }) {
+			return
+		}
+		n += updated
+	}
+	return n
+}
+
+// CountFunc returns the number of key/values for which pred returns true.
+// The pred function is called under the shard read lock and must not mutate
+// the map.
+func (m *Map[K, V]) CountFunc(pred func(key K, value V) bool) (n int) {
+	m.lazyInit()
+	debug := atomic.LoadUint32(&m.debug)
+	for i := 0; i < len(m.mus); i++ {
+		m.rangeShard(i, debug, func(key K, value V) bool {
+			if pred(key, value) {
+				n++
+			}
+			return true
+		})
+	}
+	return n
+}
+
+// Find returns a key/value for which pred returns true, stopping at the first
+// one found. Returns false when there is none.
+// The pred function is called under the shard read lock and must not mutate
+// the map.
+func (m *Map[K, V]) Find(pred func(key K, value V) bool) (key K, value V, ok bool) {
+	m.lazyInit()
+	debug := atomic.LoadUint32(&m.debug)
+	for i := 0; i < len(m.mus) && !ok; i++ {
+		m.rangeShard(i, debug, func(k K, v V) bool {
+			if pred(k, v) {
+				key, value, ok = k, v, true
+				return false
+			}
+			return true
+		})
+	}
+	return key, value, ok
+}
+
+// Reduce folds all key/values of the map into an accumulator, starting from
+// init, shard by shard.
+// The fn function is called under the shard read lock and must not mutate the
+// map.
+func Reduce[A any, K comparable, V any](m *Map[K, V], init A, fn func(acc A, key K, value V) A) A {
+	acc := init
+	debug := atomic.LoadUint32(&m.debug)
+	for i := 0; i < len(m.mus); i++ {
+		m.rangeShard(i, debug, func(key K, value V) bool {
+			acc = fn(acc, key, value)
+			return true
+		})
+	}
+	return acc
+}
+
+// ReduceParallel folds the key/values of every shard like Reduce, with workers
+// goroutines reducing different shards at the same time, then combines the
+// accumulators of the shards in order. Every shard starts from init, which
+// must be an identity of combine, such as 0 for a sum. A workers <= 0 means
+// GOMAXPROCS.
+func ReduceParallel[A any, K comparable, V any](m *Map[K, V], workers int, init A, fn func(acc A, key K, value V) A, combine func(a, b A) A) A {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(m.mus) {
+		workers = len(m.mus)
+	}
+	accs := make([]A, len(m.mus))
+	debug := atomic.LoadUint32(&m.debug)
+	var next uint32
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(atomic.AddUint32(&next, 1) - 1)
+				if i >= len(m.mus) {
+					return
+				}
+				acc := init
+				m.rangeShard(i, debug, func(key K, value V) bool {
+					acc = fn(acc, key, value)
+					return true
+				})
+				accs[i] = acc
+			}
+		}()
+	}
+	wg.Wait()
+	acc := init
+	for _, a := range accs {
+		acc = combine(acc, a)
+	}
+	return acc
+}
+
+// TransformValues returns a new map holding the keys of src with their values
+// mapped by fn, built shard by shard in parallel. The new map has the shards,
+// lock stripes, seed and hasher of src unless opts say otherwise, so that the
+// stored hashes are reused and its shards are sized once. Otherwise the keys
+// are hashed again.
+// The fn function is called outside of the shard locks.
+func TransformValues[K comparable, V1, V2 any](src *Map[K, V1], fn func(key K, value V1) V2, opts ...Option[K, V2]) *Map[K, V2] {
+	// hashers can't be compared, so src's is only kept when opts set none
+	probe := &Map[K, V2]{}
+	for _, opt := range opts {
+		opt(probe)
+	}
+	opts = append([]Option[K, V2]{
+		WithShards[K, V2](len(src.mus) >> src.sbits),
+		WithLockStripes[K, V2](1 << src.sbits),
+		WithSeed[K, V2](src.seed),
+	}, opts...)
+	if src.hasher != nil {
+		opts = append([]Option[K, V2]{WithHasher[K, V2](src.hasher)}, opts...)
+	}
+	dst := newMap[K, V2](src.cap, opts)
+	hasher := dst.hasher == nil && src.hasher == nil || dst.hasher != nil && src.hasher != nil && probe.hasher == nil
+	same := len(dst.mus) == len(src.mus) && dst.sbits == src.sbits && hasher && dst.seed == src.seed
+	if same {
+		dst.reseed = atomic.LoadUint64(&src.reseed)
+	}
+	scap := dst.cap / len(dst.shards)
+	for i := range dst.shards {
+		dst.shards[i].init(scap)
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(src.mus) {
+		workers = len(src.mus)
+	}
+	debug := atomic.LoadUint32(&src.debug)
+	var next uint32
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			var entries []entry[K, V1]
+			for {
+				i := int(atomic.AddUint32(&next, 1) - 1)
+				if i >= len(src.mus) {
+					return
+				}
+				if debug != 0 {
+					src.debugLock(i, false)
+				}
+				src.mus[i].RLock()
+				entries = src.shards[i].AppendEntries(entries[:0])
+				reseed := atomic.LoadUint64(&src.reseed)
+				src.mus[i].RUnlock()
+				if !same || reseed != dst.reseed {
+					// the shards are picked differently
+					for _, e := range entries {
+						dst.Set(e.key, fn(e.key, e.value))
+					}
+					continue
+				}
+				dst.mus[i].Lock()
+				s := &dst.shards[i]
+				if s.length+len(entries) > s.growAt {
+					s.resize(s.sizeFor(s.length + len(entries)))
+				}
+				for _, e := range entries {
+					s.Set(e.hdib>>dibBitSize<<dibBitSize, e.key, fn(e.key, e.value))
+				}
+				dst.unlock(i, 0)
+			}
+		}()
+	}
+	wg.Wait()
+	return dst
+}
+
+// Partition returns two new maps with the options of the map, holding the
+// key/values for which pred returns true and the other ones respectively,
+// split in a single pass shard by shard. Expirations are kept.
+// The pred function is called under the shard read lock and must not mutate
+// the map.
+func (m *Map[K, V]) Partition(pred func(key K, value V) bool) (match, rest *Map[K, V]) {
+	m.lazyInit()
+	for {
+		// a Rehash meanwhile would mix shards picked by both seeds
+		gen := atomic.LoadUint32(&m.gen)
+		if gen&1 != 0 {
+			runtime.Gosched()
+			continue
+		}
+		match, rest = m.empty(), m.empty()
+		debug := atomic.LoadUint32(&m.debug)
+		for i := 0; i < len(m.mus); i++ {
+			if debug != 0 {
+				m.debugLock(i, false)
+			}
+			m.mus[i].RLock()
+			match.mus[i].Lock()
+			rest.mus[i].Lock()
+			m.shards[i].split(pred, &match.shards[i], &rest.shards[i])
+			rest.unlock(i, 0)
+			match.unlock(i, 0)
+			m.mus[i].RUnlock()
+		}
+		if atomic.LoadUint32(&m.gen) == gen {
+			return match, rest
+		}
+		match.Close()
+		rest.Close()
+	}
+}
+
+// empty returns a new empty map with the options, seeds and shard layout of
+// the map.
+func (m *Map[K, V]) empty() *Map[K, V] {
+	c := newMap[K, V](m.cap, m.opts)
+	c.seed, c.reseed = m.seed, atomic.LoadUint64(&m.reseed)
+	scap := c.cap / len(c.shards)
+	for i := range c.shards {
+		c.shards[i].init(scap)
+	}
+	return c
+}
+
+// split adds the live entries for which pred returns true to match, and the
+// other ones to rest.
+func (m *shard[K, V]) split(pred func(key K, value V) bool, match, rest *shard[K, V]) {
+	var now int64
+	for t := m; t != nil; t = t.old {
+		for i := 0; i < len(t.buckets); i++ {
+			if !t.live(i, &now) {
+				continue
+			}
+			e, md := t.buckets[i], meta{}
+			if t.metas != nil {
+				md = t.metas[i]
+			}
+			dst := rest
+			if pred(e.key, e.value) {
+				dst = match
+			}
+			dst.add(e.hdib>>dibBitSize<<dibBitSize, e.key, e.value, md)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package shardmap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateWhere(t *testing.T) {
+	m := New[int, int](0, WithIncrementalResize[int, int](),
+		WithIndex[int, int]("odd", func(v int) string { return k(v % 2) }))
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	m.SetDebugLevel(DebugVerify)
+	n := m.UpdateWhere(func(key, value int) bool { return key%2 == 0 }, func(key, value int) int { return value + 1 })
+	if n != 500 {
+		t.Fatalf("expected '%v', got '%v'", 500, n)
+	}
+	for i := 0; i < 1000; i++ {
+		if v, _ := m.Get(i); v != i|1 {
+			t.Fatalf("expected '%v', got '%v'", i|1, v)
+		}
+	}
+	if keys := m.GetByIndex("odd", k(1)); len(keys) != 1000 {
+		t.Fatalf("expected '%v', got '%v'", 1000, len(keys))
+	}
+}
+
+func TestCountFuncFind(t *testing.T) {
+	m := New[int, int](0)
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	if n := m.CountFunc(func(key, value int) bool { return value%10 == 0 }); n != 100 {
+		t.Fatalf("expected '%v', got '%v'", 100, n)
+	}
+	var calls int
+	key, value, ok := m.Find(func(key, value int) bool {
+		calls++
+		return value >= 500
+	})
+	if !ok || key < 500 || value != key {
+		t.Fatalf("expected '%v', got '%v'", true, ok)
+	}
+	if calls == 1000 {
+		t.Fatalf("expected Find to stop at the first match")
+	}
+	if _, _, ok := m.Find(func(key, value int) bool { return value < 0 }); ok {
+		t.Fatalf("expected '%v', got '%v'", false, ok)
+	}
+}
+
+func TestReduce(t *testing.T) {
+	m := New[int, string](0)
+	for i := 0; i < 1000; i++ {
+		m.Set(i, k(i))
+	}
+	size := func(acc int, key int, value string) int { return acc + len(value) }
+	want := 0
+	for i := 0; i < 1000; i++ {
+		want += len(k(i))
+	}
+	if n := Reduce(m, 0, size); n != want {
+		t.Fatalf("expected '%v', got '%v'", want, n)
+	}
+	for _, workers := range []int{0, 1, 3} {
+		if n := ReduceParallel(m, workers, 0, size, func(a, b int) int { return a + b }); n != want {
+			t.Fatalf("expected '%v', got '%v'", want, n)
+		}
+	}
+}
+
+func TestTransformValues(t *testing.T) {
+	src := New[int, int](0, WithShards[int, int](4))
+	for i := 0; i < 10000; i++ {
+		src.Set(i, i)
+	}
+	for _, opts := range [][]Option[int, string]{nil, {WithShards[int, string](16)}} {
+		dst := TransformValues(src, func(key, value int) string { return k(value) }, opts...)
+		dst.SetDebugLevel(DebugVerify)
+		if n := dst.Len(); n != 10000 {
+			t.Fatalf("expected '%v', got '%v'", 10000, n)
+		}
+		for i := 0; i < 10000; i++ {
+			if v, ok := dst.Get(i); !ok || v != k(i) {
+				t.Fatalf("expected '%v', got '%v'", k(i), v)
+			}
+		}
+		dst.Set(-1, "")
+	}
+}
+
+func TestTransformValuesHasher(t *testing.T) {
+	// the keys are hashed again by another hasher or seed given by opts
+	hasher := func(key int) uint64 { return uint64(key) * 0x9E3779B97F4A7C15 }
+	for _, src := range []*Map[int, int]{
+		New[int, int](0, WithShards[int, int](4)),
+		New[int, int](0, WithShards[int, int](4), WithHasher[int, int](hasher)),
+	} {
+		for i := 0; i < 1000; i++ {
+			src.Set(i, i)
+		}
+		for _, opts := range [][]Option[int, int]{
+			{WithSeed[int, int](42)},
+			{WithHasher[int, int](func(key int) uint64 { return uint64(key) })},
+		} {
+			dst := TransformValues(src, func(key, value int) int { return value }, opts...)
+			for i := 0; i < 1000; i++ {
+				if v, ok := dst.Get(i); !ok || v != i {
+					t.Fatalf("expected '%v', got '%v'", i, v)
+				}
+			}
+		}
+	}
+	dst := TransformValues(New[int, int](0), func(key, value int) int { return value }, WithSeed[int, int](42))
+	if dst.seed != 42 {
+		t.Fatalf("expected '%v', got '%v'", 42, dst.seed)
+	}
+}
+
+func TestPartition(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](4), WithBloomFilter[int, int]())
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	m.SetWithTTL(-1, -1, time.Hour)
+	match, rest := m.Partition(func(key, value int) bool { return value%3 == 0 })
+	match.SetDebugLevel(DebugVerify)
+	rest.SetDebugLevel(DebugVerify)
+	if n := match.Len(); n != 334 {
+		t.Fatalf("expected '%v', got '%v'", 334, n)
+	}
+	if n := rest.Len(); n != 667 {
+		t.Fatalf("expected '%v', got '%v'", 667, n)
+	}
+	for i := -1; i < 1000; i++ {
+		_, inMatch := match.Get(i)
+		_, inRest := rest.Get(i)
+		if inMatch != (i%3 == 0) || inRest == inMatch {
+			t.Fatalf("unexpected partition of %d", i)
+		}
+	}
+	if md := rest.shards[rest.ShardIndex(-1)].metas; md == nil {
+		t.Fatalf("expected the expiration to be kept")
+	}
+	if n := m.Len(); n != 1001 {
+		t.Fatalf("expected '%v', got '%v'", 1001, n)
+	}
+}
@@ -0,0 +1,90 @@
+package shardmap
+
+import "unsafe"
+
+// BytesMap is a Map keyed by byte slices. Lookups use the bytes of the key
+// as is, without converting it to a string, while writes store a copy of it.
+//
+// The zero value is not safe for use; use NewBytesMap.
+type BytesMap[V any] struct {
+	m *Map[string, V]
+}
+
+// NewBytesMap returns a new BytesMap with the specified capacity.
+func NewBytesMap[V any](cap int, opts ...Option[string, V]) *BytesMap[V] {
+	return &BytesMap[V]{m: New[string, V](cap, opts...)}
+}
+
+// Map returns the underlying Map, which is keyed by strings.
+func (m *BytesMap[V]) Map() *Map[string, V] {
+	return m.m
+}
+
+// b2s returns the bytes of b as a string, which must not outlive b.
+func b2s(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
+
+// s2b returns the bytes of s, which must not be modified.
+func s2b(s string) []byte {
+	return *(*[]byte)(unsafe.Pointer(&struct {
+		string
+		cap int
+	}{s, len(s)}))
+}
+
+// Set assigns a value to a key, a copy of key is stored.
+// Returns the previous value, or false when no value was assigned.
+func (m *BytesMap[V]) Set(key []byte, value V) (prev V, replaced bool) {
+	return m.m.Set(string(key), value)
+}
+
+// Get returns a value for a key.
+// Returns false when no value has been assign for key.
+func (m *BytesMap[V]) Get(key []byte) (value V, ok bool) {
+	return m.m.Get(b2s(key))
+}
+
+// Peek returns a value for a key, like Get but without touching its recency.
+func (m *BytesMap[V]) Peek(key []byte) (value V, ok bool) {
+	return m.m.Peek(b2s(key))
+}
+
+// GetOrSet returns the existing value for a key, or assigns the value when
+// the key is absent, storing a copy of key. Returns true when the value was
+// loaded.
+func (m *BytesMap[V]) GetOrSet(key []byte, value V) (actual V, loaded bool) {
+	if actual, loaded = m.m.Get(b2s(key)); loaded {
+		return actual, loaded
+	}
+	return m.m.GetOrSet(string(key), value)
+}
+
+// Delete deletes a value for a key.
+// Returns the deleted value, or false when no value was assigned.
+func (m *BytesMap[V]) Delete(key []byte) (prev V, deleted bool) {
+	return m.m.Delete(b2s(key))
+}
+
+// Len returns the number of values in map.
+func (m *BytesMap[V]) Len() int {
+	return m.m.Len()
+}
+
+// Range iterates over all key/values. The key shares the memory of the
+// stored key and must not be modified or retained.
+func (m *BytesMap[V]) Range(iter func(key []byte, value V) bool) {
+	m.m.Range(func(key string, value V) bool {
+		return iter(s2b(key), value)
+	})
+}
+
+// Clear out all values from map
+func (m *BytesMap[V]) Clear() {
+	m.m.Clear()
+}
+
+// Close closes the underlying Map.
+func (m *BytesMap[V]) Close() error {
+	return m.m.Close()
+}
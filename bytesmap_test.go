@@ -0,0 +1,45 @@
+package shardmap
+
+import (
+	"testing"
+)
+
+func TestBytesMap(t *testing.T) {
+	m := NewBytesMap[int](0)
+	key := []byte("hello")
+	m.Set(key, 1)
+	key[0] = 'j' // the stored key is a copy
+	if v, ok := m.Get([]byte("hello")); !ok || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+	if _, ok := m.Get(key); ok {
+		t.Fatalf("expected no value for '%s'", key)
+	}
+	if v, loaded := m.GetOrSet(key, 2); loaded || v != 2 {
+		t.Fatalf("expected '%v', got '%v'", 2, v)
+	}
+	key[0] = 'h'
+	if v, _ := m.Peek([]byte("jello")); v != 2 {
+		t.Fatalf("expected '%v', got '%v'", 2, v)
+	}
+	var n int
+	m.Range(func(key []byte, value int) bool {
+		if v, _ := m.Get(key); v != value {
+			t.Fatalf("expected '%v', got '%v'", value, v)
+		}
+		n++
+		return true
+	})
+	if n != 2 || m.Len() != 2 {
+		t.Fatalf("expected '%v', got '%v'", 2, n)
+	}
+	if v, ok := m.Delete(key); !ok || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		m.Get(key)
+	})
+	if allocs != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, allocs)
+	}
+}
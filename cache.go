@@ -0,0 +1,66 @@
+package shardmap
+
+import (
+	"context"
+)
+
+// Cache is a read-through and write-through cache in front of a store, such
+// as a database: values are loaded from the store on a miss, and written to
+// it before being cached.
+type Cache[K comparable, V any] struct {
+	m     *Map[K, V]
+	load  func(ctx context.Context, key K) (V, error)
+	store func(ctx context.Context, key K, value V) error
+}
+
+// NewCache returns a new cache with the specified capacity, loading missing
+// values with load and writing values with store, which may be nil for a
+// read-only store. The options configure the underlying map, to bound it or
+// expire its values for instance.
+func NewCache[K comparable, V any](cap int, load func(ctx context.Context, key K) (V, error),
+	store func(ctx context.Context, key K, value V) error, opts ...Option[K, V]) *Cache[K, V] {
+	return &Cache[K, V]{m: New[K, V](cap, opts...), load: load, store: store}
+}
+
+// Map returns the underlying Map.
+func (c *Cache[K, V]) Map() *Map[K, V] {
+	return c.m
+}
+
+// Get returns the value for a key, loading it from the store when it's not
+// cached. Concurrent loads of the same key are deduplicated like
+// GetOrCompute, with the context of the first caller.
+// Returns the error of load, nothing is cached then.
+func (c *Cache[K, V]) Get(ctx context.Context, key K) (V, error) {
+	return c.m.GetOrCompute(key, func() (V, error) {
+		return c.load(ctx, key)
+	})
+}
+
+// Set writes a value to the store, then caches it.
+// Returns the error of store, nothing is cached then.
+func (c *Cache[K, V]) Set(ctx context.Context, key K, value V) error {
+	if c.store != nil {
+		if err := c.store(ctx, key, value); err != nil {
+			return err
+		}
+	}
+	c.m.Set(key, value)
+	return nil
+}
+
+// Invalidate deletes the cached value for a key, so the next Get loads it
+// again.
+func (c *Cache[K, V]) Invalidate(key K) {
+	c.m.Delete(key)
+}
+
+// Len returns the number of values in the cache.
+func (c *Cache[K, V]) Len() int {
+	return c.m.Len()
+}
+
+// Close closes the underlying map.
+func (c *Cache[K, V]) Close() error {
+	return c.m.Close()
+}
@@ -0,0 +1,70 @@
+package shardmap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	var db sync.Map
+	var loads int64
+	errMissing := errors.New("missing")
+	c := NewCache[string, int](0, func(ctx context.Context, key string) (int, error) {
+		atomic.AddInt64(&loads, 1)
+		time.Sleep(10 * time.Millisecond)
+		if v, ok := db.Load(key); ok {
+			return v.(int), nil
+		}
+		return 0, errMissing
+	}, func(ctx context.Context, key string, value int) error {
+		if value < 0 {
+			return errMissing
+		}
+		db.Store(key, value)
+		return nil
+	})
+	defer c.Close()
+	ctx := context.Background()
+	db.Store("a", 1)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.Get(ctx, "a"); v != 1 || err != nil {
+				t.Errorf("expected '%v', got '%v' '%v'", 1, v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt64(&loads); n != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, n)
+	}
+	if _, err := c.Get(ctx, "b"); err != errMissing {
+		t.Fatalf("expected '%v', got '%v'", errMissing, err)
+	}
+	if err := c.Set(ctx, "b", 2); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := db.Load("b"); !ok || v != 2 {
+		t.Fatalf("expected '%v', got '%v'", 2, v)
+	}
+	if err := c.Set(ctx, "b", -1); err != errMissing {
+		t.Fatalf("expected '%v', got '%v'", errMissing, err)
+	}
+	if v, _ := c.Get(ctx, "b"); v != 2 {
+		t.Fatalf("expected '%v', got '%v'", 2, v)
+	}
+	db.Store("a", 3)
+	c.Invalidate("a")
+	if v, _ := c.Get(ctx, "a"); v != 3 {
+		t.Fatalf("expected '%v', got '%v'", 3, v)
+	}
+	if n := c.Len(); n != 2 {
+		t.Fatalf("expected '%v', got '%v'", 2, n)
+	}
+}
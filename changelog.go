@@ -0,0 +1,116 @@
+package shardmap
+
+import (
+	"errors"
+	"sort"
+	"sync/atomic"
+)
+
+// ErrChangesLost is returned by RangeChanges when the change log no longer
+// holds all the changes following the requested sequence number, so that a
+// follower must start over from a snapshot.
+var ErrChangesLost = errors.New("shardmap: changes lost from the change log")
+
+// Change is a logged change of the map, see WithChangeLog.
+type Change[K comparable, V any] struct {
+	Seq   uint64 // increasing sequence number, starting at 1
+	Type  EventType
+	Key   K
+	Value V // the value assigned or removed
+}
+
+// WithChangeLog makes the map log its last n changes, spread over the shards,
+// with sequence numbers increasing across the map, so that RangeChanges can
+// tail them to mirror the map elsewhere.
+func WithChangeLog[K comparable, V any](n int) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.logSize = n
+	}
+}
+
+// changeLog is a ring of the last changes of a shard.
+type changeLog[K comparable, V any] struct {
+	changes []Change[K, V]
+	head    int    // index of the oldest change
+	size    int    // max number of changes
+	lost    uint64 // sequence number of the last change overwritten
+}
+
+// append logs the changes of a locked shard, numbering them from seq.
+func (l *changeLog[K, V]) append(seq *uint64, changes []eviction[K, V]) {
+	for _, e := range changes {
+		c := Change[K, V]{atomic.AddUint64(seq, 1), EventType(e.reason), e.key, e.value}
+		if len(l.changes) < l.size {
+			l.changes = append(l.changes, c)
+			continue
+		}
+		l.lost = l.changes[l.head].Seq
+		l.changes[l.head] = c
+		l.head = (l.head + 1) % l.size
+	}
+}
+
+// RangeChanges calls fn with the logged changes whose sequence numbers are
+// greater than since, in order, until fn returns false. Changes made
+// meanwhile may be left for the next call. A follower passes the sequence
+// number of the last change it has seen, 0 at first.
+// Returns ErrChangesLost, without calling fn, when changes following since
+// are no longer logged.
+func (m *Map[K, V]) RangeChanges(since uint64, fn func(change Change[K, V]) bool) error {
+	m.lazyInit()
+	if m.logs == nil {
+		return nil
+	}
+	// changes numbered up to last are logged, as they are numbered under lock
+	last := atomic.LoadUint64(&m.logSeq)
+	var changes []Change[K, V]
+	for i := 0; i < len(m.mus); i++ {
+		m.mus[i].RLock()
+		l := &m.logs[i]
+		if l.lost > since {
+			m.mus[i].RUnlock()
+			return ErrChangesLost
+		}
+		for _, c := range l.changes {
+			if c.Seq > since && c.Seq <= last {
+				changes = append(changes, c)
+			}
+		}
+		m.mus[i].RUnlock()
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Seq < changes[j].Seq })
+	for _, c := range changes {
+		if !fn(c) {
+			break
+		}
+	}
+	return nil
+}
+
+// Apply replays changes logged by another map, in order, skipping those
+// whose sequence numbers are not greater than the last one applied, so that
+// a follower may be given the same changes again. Set changes are applied
+// with Set, dropping their ttl, and all others with Delete.
+// Returns the sequence number of the last change applied.
+func (m *Map[K, V]) Apply(changes []Change[K, V]) uint64 {
+	m.applyMu.Lock()
+	defer m.applyMu.Unlock()
+	for _, c := range changes {
+		if c.Seq <= m.applied {
+			continue
+		}
+		if c.Type == EventSet {
+			m.Set(c.Key, c.Value)
+		} else {
+			m.Delete(c.Key)
+		}
+		atomic.StoreUint64(&m.applied, c.Seq)
+	}
+	return m.applied
+}
+
+// Applied returns the sequence number of the last change applied by Apply,
+// from which a follower tails the changes of its leader.
+func (m *Map[K, V]) Applied() uint64 {
+	return atomic.LoadUint64(&m.applied)
+}
@@ -0,0 +1,96 @@
+package shardmap
+
+import (
+	"testing"
+)
+
+func TestChangeLog(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](4), WithChangeLog[int, int](400))
+	for i := 0; i < 50; i++ {
+		m.Set(i, i)
+	}
+	for i := 0; i < 50; i += 2 {
+		m.Delete(i)
+	}
+	var changes []Change[int, int]
+	err := m.RangeChanges(0, func(c Change[int, int]) bool {
+		changes = append(changes, c)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 75 {
+		t.Fatalf("expected '%v', got '%v'", 75, len(changes))
+	}
+	for i, c := range changes {
+		if c.Seq != uint64(i+1) {
+			t.Fatalf("expected '%v', got '%v'", i+1, c.Seq)
+		}
+		if want := (Change[int, int]{uint64(i + 1), EventSet, i, i}); i < 50 && c != want {
+			t.Fatalf("expected '%v', got '%v'", want, c)
+		}
+		if i >= 50 && (c.Type != EventDeleted || c.Key != (i-50)*2) {
+			t.Fatalf("unexpected change '%v'", c)
+		}
+	}
+	var n int
+	m.RangeChanges(70, func(c Change[int, int]) bool {
+		n++
+		return true
+	})
+	if n != 5 {
+		t.Fatalf("expected '%v', got '%v'", 5, n)
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	if err := m.RangeChanges(70, func(Change[int, int]) bool { return true }); err != ErrChangesLost {
+		t.Fatalf("expected '%v', got '%v'", ErrChangesLost, err)
+	}
+	cancel := m.Subscribe(func(Event[int, int]) {})
+	cancel()
+	m.Set(-1, -1)
+	m.RangeChanges(1075, func(c Change[int, int]) bool {
+		if c.Key != -1 {
+			t.Fatalf("expected '%v', got '%v'", -1, c.Key)
+		}
+		n++
+		return true
+	})
+	if n != 6 {
+		t.Fatalf("expected '%v', got '%v'", 6, n)
+	}
+}
+
+func TestApply(t *testing.T) {
+	leader := New[int, int](0, WithChangeLog[int, int](10000))
+	follower := New[int, int](0)
+	sync := func() {
+		var changes []Change[int, int]
+		if err := leader.RangeChanges(follower.Applied(), func(c Change[int, int]) bool {
+			changes = append(changes, c)
+			return true
+		}); err != nil {
+			t.Fatal(err)
+		}
+		follower.Apply(changes)
+		// replaying is a no-op
+		follower.Apply(changes)
+	}
+	for i := 0; i < 100; i++ {
+		leader.Set(i, i)
+	}
+	sync()
+	for i := 0; i < 100; i += 3 {
+		leader.Delete(i)
+		leader.Set(i+1, -i)
+	}
+	sync()
+	if follower.Fingerprint() != leader.Fingerprint() {
+		t.Fatalf("expected '%v', got '%v'", leader.Fingerprint(), follower.Fingerprint())
+	}
+	if follower.Applied() != 168 {
+		t.Fatalf("expected '%v', got '%v'", 168, follower.Applied())
+	}
+}
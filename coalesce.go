@@ -0,0 +1,104 @@
+package shardmap
+
+import (
+	"sync"
+	"time"
+)
+
+// WithCoalescing buffers the values of SetCoalesced for up to window, keeping
+// only the last value of every key, then assigns them with a single lock of
+// every shard, for writers setting a few hot keys at high rates. Reads do
+// not observe the buffered values until they are flushed.
+func WithCoalescing[K comparable, V any](window time.Duration) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.coalesce = window
+	}
+}
+
+// coalesced buffers the values of SetCoalesced of a few keys.
+type coalesced[K comparable, V any] struct {
+	mu     sync.Mutex
+	values map[K]V
+	_      [64]byte // avoid false sharing
+}
+
+// SetCoalesced assigns a value to a key like Set, but asynchronously when the
+// map was created with WithCoalescing: the value is buffered, replacing the
+// previous value of the key, and assigned within the window. Concurrent
+// SetCoalesced calls for the same key are ordered like concurrent Sets.
+func (m *Map[K, V]) SetCoalesced(key K, value V) {
+	m.lazyInit()
+	if m.pending == nil {
+		m.Set(key, value)
+		return
+	}
+	// every key has one buffer, so its last value wins; the stack address
+	// of the caller would move with its stack and leave stale values behind
+	c := &m.pending[m.hash(key)%uint64(len(m.pending))]
+	c.mu.Lock()
+	if c.values == nil {
+		c.values = make(map[K]V)
+	}
+	c.values[key] = value
+	c.mu.Unlock()
+}
+
+// FlushCoalesced assigns the values buffered by SetCoalesced right away.
+func (m *Map[K, V]) FlushCoalesced() {
+	m.lazyInit()
+	var entries [][]entry[K, V]
+	for i := range m.pending {
+		c := &m.pending[i]
+		c.mu.Lock()
+		values := c.values
+		c.values = nil
+		c.mu.Unlock()
+		if len(values) == 0 {
+			continue
+		}
+		if entries == nil {
+			entries = make([][]entry[K, V], len(m.mus))
+		}
+		for key, value := range values {
+			hash := m.hash(key)
+			shard := m.shardOf(hash)
+			entries[shard] = append(entries[shard], entry[K, V]{hdib: hash, key: key, value: value})
+		}
+	}
+	var moved []entry[K, V]
+	for i := range entries {
+		if len(entries[i]) == 0 {
+			continue
+		}
+		debug, ok := m.lock(i)
+		if !ok {
+			return
+		}
+		s := &m.shards[i]
+		for _, e := range entries[i] {
+			if m.shardOf(e.hdib) != i {
+				// moved by Rehash meanwhile
+				moved = append(moved, e)
+				continue
+			}
+			s.Set(e.hdib, e.key, e.value)
+		}
+		m.unlock(i, debug)
+	}
+	for _, e := range moved {
+		m.SetHashed(e.hdib, e.key, e.value)
+	}
+}
+
+func (m *Map[K, V]) runCoalescer(done <-chan struct{}) {
+	ticker := time.NewTicker(m.coalesce)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			m.FlushCoalesced()
+		}
+	}
+}
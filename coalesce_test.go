@@ -0,0 +1,63 @@
+package shardmap
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetCoalesced(t *testing.T) {
+	var mu sync.Mutex
+	var sets int
+	m := New[int, int](0, WithCoalescing[int, int](time.Hour))
+	m.Subscribe(func(event Event[int, int]) {
+		mu.Lock()
+		sets++
+		mu.Unlock()
+	})
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10000; i++ {
+				m.SetCoalesced(i%10, i)
+			}
+		}()
+	}
+	wg.Wait()
+	if _, ok := m.Get(0); ok {
+		t.Fatalf("expected the values to be buffered")
+	}
+	m.FlushCoalesced()
+	for i := 0; i < 10; i++ {
+		if v, ok := m.Get(i); !ok || v != 9990+i {
+			t.Fatalf("expected '%v', got '%v'", 9990+i, v)
+		}
+	}
+	mu.Lock()
+	n := sets
+	mu.Unlock()
+	if n > 40 {
+		t.Fatalf("expected at most '%v' sets, got '%v'", 40, n)
+	}
+	m.SetCoalesced(-1, -1)
+	m.Close()
+	mu.Lock()
+	n, sets = sets-n, 0
+	mu.Unlock()
+	if n != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, n)
+	}
+
+	m = New[int, int](0, WithCoalescing[int, int](time.Millisecond))
+	defer m.Close()
+	m.SetCoalesced(1, 1)
+	for i := 0; i < 1000; i++ {
+		if _, ok := m.Get(1); ok {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected the values to be flushed")
+}
@@ -0,0 +1,79 @@
+package shardmap
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// errComputePanicked is returned to the callers waiting on a GetOrCompute
+// whose function panicked.
+var errComputePanicked = errors.New("shardmap: GetOrCompute function panicked")
+
+// call is an in-flight GetOrCompute of a key.
+type call[V any] struct {
+	wg    sync.WaitGroup
+	value V
+	err   error
+}
+
+// GetOrCompute returns the existing value for a key, or assigns the value
+// returned by fn when the key is absent. Concurrent calls for the same absent
+// key wait for a single fn, called outside of the shard lock, and share its
+// result. When fn returns an error nothing is assigned, and the error is
+// returned to all of them.
+func (m *Map[K, V]) GetOrCompute(key K, fn func() (V, error)) (V, error) {
+	if value, ok := m.Get(key); ok {
+		return value, nil
+	}
+	hash := m.hash(key)
+	shard, debug, ok := m.lockHash(hash)
+	if !ok {
+		var zero V
+		return zero, ErrReadOnly
+	}
+	if value, ok := m.shards[shard].Get(hash, key, true); ok {
+		m.unlock(shard, debug)
+		return value, nil
+	}
+	if c, ok := m.calls[shard][key]; ok {
+		m.unlock(shard, debug)
+		c.wg.Wait()
+		return c.value, c.err
+	}
+	c := &call[V]{err: errComputePanicked}
+	c.wg.Add(1)
+	if m.calls[shard] == nil {
+		m.calls[shard] = make(map[K]*call[V])
+	}
+	m.calls[shard][key] = c
+	m.unlock(shard, debug)
+
+	func() {
+		defer m.finish(hash, key, c)
+		c.value, c.err = fn()
+	}()
+	return c.value, c.err
+}
+
+// finish assigns the value of a successful call unless the key was assigned
+// meanwhile, then releases its waiters.
+func (m *Map[K, V]) finish(hash uint64, key K, c *call[V]) {
+	defer c.wg.Done()
+	shard := m.shardOf(hash)
+	m.mus[shard].Lock()
+	for m.shardOf(hash) != shard {
+		m.mus[shard].Unlock()
+		shard = m.shardOf(hash)
+		m.mus[shard].Lock()
+	}
+	delete(m.calls[shard], key)
+	if c.err != nil || atomic.LoadUint32(&m.state) != stateOpen {
+		m.mus[shard].Unlock()
+		return
+	}
+	if actual, loaded := m.shards[shard].GetOrSet(hash, key, c.value); loaded {
+		c.value = actual
+	}
+	m.unlock(shard, 0)
+}
@@ -0,0 +1,52 @@
+package shardmap
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetOrCompute(t *testing.T) {
+	m := New[string, int](0)
+	var calls int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := m.GetOrCompute("hello", func() (int, error) {
+				atomic.AddInt32(&calls, 1)
+				time.Sleep(10 * time.Millisecond)
+				return 1, nil
+			})
+			if v != 1 || err != nil {
+				t.Errorf("expected '%v', got '%v' '%v'", 1, v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, calls)
+	}
+	if v, ok := m.Get("hello"); !ok || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+
+	errLoad := errors.New("load")
+	if _, err := m.GetOrCompute("world", func() (int, error) { return 2, errLoad }); err != errLoad {
+		t.Fatalf("expected '%v', got '%v'", errLoad, err)
+	}
+	if _, ok := m.Get("world"); ok {
+		t.Fatalf("expected no value")
+	}
+
+	func() {
+		defer func() { recover() }()
+		m.GetOrCompute("world", func() (int, error) { panic("load") })
+	}()
+	if v, err := m.GetOrCompute("world", func() (int, error) { return 2, nil }); v != 2 || err != nil {
+		t.Fatalf("expected '%v', got '%v' '%v'", 2, v, err)
+	}
+}
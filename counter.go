@@ -0,0 +1,70 @@
+package shardmap
+
+// Counter is a map of int64 counters, where absent keys count as zero.
+//
+// The zero value is not safe for use; use NewCounter.
+type Counter[K comparable] struct {
+	m *Map[K, int64]
+}
+
+// NewCounter returns a new Counter with the specified capacity.
+func NewCounter[K comparable](cap int, opts ...Option[K, int64]) *Counter[K] {
+	return &Counter[K]{m: New[K, int64](cap, opts...)}
+}
+
+// Map returns the underlying Map.
+func (c *Counter[K]) Map() *Map[K, int64] {
+	return c.m
+}
+
+// Inc increments the counter of a key, and returns its new value.
+func (c *Counter[K]) Inc(key K) int64 {
+	return Add(c.m, key, 1)
+}
+
+// Dec decrements the counter of a key, and returns its new value.
+func (c *Counter[K]) Dec(key K) int64 {
+	return Add(c.m, key, -1)
+}
+
+// Add adds delta to the counter of a key, and returns its new value.
+func (c *Counter[K]) Add(key K, delta int64) int64 {
+	return Add(c.m, key, delta)
+}
+
+// Get returns the counter of a key.
+func (c *Counter[K]) Get(key K) int64 {
+	n, _ := c.m.Get(key)
+	return n
+}
+
+// Reset resets the counter of a key to zero, and returns its previous value.
+func (c *Counter[K]) Reset(key K) int64 {
+	n, _ := c.m.Delete(key)
+	return n
+}
+
+// Sum returns the sum of all counters, shard by shard.
+func (c *Counter[K]) Sum() (sum int64) {
+	c.m.Range(func(key K, n int64) bool {
+		sum += n
+		return true
+	})
+	return sum
+}
+
+// Len returns the number of counters.
+func (c *Counter[K]) Len() int {
+	return c.m.Len()
+}
+
+// Range iterates over all counters.
+// It's not safe to call Inc or Reset while ranging.
+func (c *Counter[K]) Range(iter func(key K, n int64) bool) {
+	c.m.Range(iter)
+}
+
+// Clear resets all counters.
+func (c *Counter[K]) Clear() {
+	c.m.Clear()
+}
@@ -0,0 +1,40 @@
+package shardmap
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCounter(t *testing.T) {
+	c := NewCounter[string](0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.Inc(k(j % 10))
+			}
+		}()
+	}
+	wg.Wait()
+	if n := c.Get(k(0)); n != 800 {
+		t.Fatalf("expected '%v', got '%v'", 800, n)
+	}
+	if n := c.Sum(); n != 8000 {
+		t.Fatalf("expected '%v', got '%v'", 8000, n)
+	}
+	if n := c.Dec(k(0)); n != 799 {
+		t.Fatalf("expected '%v', got '%v'", 799, n)
+	}
+	if n := c.Reset(k(0)); n != 799 {
+		t.Fatalf("expected '%v', got '%v'", 799, n)
+	}
+	if n := c.Get(k(0)); n != 0 || c.Len() != 9 {
+		t.Fatalf("expected '%v', got '%v'", 0, n)
+	}
+	c.Clear()
+	if n := c.Sum(); n != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, n)
+	}
+}
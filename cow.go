@@ -0,0 +1,53 @@
+package shardmap
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// WithCopyOnWrite optimizes the map for read-mostly workloads: every mutation
+// of a shard publishes a read-only copy of its entries, which Get and Peek
+// read with a single atomic load instead of taking the shard lock. Writes pay
+// for copying the shard, and Get no longer records accesses for WithLRU.
+func WithCopyOnWrite[K comparable, V any]() Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.cow = true
+	}
+}
+
+// table loads the read-only copy of shard i, nil when it's empty.
+func (m *Map[K, V]) table(i int) *shard[K, V] {
+	return (*shard[K, V])(atomic.LoadPointer(&m.tables[i]))
+}
+
+// publish stores a read-only copy of the locked shard i for readers, unless
+// its entries did not change since the last copy.
+func (m *Map[K, V]) publish(i int) {
+	s := &m.shards[i]
+	if t := m.table(i); t != nil && t.ops == s.ops {
+		return
+	}
+	atomic.StorePointer(&m.tables[i], unsafe.Pointer(s.frozen()))
+}
+
+// frozen returns a copy of the entries of the shard, which can only be read.
+func (m *shard[K, V]) frozen() *shard[K, V] {
+	c := &shard[K, V]{
+		buckets: make([]entry[K, V], len(m.buckets)),
+		conf:    m.conf,
+		length:  m.length,
+		mask:    m.mask,
+		ops:     m.ops,
+	}
+	copy(c.buckets, m.buckets)
+	if m.metas != nil {
+		c.metas = make([]meta, len(m.metas))
+		for i := range m.metas {
+			c.metas[i] = meta{expire: m.metas[i].expire}
+		}
+	}
+	if m.old != nil {
+		c.old = m.old.frozen()
+	}
+	return c
+}
@@ -0,0 +1,89 @@
+package shardmap
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCopyOnWrite(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](4), WithCopyOnWrite[int, int]())
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if v, ok := m.Get(i % 1000); ok && v != i%1000 {
+					t.Errorf("expected '%v', got '%v'", i%1000, v)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+		if v, ok := m.Peek(i); !ok || v != i {
+			t.Fatalf("expected '%v', got '%v'", i, v)
+		}
+	}
+	close(done)
+	wg.Wait()
+	m.Delete(1)
+	if _, ok := m.Get(1); ok {
+		t.Fatalf("expected '%v' to be deleted", 1)
+	}
+	c := m.Clone()
+	m.Clear()
+	if _, ok := m.Get(2); ok {
+		t.Fatalf("expected '%v' to be cleared", 2)
+	}
+	if v, ok := c.Get(2); !ok || v != 2 {
+		t.Fatalf("expected '%v', got '%v'", 2, v)
+	}
+	c.Close()
+	if _, ok := c.Get(2); ok {
+		t.Fatalf("expected '%v' to be closed", 2)
+	}
+}
+
+func BenchmarkCopyOnWriteGet(b *testing.B) {
+	m := New[int, int](0, WithCopyOnWrite[int, int]())
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			m.Get(i % 1000)
+			i++
+		}
+	})
+}
+
+func TestCopyOnWriteExpire(t *testing.T) {
+	m := New[int, int](0, WithCopyOnWrite[int, int]())
+	m.SetWithTTL(1, 1, time.Millisecond)
+	m.Set(2, 2)
+	if !m.Expire(1, 0) {
+		t.Fatal("expected true")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if v, ok := m.Get(1); !ok || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+	if !m.Expire(1, time.Millisecond) {
+		t.Fatal("expected true")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := m.Get(1); ok {
+		t.Fatal("expected false")
+	}
+}
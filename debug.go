@@ -0,0 +1,122 @@
+package shardmap
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// DebugLevel controls the runtime verification performed by a Map.
+type DebugLevel uint32
+
+const (
+	// DebugOff disables all verification, this is the default.
+	DebugOff DebugLevel = iota
+	// DebugAssert detects re-entrant calls from Mutate and Range callbacks,
+	// mutations during Range, and checks cheap shard invariants.
+	DebugAssert
+	// DebugVerify additionally verifies the whole shard after each mutation.
+	DebugVerify
+)
+
+// SetDebugLevel changes the verification level of the map at runtime.
+// Violations are reported by panicking. Levels above DebugOff are expensive
+// and meant for diagnosing misuse or corruption.
+func (m *Map[K, V]) SetDebugLevel(level DebugLevel) {
+	atomic.StoreUint32(&m.debug, uint32(level))
+	if level == DebugOff {
+		// forget callbacks that were left by a panic.
+		m.dbg.mu.Lock()
+		m.dbg.frames = nil
+		m.dbg.mu.Unlock()
+	}
+}
+
+type debugFrame struct {
+	shard   int
+	ranging bool
+}
+
+// debugState tracks the callbacks that goroutines are running under a shard lock.
+type debugState struct {
+	mu     sync.Mutex
+	frames map[int64][]debugFrame
+}
+
+// debugLock checks that the current goroutine may lock shard i.
+func (m *Map[K, V]) debugLock(i int, write bool) {
+	id := goid()
+	m.dbg.mu.Lock()
+	frames := m.dbg.frames[id]
+	m.dbg.mu.Unlock()
+	for _, f := range frames {
+		if write && f.ranging {
+			panic("shardmap: mutation during Range")
+		}
+	}
+	for _, f := range frames {
+		if f.shard == i {
+			panic(fmt.Sprintf("shardmap: re-entrant call on locked shard %d", i))
+		}
+	}
+}
+
+// debugPush records that the current goroutine is running a callback under
+// the lock of shard i, debugPop removes the record.
+func (m *Map[K, V]) debugPush(i int, ranging bool) {
+	id := goid()
+	m.dbg.mu.Lock()
+	if m.dbg.frames == nil {
+		m.dbg.frames = make(map[int64][]debugFrame)
+	}
+	m.dbg.frames[id] = append(m.dbg.frames[id], debugFrame{i, ranging})
+	m.dbg.mu.Unlock()
+}
+
+func (m *Map[K, V]) debugPop() {
+	id := goid()
+	m.dbg.mu.Lock()
+	if frames := m.dbg.frames[id]; len(frames) > 1 {
+		m.dbg.frames[id] = frames[:len(frames)-1]
+	} else {
+		delete(m.dbg.frames, id)
+	}
+	m.dbg.mu.Unlock()
+}
+
+// debugVerify checks the invariants of the write locked shard i. On failure
+// the shard is unlocked before panicking.
+func (m *Map[K, V]) debugVerify(i int, level uint32) {
+	if err := m.verifyShard(i, level); err != nil {
+		m.mus[i].Unlock()
+		panic(err)
+	}
+}
+
+func (m *Map[K, V]) verifyShard(i int, level uint32) (err error) {
+	s := &m.shards[i]
+	if level >= uint32(DebugVerify) {
+		err = s.verify()
+	} else if s.length < 0 || s.length > len(s.buckets) {
+		err = fmt.Errorf("length %d out of range [0, %d]", s.length, len(s.buckets))
+	}
+	if err != nil {
+		err = fmt.Errorf("shardmap: shard %d is corrupted: %w", i, err)
+	}
+	return err
+}
+
+// goid returns the id of the current goroutine.
+func goid() int64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i > 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseInt(string(b), 10, 64)
+	return id
+}
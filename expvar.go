@@ -0,0 +1,32 @@
+package shardmap
+
+import (
+	"expvar"
+)
+
+// Expvar publishes the stats of the map as the expvar variable name, which
+// is computed on every read. Like expvar.Publish, it panics if name is
+// already registered.
+func (m *Map[K, V]) Expvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		st := m.Stats()
+		v := struct {
+			Len         int    `json:"len"`
+			Shards      []int  `json:"shards"`
+			Resizes     int    `json:"resizes"`
+			Sets        uint64 `json:"sets"`
+			Deletes     uint64 `json:"deletes"`
+			Evictions   uint64 `json:"evictions"`
+			Expirations uint64 `json:"expirations"`
+		}{Len: st.Len, Shards: make([]int, len(st.Shards))}
+		for i, s := range st.Shards {
+			v.Shards[i] = s.Len
+			v.Resizes += s.Resizes
+			v.Sets += s.Sets
+			v.Deletes += s.Deletes
+			v.Evictions += s.Evictions
+			v.Expirations += s.Expirations
+		}
+		return v
+	}))
+}
@@ -0,0 +1,68 @@
+package shardmap
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// WithBloomFilter puts a Bloom filter in front of every shard, so that Get and
+// Peek of most absent keys return without taking the shard lock or probing.
+// It costs about a byte per bucket. Deleted keys stay in the filter until the
+// shard is resized, which only makes it less selective.
+func WithBloomFilter[K comparable, V any]() Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.bloom = true
+	}
+}
+
+// bloom is a blocked Bloom filter, each hash sets three bits of a single word.
+// Words are only set with atomic operations, so that it can be read without
+// the shard lock.
+type bloom struct {
+	words []uint64
+	mask  int
+}
+
+func newBloom(buckets int) *bloom {
+	n := buckets / 8
+	if n < 1 {
+		n = 1
+	}
+	return &bloom{words: make([]uint64, n), mask: n - 1}
+}
+
+func (b *bloom) bits(hash int) (int, uint64) {
+	h := uint64(hash) * 0x9E3779B97F4A7C15
+	return int(h>>32) & b.mask, 1<<(h&63) | 1<<(h>>6&63) | 1<<(h>>12&63)
+}
+
+func (b *bloom) add(hash int) {
+	i, bits := b.bits(hash)
+	for {
+		old := atomic.LoadUint64(&b.words[i])
+		if old&bits == bits || atomic.CompareAndSwapUint64(&b.words[i], old, old|bits) {
+			return
+		}
+	}
+}
+
+func (b *bloom) has(hash int) bool {
+	i, bits := b.bits(hash)
+	return atomic.LoadUint64(&b.words[i])&bits == bits
+}
+
+// filter publishes the bloom of a shard to lock-free readers. It's owned by the
+// map rather than the shard, as resizes overwrite the shard wholesale.
+type filter struct {
+	p unsafe.Pointer // *bloom
+}
+
+func (f *filter) store(b *bloom) {
+	atomic.StorePointer(&f.p, unsafe.Pointer(b))
+}
+
+// has reports whether the key of hash may be in the shard.
+func (f *filter) has(xxh uint64) bool {
+	b := (*bloom)(atomic.LoadPointer(&f.p))
+	return b == nil || b.has(int(xxh>>dibBitSize))
+}
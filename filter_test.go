@@ -0,0 +1,51 @@
+package shardmap
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	m := New[string, int](0, WithBloomFilter[string, int]())
+	m.SetDebugLevel(DebugVerify)
+	for i := 0; i < 10000; i++ {
+		m.Set(k(i), i)
+	}
+	for i := 0; i < 10000; i++ {
+		if v, ok := m.Get(k(i)); !ok || v != i {
+			t.Fatalf("expected '%v', got '%v'", i, v)
+		}
+	}
+	var hits int
+	for i := 0; i < 10000; i++ {
+		key := "absent" + strconv.Itoa(i)
+		if _, ok := m.Peek(key); ok {
+			t.Fatalf("expected '%v' to be absent", key)
+		}
+		if m.filters[m.hash(key)&uint64(len(m.mus)-1)].has(m.hash(key)) {
+			hits++
+		}
+	}
+	if hits > 1000 {
+		t.Fatalf("expected at most '%v' false positives, got '%v'", 1000, hits)
+	}
+	c := m.Clone()
+	m.Clear()
+	if _, ok := m.Get(k(1)); ok {
+		t.Fatalf("expected '%v' to be cleared", k(1))
+	}
+	if v, ok := c.Get(k(1)); !ok || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+}
+
+func BenchmarkBloomFilterMiss(b *testing.B) {
+	m := New[string, int](0, WithBloomFilter[string, int]())
+	for i := 0; i < 100000; i++ {
+		m.Set(k(i), i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Get("absent")
+	}
+}
@@ -0,0 +1,31 @@
+package shardmap
+
+import (
+	"reflect"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Fingerprint returns a hash of the content of the map which doesn't depend
+// on the order of insertion, the seed or the shards, so that replicas holding
+// the same key/values have the same fingerprint. Entries are hashed with
+// wyhash, unlike the keys of WithHasher, and summed.
+// It panics if V is not a comparable type.
+func (m *Map[K, V]) Fingerprint() uint64 {
+	m.lazyInit()
+	var zero V
+	t := reflect.TypeOf(&zero).Elem()
+	if !t.Comparable() {
+		panic("shardmap: fingerprint of unhashable type " + t.String())
+	}
+	fields := appendKeyFields(nil, t, 0)
+	var sum uint64
+	debug := atomic.LoadUint32(&m.debug)
+	for i := 0; i < len(m.mus); i++ {
+		m.rangeShard(i, debug, func(key K, value V) bool {
+			sum += hashFields(unsafe.Pointer(&value), fields, m.keys.hash(key, 0))
+			return true
+		})
+	}
+	return sum
+}
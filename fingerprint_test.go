@@ -0,0 +1,37 @@
+package shardmap
+
+import (
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	a := New[string, int](0, WithShards[string, int](4))
+	b := New[string, int](0, WithShards[string, int](16))
+	for i := 0; i < 1000; i++ {
+		a.Set(k(i), i)
+		b.Set(k(999-i), 999-i)
+	}
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Fatalf("expected '%v', got '%v'", a.Fingerprint(), b.Fingerprint())
+	}
+	b.Set(k(1), 2)
+	if a.Fingerprint() == b.Fingerprint() {
+		t.Fatalf("expected different fingerprints")
+	}
+	b.Set(k(1), 1)
+	b.Delete(k(2))
+	if a.Fingerprint() == b.Fingerprint() {
+		t.Fatalf("expected different fingerprints")
+	}
+	if fp := New[string, int](0).Fingerprint(); fp != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, fp)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expected a panic")
+			}
+		}()
+		New[int, []int](0).Fingerprint()
+	}()
+}
@@ -0,0 +1,173 @@
+package shardmap
+
+import (
+	"math"
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+// field kinds of a key layout
+const (
+	fieldRaw uint8 = iota
+	fieldString
+	fieldFloat32
+	fieldFloat64
+	fieldIface
+)
+
+// keyField is a part of a key which is hashed on its own.
+type keyField struct {
+	off  uintptr
+	size uintptr
+	kind uint8
+	typ  reflect.Type // interface type, for fieldIface
+}
+
+// keyHash hashes keys of type K with wyhash.
+type keyHash[K comparable] struct {
+	size   int        // size of the keys, 0 for strings
+	fields []keyField // set when keys can't be hashed as raw memory
+}
+
+func (h *keyHash[K]) init() {
+	var k K
+	switch ((any)(k)).(type) {
+	case string:
+		h.size = 0
+	default:
+		h.size = int(unsafe.Sizeof(k))
+		h.fields = keyLayout(reflect.TypeOf(&k).Elem())
+	}
+}
+
+func (h *keyHash[K]) hash(key K, seed uint64) uint64 {
+	if h.fields != nil {
+		return hashFields(unsafe.Pointer(&key), h.fields, seed)
+	}
+	if h.size == 0 {
+		return wyhash_HashString(*(*string)(unsafe.Pointer(&key)), seed)
+	}
+	return wyhash_HashString(*(*string)(unsafe.Pointer(&struct {
+		data unsafe.Pointer
+		len  int
+	}{unsafe.Pointer(&key), h.size})), seed)
+}
+
+// keyLayout returns the fields of the keys of type t, so that equal keys
+// always hash the same: padding and blank fields are skipped, strings are
+// hashed by content, floats are hashed by value, and interfaces are hashed by
+// their dynamic value. It returns nil when the
+// memory of the keys can be hashed as is.
+func keyLayout(t reflect.Type) []keyField {
+	fields := appendKeyFields(nil, t, 0)
+	if len(fields) == 1 && fields[0].kind == fieldRaw && fields[0].size == t.Size() {
+		return nil
+	}
+	return fields
+}
+
+func appendKeyFields(fields []keyField, t reflect.Type, off uintptr) []keyField {
+	switch t.Kind() {
+	case reflect.String:
+		return append(fields, keyField{off, t.Size(), fieldString, nil})
+	case reflect.Float32:
+		return append(fields, keyField{off, 4, fieldFloat32, nil})
+	case reflect.Float64:
+		return append(fields, keyField{off, 8, fieldFloat64, nil})
+	case reflect.Complex64:
+		return append(fields, keyField{off, 4, fieldFloat32, nil}, keyField{off + 4, 4, fieldFloat32, nil})
+	case reflect.Complex128:
+		return append(fields, keyField{off, 8, fieldFloat64, nil}, keyField{off + 8, 8, fieldFloat64, nil})
+	case reflect.Interface:
+		return append(fields, keyField{off, t.Size(), fieldIface, t})
+	case reflect.Array:
+		size := t.Elem().Size()
+		for i := 0; i < t.Len(); i++ {
+			fields = appendKeyFields(fields, t.Elem(), off+uintptr(i)*size)
+		}
+		return fields
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if f := t.Field(i); f.Name != "_" {
+				fields = appendKeyFields(fields, f.Type, off+f.Offset)
+			}
+		}
+		return fields
+	}
+	if t.Size() == 0 {
+		return fields
+	}
+	// merge adjacent raw memory
+	if n := len(fields); n > 0 && fields[n-1].kind == fieldRaw && fields[n-1].off+fields[n-1].size == off {
+		fields[n-1].size += t.Size()
+		return fields
+	}
+	return append(fields, keyField{off, t.Size(), fieldRaw, nil})
+}
+
+// typeFields caches the fields of the dynamic types of interface keys.
+var typeFields sync.Map // map[reflect.Type][]keyField
+
+// hashIface returns the hash of the dynamic value of the interface of type t
+// at p. The interface is copied so that p does not escape.
+func hashIface(p unsafe.Pointer, t reflect.Type, seed uint64) uint64 {
+	v := reflect.New(t).Elem()
+	*(*[2]unsafe.Pointer)(unsafe.Pointer(v.UnsafeAddr())) = *(*[2]unsafe.Pointer)(p)
+	return hashValue(v.Elem(), seed)
+}
+
+// hashValue returns the hash of v, the dynamic value of an interface key.
+// Like a Go map, it panics if v is not comparable.
+func hashValue(v reflect.Value, seed uint64) uint64 {
+	if !v.IsValid() {
+		return seed
+	}
+	t := v.Type()
+	if !t.Comparable() {
+		panic("shardmap: hash of unhashable type " + t.String())
+	}
+	if t.Kind() == reflect.String {
+		return wyhash_HashString(v.String(), seed)
+	}
+	fields, ok := typeFields.Load(t)
+	if !ok {
+		fields, _ = typeFields.LoadOrStore(t, appendKeyFields(nil, t, 0))
+	}
+	p := reflect.New(t)
+	p.Elem().Set(v)
+	return hashFields(unsafe.Pointer(p.Pointer()), fields.([]keyField), seed)
+}
+
+// hashFields returns the hash of the key at p by its fields.
+func hashFields(p unsafe.Pointer, fields []keyField, seed uint64) uint64 {
+	h := seed
+	for _, f := range fields {
+		fp := unsafe.Pointer(uintptr(p) + f.off)
+		switch f.kind {
+		case fieldRaw:
+			h = wyhash_HashString(*(*string)(unsafe.Pointer(&struct {
+				data unsafe.Pointer
+				len  int
+			}{fp, int(f.size)})), h)
+		case fieldString:
+			// the seed is changed so that empty strings still count
+			h = wyhash_HashString(*(*string)(fp), h^wyhash__wyp0)
+		case fieldFloat32:
+			v := *(*float32)(fp)
+			if v == 0 {
+				v = 0 // -0 == +0
+			}
+			h = wyhash__wymum(h^uint64(math.Float32bits(v)), wyhash__wyp0)
+		case fieldFloat64:
+			v := *(*float64)(fp)
+			if v == 0 {
+				v = 0 // -0 == +0
+			}
+			h = wyhash__wymum(h^math.Float64bits(v), wyhash__wyp0)
+		case fieldIface:
+			h = hashIface(fp, f.typ, h^wyhash__wyp1)
+		}
+	}
+	return h
+}
@@ -0,0 +1,52 @@
+//go:build go1.20
+
+package shardmap
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInterfaceKeys(t *testing.T) {
+	type point struct {
+		X, Y float64
+	}
+	m := New[any, int](0)
+	m.SetDebugLevel(DebugVerify)
+	m.Set(strings.Repeat("a", 2), 1)
+	m.Set(point{1, 2}, 2)
+	m.Set(nil, 3)
+	m.Set(int64(4), 4)
+	for i, key := range []any{"aa", point{1, 2}, nil, int64(4)} {
+		if v, ok := m.Get(key); !ok || v != i+1 {
+			t.Fatalf("expected '%v', got '%v'", i+1, v)
+		}
+	}
+	if _, ok := m.Get(4); ok {
+		t.Fatalf("expected int(4) to differ from int64(4)")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected a panic for an unhashable key")
+		}
+	}()
+	m.Set([]byte("a"), 5)
+}
+
+func TestInterfaceFields(t *testing.T) {
+	type named struct {
+		Key fmt.Stringer
+	}
+	n := New[named, int](0)
+	n.Set(named{time.Second}, 1)
+	if v, ok := n.Get(named{time.Duration(1e9)}); !ok || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+	n.Set(named{}, 2)
+	if v, ok := n.Get(named{}); !ok || v != 2 {
+		t.Fatalf("expected '%v', got '%v'", 2, v)
+	}
+}
@@ -0,0 +1,55 @@
+package shardmap
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestKeyLayout(t *testing.T) {
+	type padded struct {
+		A int8
+		B int64
+	}
+	type named struct {
+		Name string
+		ID   int
+	}
+	type blank struct {
+		A int32
+		_ int32
+	}
+
+	m1 := New[padded, int](0)
+	k1 := padded{A: 1, B: 2}
+	// dirty the padding bytes of a copy
+	k2 := k1
+	(*[16]byte)(unsafe.Pointer(&k2))[1] = 0xff
+	if k1 != k2 || m1.hash(k1) != m1.hash(k2) {
+		t.Fatalf("expected equal hashes for %v and %v", k1, k2)
+	}
+
+	m2 := New[named, int](0)
+	m2.Set(named{"hello", 1}, 1)
+	if v, ok := m2.Get(named{strings.Repeat("hel", 1) + "lo", 1}); !ok || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+
+	m3 := New[float64, int](0)
+	m3.Set(0, 1)
+	if v, ok := m3.Get(math.Copysign(0, -1)); !ok || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+
+	m4 := New[blank, int](0)
+	b1, b2 := blank{A: 1}, blank{A: 1}
+	(*[2]int32)(unsafe.Pointer(&b2))[1] = 7
+	if b1 != b2 || m4.hash(b1) != m4.hash(b2) {
+		t.Fatalf("expected equal hashes for %v and %v", b1, b2)
+	}
+
+	if New[int, int](0).keys.fields != nil {
+		t.Fatalf("expected raw hashing of int keys")
+	}
+}
@@ -0,0 +1,34 @@
+package shardmap
+
+// WithOnGet registers fn to be called after every Get, GetHashed and TryGet
+// with the key and whether it had a value, for accounting such as auditing or
+// quotas. Only these are lookups, with the Get methods of Store: Peek, Has,
+// View and the reads of the other methods, like GetOrSet or Mutate, don't
+// call fn.
+// The fn is called outside of the shard lock, and must not be slow.
+func WithOnGet[K comparable, V any](fn func(key K, ok bool)) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.onGet = fn
+	}
+}
+
+// WithOnSet registers fn to be called for every value assigned to a key, by
+// any method, with the key, the value and whether a value was replaced. Like
+// the events of Subscribe, it's called once the shard is unlocked, and
+// values modified in place by Update, Acquire or UpdateWhere count as set.
+func WithOnSet[K comparable, V any](fn func(key K, value V, replaced bool)) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.onSet = fn
+	}
+}
+
+// WithOnDelete registers fn to be called for every value deleted, by any
+// method including Clear, with the key and true, and after the Delete and
+// DeleteHashed of absent keys with false. Expired and evicted values are
+// reported by WithOnExpire and WithOnEvict instead. Like the events of
+// Subscribe, it's called once the shard is unlocked.
+func WithOnDelete[K comparable, V any](fn func(key K, deleted bool)) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.onDelete = fn
+	}
+}
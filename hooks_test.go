@@ -0,0 +1,88 @@
+package shardmap
+
+import (
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	var gets, hits, sets, replaced, deletes, deleted int
+	m := New[int, int](0,
+		WithOnGet[int, int](func(key int, ok bool) {
+			gets++
+			if ok {
+				hits++
+			}
+		}),
+		WithOnSet(func(key, value int, ok bool) {
+			sets++
+			if ok {
+				replaced++
+			}
+		}),
+		WithOnDelete[int, int](func(key int, ok bool) {
+			deletes++
+			if ok {
+				deleted++
+			}
+		}),
+	)
+	m.Set(1, 1)
+	m.Set(1, 2)
+	m.SetWithTTL(2, 2, 0)
+	m.Get(1)
+	m.Get(3)
+	m.Delete(1)
+	m.Delete(1)
+	m.Peek(2) // not hooked
+	for _, c := range [][2]int{{gets, 2}, {hits, 1}, {sets, 3}, {replaced, 1}, {deletes, 2}, {deleted, 1}} {
+		if c[0] != c[1] {
+			t.Fatalf("expected '%v', got '%v'", c[1], c[0])
+		}
+	}
+}
+
+func TestHooksMethods(t *testing.T) {
+	var sets, replaced, deletes int
+	m := New[int, int](0,
+		WithOnSet(func(key, value int, ok bool) {
+			sets++
+			if ok {
+				replaced++
+			}
+		}),
+		WithOnDelete[int, int](func(key int, ok bool) {
+			if ok {
+				deletes++
+			}
+		}),
+	)
+	other := New[int, int](0)
+	other.Set(1, 1)
+	other.Set(100, 100)
+	for _, tc := range []struct {
+		name                    string
+		fn                      func()
+		sets, replaced, deletes int
+	}{
+		{"SetIfAbsent", func() { m.SetIfAbsent(1, 1) }, 1, 0, 0},
+		{"GetOrSet", func() { m.GetOrSet(2, 2) }, 1, 0, 0},
+		{"Replace", func() { m.Replace(2, 3) }, 1, 1, 0},
+		{"Mutate", func() { m.Mutate(3, func(int, bool) (int, bool) { return 3, true }) }, 1, 0, 0},
+		{"Update", func() { m.Update(3, func(v *int) { *v++ }) }, 1, 1, 0},
+		{"GetOrCompute", func() { m.GetOrCompute(4, func() (int, error) { return 4, nil }) }, 1, 0, 0},
+		{"UpdateWhere", func() { m.UpdateWhere(func(k, _ int) bool { return k == 4 }, func(_, v int) int { return v }) }, 1, 1, 0},
+		{"Transact", func() { m.Transact([]int{5}, func(tx *Tx[int, int]) { tx.Set(5, 5) }) }, 1, 0, 0},
+		{"Merge", func() { m.Merge(other, nil) }, 2, 1, 0},
+		{"CompareAndDelete", func() { m.CompareAndDelete(5, 5) }, 0, 0, 1},
+		{"Mutate delete", func() { m.Mutate(4, func(int, bool) (int, bool) { return 0, false }) }, 0, 0, 1},
+		{"DeleteFunc", func() { m.DeleteFunc(func(k, _ int) bool { return k == 3 }) }, 0, 0, 1},
+		{"Clear", func() { m.Clear() }, 0, 0, 3},
+	} {
+		sets, replaced, deletes = 0, 0, 0
+		tc.fn()
+		if sets != tc.sets || replaced != tc.replaced || deletes != tc.deletes {
+			t.Fatalf("%s: expected '%v %v %v', got '%v %v %v'", tc.name,
+				tc.sets, tc.replaced, tc.deletes, sets, replaced, deletes)
+		}
+	}
+}
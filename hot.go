@@ -0,0 +1,107 @@
+package shardmap
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// WithHotKeys tracks the top most accessed keys of every shard for HotKeys.
+// About one in rate accesses by Get, TryGet, Peek, Set, SetWithTTL, Delete
+// and Mutate is sampled into a Space-Saving sketch of the shard, so that the
+// tracking only costs an atomic increment on most accesses.
+func WithHotKeys[K comparable, V any](top int, rate int) Option[K, V] {
+	if top <= 0 {
+		top = 16
+	}
+	if rate <= 0 {
+		rate = 1
+	}
+	return func(m *Map[K, V]) {
+		m.hotTop, m.hotRate = top, uint32(rate)
+	}
+}
+
+// HotKey is a key along with its estimated number of accesses, see HotKeys.
+type HotKey[K comparable] struct {
+	Key   K
+	Count uint64 // accesses, overestimated by at most the sketch error
+	Shard int
+}
+
+// hotKeys is a Space-Saving sketch of the most accessed keys of a shard.
+type hotKeys[K comparable] struct {
+	ticks  uint32
+	mu     sync.Mutex
+	counts map[K]uint64
+	_      [64]byte // avoid false sharing
+}
+
+// record samples an access to key.
+func (h *hotKeys[K]) record(key K, top int, rate uint32) {
+	// the ticks are scrambled, lest periodic accesses alias with the rate
+	if rate > 1 && uint32(uint64(atomic.AddUint32(&h.ticks, 1))*0x9E3779B97F4A7C15>>32)%rate != 0 {
+		return
+	}
+	h.mu.Lock()
+	if h.counts == nil {
+		h.counts = make(map[K]uint64, top)
+	}
+	if n, ok := h.counts[key]; ok || len(h.counts) < top {
+		h.counts[key] = n + 1
+		h.mu.Unlock()
+		return
+	}
+	// the key replaces the least counted one, inheriting its count
+	var victim K
+	min := ^uint64(0)
+	for k, n := range h.counts {
+		if n < min {
+			victim, min = k, n
+		}
+	}
+	delete(h.counts, victim)
+	h.counts[key] = min + 1
+	h.mu.Unlock()
+}
+
+// recordHot samples an access to key in the sketch of its shard.
+func (m *Map[K, V]) recordHot(hash uint64, key K) {
+	m.hot[m.shardOf(hash)].record(key, m.hotTop, m.hotRate)
+}
+
+// HotKeys returns the n most accessed keys tracked by WithHotKeys across all
+// shards, the most accessed first. Counts are estimated from the samples, and
+// keys accessed less often than the hottest keys of their shard may be missed.
+// Returns nil unless the map was created with WithHotKeys.
+func (m *Map[K, V]) HotKeys(n int) []HotKey[K] {
+	m.lazyInit()
+	if m.hot == nil || n <= 0 {
+		return nil
+	}
+	var keys []HotKey[K]
+	for i := range m.hot {
+		h := &m.hot[i]
+		h.mu.Lock()
+		for key, count := range h.counts {
+			keys = append(keys, HotKey[K]{Key: key, Count: count * uint64(m.hotRate), Shard: i})
+		}
+		h.mu.Unlock()
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Count > keys[j].Count })
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
+
+// ResetHotKeys forgets the accesses tracked by WithHotKeys, to start a new
+// observation window.
+func (m *Map[K, V]) ResetHotKeys() {
+	m.lazyInit()
+	for i := range m.hot {
+		m.hot[i].mu.Lock()
+		m.hot[i].counts = nil
+		m.hot[i].mu.Unlock()
+	}
+}
@@ -0,0 +1,50 @@
+package shardmap
+
+import (
+	"testing"
+)
+
+func TestHotKeys(t *testing.T) {
+	m := New[string, int](0, WithShards[string, int](4), WithHotKeys[string, int](4, 1))
+	for i := 0; i < 10000; i++ {
+		m.Set(k(i), i)
+	}
+	for i := 0; i < 1000; i++ {
+		m.Get("7")
+		m.Get("42")
+		m.Delete("gone")
+	}
+	hot := m.HotKeys(3)
+	if len(hot) != 3 {
+		t.Fatalf("expected '%v', got '%v'", 3, len(hot))
+	}
+	for j, key := range []string{"7", "42", "gone"} {
+		var found bool
+		for _, h := range hot {
+			if h.Key == key && h.Count >= 1000 && h.Shard == m.shardOf(m.hash(key)) {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("expected '%v' in %v (%d)", key, hot, j)
+		}
+	}
+	m.ResetHotKeys()
+	if hot := m.HotKeys(3); len(hot) != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, len(hot))
+	}
+	if New[int, int](0).HotKeys(1) != nil {
+		t.Fatalf("expected no hot keys")
+	}
+}
+
+func TestHotKeysSampled(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](1), WithHotKeys[int, int](8, 10))
+	for i := 0; i < 100000; i++ {
+		m.Get(i % 1000)
+		m.Get(-1)
+	}
+	if hot := m.HotKeys(1); len(hot) != 1 || hot[0].Key != -1 {
+		t.Fatalf("expected '%v', got '%v'", -1, hot)
+	}
+}
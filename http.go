@@ -0,0 +1,112 @@
+package shardmap
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+)
+
+// Handler returns an http.Handler rendering the stats of the map as text,
+// to be mounted like net/http/pprof, e.g. under /debug/shardmap. It shows
+// the totals, the distribution of the values over the shards, and the
+// largest and the most mutated shards. When sampleKeys is true, the "keys"
+// query parameter renders that many keys picked at random.
+func (m *Map[K, V]) Handler(sampleKeys bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st := m.Stats()
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+		var total ShardStats
+		lo, hi := math.MaxInt, 0
+		for _, s := range st.Shards {
+			total.Buckets += s.Buckets
+			total.Resizes += s.Resizes
+			total.Sets += s.Sets
+			total.Deletes += s.Deletes
+			total.Evictions += s.Evictions
+			total.Expirations += s.Expirations
+			if s.Len < lo {
+				lo = s.Len
+			}
+			if s.Len > hi {
+				hi = s.Len
+			}
+		}
+		mean := float64(st.Len) / float64(len(st.Shards))
+		var variance float64
+		for _, s := range st.Shards {
+			variance += (float64(s.Len) - mean) * (float64(s.Len) - mean)
+		}
+		fmt.Fprintf(w, "len:         %d\n", st.Len)
+		fmt.Fprintf(w, "shards:      %d\n", len(st.Shards))
+		fmt.Fprintf(w, "buckets:     %d\n", total.Buckets)
+		if total.Buckets > 0 {
+			fmt.Fprintf(w, "load factor: %.3f\n", float64(st.Len)/float64(total.Buckets))
+		}
+		fmt.Fprintf(w, "resizes:     %d\n", total.Resizes)
+		fmt.Fprintf(w, "sets:        %d\n", total.Sets)
+		fmt.Fprintf(w, "deletes:     %d\n", total.Deletes)
+		fmt.Fprintf(w, "evictions:   %d\n", total.Evictions)
+		fmt.Fprintf(w, "expirations: %d\n", total.Expirations)
+		fmt.Fprintf(w, "\nshard len: min %d, mean %.1f, max %d, stddev %.1f\n",
+			lo, mean, hi, math.Sqrt(variance/float64(len(st.Shards))))
+
+		top := make([]int, len(st.Shards))
+		for i := range top {
+			top[i] = i
+		}
+		writeTop := func(title string, less func(a, b ShardStats) bool) {
+			sort.SliceStable(top, func(i, j int) bool {
+				return less(st.Shards[top[j]], st.Shards[top[i]])
+			})
+			fmt.Fprintf(w, "\n%s:\n", title)
+			for _, i := range top[:minInt(10, len(top))] {
+				s := st.Shards[i]
+				fmt.Fprintf(w, "  shard %d: len %d, buckets %d, sets %d, deletes %d, evictions %d, expirations %d\n",
+					i, s.Len, s.Buckets, s.Sets, s.Deletes, s.Evictions, s.Expirations)
+			}
+		}
+		writeTop("largest shards", func(a, b ShardStats) bool {
+			return a.Len < b.Len
+		})
+		writeTop("hottest shards", func(a, b ShardStats) bool {
+			return a.Sets+a.Deletes+a.Evictions+a.Expirations < b.Sets+b.Deletes+b.Evictions+b.Expirations
+		})
+
+		if n, _ := strconv.Atoi(r.URL.Query().Get("keys")); sampleKeys && n > 0 {
+			fmt.Fprintf(w, "\nkeys:\n")
+			for _, key := range m.sampleKeys(n) {
+				fmt.Fprintf(w, "  %v\n", key)
+			}
+		}
+	})
+}
+
+// sampleKeys returns up to n keys picked at random, one per shard visited.
+func (m *Map[K, V]) sampleKeys(n int) []K {
+	var keys []K
+	start := int(wyhash_Uint64())
+	for i := 0; i < len(m.mus) && len(keys) < n; i++ {
+		shard := (start + i) & (len(m.mus) - 1)
+		if atomic.LoadUint32(&m.debug) != 0 {
+			m.debugLock(shard, false)
+		}
+		m.mus[shard].RLock()
+		key, _, ok := m.shards[shard].GetPos(wyhash_Uint64())
+		m.mus[shard].RUnlock()
+		if ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
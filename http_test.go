@@ -0,0 +1,25 @@
+package shardmap
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	m := New[string, int](0, WithShards[string, int](4))
+	for i := 0; i < 100; i++ {
+		m.Set(k(i), i)
+	}
+	for _, sample := range []bool{false, true} {
+		rec := httptest.NewRecorder()
+		m.Handler(sample).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/shardmap?keys=2", nil))
+		body := rec.Body.String()
+		if !strings.Contains(body, "len:         100\n") || !strings.Contains(body, "hottest shards:") {
+			t.Fatalf("unexpected body %q", body)
+		}
+		if strings.Contains(body, "keys:") != sample {
+			t.Fatalf("expected keys only when sampled, got %q", body)
+		}
+	}
+}
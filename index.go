@@ -0,0 +1,45 @@
+package shardmap
+
+import (
+	"sync/atomic"
+)
+
+// WithIndex registers a secondary index of the values of the map, which fn
+// maps to their index key. The index is updated under the shard lock of every
+// mutation, so it's always consistent with the map; see GetByIndex.
+func WithIndex[K comparable, V any](name string, fn func(value V) string) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.indexes = append(m.indexes, name)
+		m.indexFns = append(m.indexFns, fn)
+	}
+}
+
+// GetByIndex returns the key/values whose values have the index key ik in the
+// index name registered with WithIndex, in no particular order. Shards are
+// looked up one at a time.
+func (m *Map[K, V]) GetByIndex(name string, ik string) (entries []Entry[K, V]) {
+	m.lazyInit()
+	j := -1
+	for i := range m.indexes {
+		if m.indexes[i] == name {
+			j = i
+		}
+	}
+	if j < 0 {
+		return nil
+	}
+	for i := 0; i < len(m.mus); i++ {
+		if atomic.LoadUint32(&m.debug) != 0 {
+			m.debugLock(i, false)
+		}
+		m.mus[i].RLock()
+		s := &m.shards[i]
+		for key := range s.indexes[j][ik] {
+			if value, ok := s.Get(m.hash(key), key, false); ok {
+				entries = append(entries, Entry[K, V]{key, value})
+			}
+		}
+		m.mus[i].RUnlock()
+	}
+	return entries
+}
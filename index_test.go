@@ -0,0 +1,48 @@
+package shardmap
+
+import (
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	type session struct {
+		Device string
+		User   string
+	}
+	m := New[int, session](0,
+		WithIndex[int, session]("device", func(s session) string { return s.Device }),
+		WithIndex[int, session]("user", func(s session) string { return s.User }))
+	m.SetDebugLevel(DebugVerify)
+	for i := 0; i < 1000; i++ {
+		m.Set(i, session{Device: k(i % 100), User: k(i % 7)})
+	}
+	if e := m.GetByIndex("device", k(42)); len(e) != 10 {
+		t.Fatalf("expected '%v', got '%v'", 10, len(e))
+	}
+	m.Set(42, session{Device: "moved", User: k(0)})
+	m.Delete(142)
+	m.Replace(242, session{Device: "moved"})
+	if e := m.GetByIndex("device", k(42)); len(e) != 7 {
+		t.Fatalf("expected '%v', got '%v'", 7, len(e))
+	}
+	if e := m.GetByIndex("device", "moved"); len(e) != 2 {
+		t.Fatalf("expected '%v', got '%v'", 2, len(e))
+	}
+	m.DeleteFunc(func(key int, s session) bool { return s.Device == "moved" })
+	if e := m.GetByIndex("device", "moved"); len(e) != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, len(e))
+	}
+	c := m.Clone()
+	m.Clear()
+	if e := m.GetByIndex("user", k(3)); len(e) != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, len(e))
+	}
+	for _, e := range c.GetByIndex("user", k(3)) {
+		if e.Value.User != k(3) {
+			t.Fatalf("expected '%v', got '%v'", k(3), e.Value.User)
+		}
+	}
+	if e := c.GetByIndex("nope", ""); e != nil {
+		t.Fatalf("expected no index")
+	}
+}
@@ -0,0 +1,24 @@
+package shardmap
+
+import (
+	"unsafe"
+)
+
+// WithInterning makes the map intern its string keys as they are added, so
+// that equal keys stored by many maps, or by other structures interning
+// their strings likewise, share the same bytes instead of duplicating them.
+// Strings are interned with unique.Make since Go 1.23, and by a small
+// process-wide cache before, which only deduplicates recent keys. It has no
+// effect when K is not a string.
+func WithInterning[K comparable, V any]() Option[K, V] {
+	return func(m *Map[K, V]) {
+		var k K
+		if _, ok := any(k).(string); !ok {
+			return
+		}
+		m.intern = func(key K) K {
+			s := internString(*(*string)(unsafe.Pointer(&key)))
+			return *(*K)(unsafe.Pointer(&s))
+		}
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !go1.23
+
+package shardmap
+
+import (
+	"sync"
+)
+
+// interned is a direct-mapped cache of recently interned strings, bounded so
+// that strings no longer used are not retained forever.
+var interned struct {
+	sync.Mutex
+	strings [4096]string
+}
+
+// internString returns the copy of s in the cache if any, or caches s.
+func internString(s string) string {
+	i := wyhash_HashString(s, 0) & uint64(len(interned.strings)-1)
+	interned.Lock()
+	defer interned.Unlock()
+	if interned.strings[i] == s {
+		return interned.strings[i]
+	}
+	interned.strings[i] = s
+	return s
+}
@@ -0,0 +1,12 @@
+//go:build go1.23
+
+package shardmap
+
+import (
+	"unique"
+)
+
+// internString returns the canonical copy of s.
+func internString(s string) string {
+	return unique.Make(s).Value()
+}
@@ -0,0 +1,44 @@
+//go:build go1.23
+
+package shardmap
+
+import (
+	"strconv"
+	"testing"
+	"unsafe"
+)
+
+func TestInterning(t *testing.T) {
+	a := New[string, int](0, WithInterning[string, int]())
+	b := New[string, int](0, WithInterning[string, int]())
+	for i := 0; i < 100; i++ {
+		a.Set(strconv.Itoa(i), i)
+		b.Set(strconv.Itoa(i), -i)
+	}
+	b.Set("1", 1) // replaced
+	data := func(m *Map[string, int], key string) (p uintptr) {
+		m.Range(func(k string, _ int) bool {
+			if k == key {
+				p = *(*uintptr)(unsafe.Pointer(&k))
+				return false
+			}
+			return true
+		})
+		return p
+	}
+	for _, key := range []string{"0", "1", "99"} {
+		if pa, pb := data(a, key), data(b, key); pa == 0 || pa != pb {
+			t.Fatalf("expected the keys '%v' to share their bytes", key)
+		}
+	}
+	if v, ok := b.Get("1"); !ok || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+
+	// not strings
+	m := New[int, int](0, WithInterning[int, int]())
+	m.Set(1, 1)
+	if m.intern != nil {
+		t.Fatalf("expected no interning of int keys")
+	}
+}
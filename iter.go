@@ -0,0 +1,40 @@
+//go:build go1.23
+
+package shardmap
+
+import "iter"
+
+// All returns an iterator over all key/values, see Range.
+// It's not safe to call Set or Delete while ranging.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return m.Range
+}
+
+// Keys returns an iterator over all keys, see Range.
+// It's not safe to call Set or Delete while ranging.
+func (m *Map[K, V]) Keys() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		m.Range(func(key K, _ V) bool {
+			return yield(key)
+		})
+	}
+}
+
+// Values returns an iterator over all values, see Range.
+// It's not safe to call Set or Delete while ranging.
+func (m *Map[K, V]) Values() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		m.Range(func(_ K, value V) bool {
+			return yield(value)
+		})
+	}
+}
+
+// Changes returns an iterator over the logged changes following since, see
+// RangeChanges. It yields nothing when some of them were lost, which
+// RangeChanges tells apart.
+func (m *Map[K, V]) Changes(since uint64) iter.Seq[Change[K, V]] {
+	return func(yield func(Change[K, V]) bool) {
+		m.RangeChanges(since, yield)
+	}
+}
@@ -0,0 +1,57 @@
+//go:build go1.23
+
+package shardmap
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestIter(t *testing.T) {
+	m := New[int, int](0)
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i*2)
+	}
+	var n int
+	for k, v := range m.All() {
+		if v != k*2 {
+			t.Fatalf("expected '%v', got '%v'", k*2, v)
+		}
+		n++
+	}
+	if n != 1000 {
+		t.Fatalf("expected '%v', got '%v'", 1000, n)
+	}
+	for range m.All() {
+		n--
+		break
+	}
+	if n != 999 {
+		t.Fatalf("expected '%v', got '%v'", 999, n)
+	}
+	keys := slices.Sorted(m.Keys())
+	if len(keys) != 1000 || keys[0] != 0 || keys[999] != 999 {
+		t.Fatalf("expected '%v', got '%v'", 1000, len(keys))
+	}
+	values := slices.Sorted(m.Values())
+	if len(values) != 1000 || values[0] != 0 || values[999] != 1998 {
+		t.Fatalf("expected '%v', got '%v'", 1000, len(values))
+	}
+	if mm := maps.Collect(m.All()); len(mm) != 1000 || mm[10] != 20 {
+		t.Fatalf("expected '%v', got '%v'", 1000, len(mm))
+	}
+}
+
+func TestChanges(t *testing.T) {
+	m := New[int, int](0, WithChangeLog[int, int](100))
+	m.Set(1, 1)
+	m.Delete(1)
+	var seqs []uint64
+	for c := range m.Changes(0) {
+		seqs = append(seqs, c.Seq)
+	}
+	if !slices.Equal(seqs, []uint64{1, 2}) {
+		t.Fatalf("expected '%v', got '%v'", []uint64{1, 2}, seqs)
+	}
+}
@@ -0,0 +1,141 @@
+package shardmap
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// MarshalJSON implements json.Marshaler, the map is encoded as a JSON object
+// following the rules of encoding/json for Go maps.
+func (m *Map[K, V]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.ToMap())
+}
+
+// UnmarshalJSON implements json.Unmarshaler, the key/values of a JSON object
+// are added to the map, following the rules of encoding/json for Go maps, so
+// the last of duplicate keys wins. Decoded entries are handed to concurrent
+// writers in batches, each writer taking the keys of a range of hashes, without
+// building an intermediate Go map. A write panicking, as on a closed map, is
+// returned as an error.
+func (m *Map[K, V]) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	m.lazyInit()
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf("shardmap: cannot unmarshal %v into %T", tok, m)
+	}
+
+	const batchSize = 1024
+	workers := runtime.GOMAXPROCS(0)
+	batches := make([]chan []entry[K, V], workers)
+	var failed error
+	var once sync.Once
+	var wg sync.WaitGroup
+	for i := range batches {
+		batches[i] = make(chan []entry[K, V])
+		wg.Add(1)
+		go func(in <-chan []entry[K, V]) {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					once.Do(func() { failed = panicError(r) })
+					for range in {
+						// drained so that the decoder is not blocked
+					}
+				}
+			}()
+			for batch := range in {
+				for _, e := range batch {
+					m.SetHashed(e.hdib, e.key, e.value)
+				}
+			}
+		}(batches[i])
+	}
+
+	err := func() error {
+		pending := make([][]entry[K, V], workers)
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			var e entry[K, V]
+			if err = unmarshalKey(tok.(string), &e.key); err != nil {
+				return err
+			}
+			if err = dec.Decode(&e.value); err != nil {
+				return err
+			}
+			// the entries of a key go to the same worker, in order, and
+			// hdib holds the whole hash of the key until it's set
+			e.hdib = m.hash(e.key)
+			w := int((e.hdib >> dibBitSize) % uint64(workers))
+			if pending[w] = append(pending[w], e); len(pending[w]) == batchSize {
+				batches[w] <- pending[w]
+				pending[w] = nil
+			}
+		}
+		for w, batch := range pending {
+			if len(batch) > 0 {
+				batches[w] <- batch
+			}
+		}
+		_, err := dec.Token()
+		return err
+	}()
+	for _, c := range batches {
+		close(c)
+	}
+	wg.Wait()
+
+	if err == nil {
+		err = failed
+	}
+	return err
+}
+
+// panicError returns the value of a recovered panic as an error.
+func panicError(r any) error {
+	if err, ok := r.(error); ok {
+		return err
+	}
+	return fmt.Errorf("shardmap: %v", r)
+}
+
+// unmarshalKey decodes a JSON object key into key, like encoding/json.
+func unmarshalKey[K comparable](s string, key *K) error {
+	if p, ok := any(key).(encoding.TextUnmarshaler); ok {
+		return p.UnmarshalText([]byte(s))
+	}
+	v := reflect.ValueOf(key).Elem()
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("shardmap: cannot unmarshal key %q into %v: %w", s, v.Type(), err)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("shardmap: cannot unmarshal key %q into %v: %w", s, v.Type(), err)
+		}
+		v.SetUint(n)
+	default:
+		return fmt.Errorf("shardmap: unsupported key type %v", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package shardmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	m := New[int, string](0)
+	m.Set(1, "a")
+	m.Set(2, "b")
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"1":"a","2":"b"}` {
+		t.Fatalf("expected '%v', got '%v'", `{"1":"a","2":"b"}`, string(data))
+	}
+
+	var v struct {
+		M Map[int, string]
+		P *Map[string, int]
+	}
+	if err = json.Unmarshal([]byte(`{"M":{"1":"a","2":"b"},"P":{"x":1}}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := v.M.Get(2); v.M.Len() != 2 || s != "b" {
+		t.Fatalf("expected '%v', got '%v'", "b", s)
+	}
+	if n, _ := v.P.Get("x"); v.P.Len() != 1 || n != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, n)
+	}
+
+	big := New[int, int](0)
+	for i := 0; i < 10000; i++ {
+		big.Set(i, i)
+	}
+	if data, err = json.Marshal(big); err != nil {
+		t.Fatal(err)
+	}
+	m2 := New[int, int](0)
+	if err = json.Unmarshal(data, m2); err != nil {
+		t.Fatal(err)
+	}
+	if m2.Len() != 10000 {
+		t.Fatalf("expected '%v', got '%v'", 10000, m2.Len())
+	}
+
+	if err = json.Unmarshal([]byte(`{"x":1}`), m2); err == nil {
+		t.Fatal("expected error")
+	}
+	if err = json.Unmarshal([]byte(`[1]`), m2); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestJSONDuplicates(t *testing.T) {
+	// like encoding/json, the last of duplicate keys wins
+	var b strings.Builder
+	b.WriteString("{")
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&b, `"%d":%d,`, i%10, i)
+	}
+	b.WriteString(`"0":-1}`)
+	m := New[int, int](0)
+	if err := json.Unmarshal([]byte(b.String()), m); err != nil {
+		t.Fatal(err)
+	}
+	for key := 0; key < 10; key++ {
+		want := 4990 + key
+		if key == 0 {
+			want = -1
+		}
+		if v, _ := m.Get(key); v != want {
+			t.Fatalf("expected '%v', got '%v'", want, v)
+		}
+	}
+
+	// writing a closed map fails instead of crashing
+	m.Close()
+	if err := json.Unmarshal([]byte(b.String()), m); err != ErrClosed {
+		t.Fatalf("expected '%v', got '%v'", ErrClosed, err)
+	}
+}
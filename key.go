@@ -0,0 +1,21 @@
+package shardmap
+
+// Key2 is a tuple key of two comparable values, to key a map by several
+// values without concatenating them into a string, e.g.
+//
+//	m := New[Key2[uint64, uint32], V](0)
+//	m.Set(Key2[uint64, uint32]{id, shard}, v)
+//
+// Struct keys are hashed by field, skipping their padding, so any struct of
+// comparable fields may be used the same way.
+type Key2[A, B comparable] struct {
+	A A
+	B B
+}
+
+// Key3 is a tuple key of three comparable values, see Key2.
+type Key3[A, B, C comparable] struct {
+	A A
+	B B
+	C C
+}
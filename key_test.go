@@ -0,0 +1,30 @@
+package shardmap
+
+import (
+	"testing"
+)
+
+func TestKey2(t *testing.T) {
+	m := New[Key2[uint64, uint32], int](0)
+	m.SetDebugLevel(DebugVerify)
+	for i := 0; i < 1000; i++ {
+		m.Set(Key2[uint64, uint32]{uint64(i), uint32(i % 7)}, i)
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := m.Get(Key2[uint64, uint32]{uint64(i), uint32(i % 7)}); !ok || v != i {
+			t.Fatalf("expected '%v', got '%v'", i, v)
+		}
+	}
+	n := New[Key3[string, int8, int64], int](0)
+	n.Set(Key3[string, int8, int64]{"a", 1, 2}, 1)
+	if v, ok := n.Get(Key3[string, int8, int64]{string([]byte("a")), 1, 2}); !ok || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+	m.SetDebugLevel(DebugOff)
+	if allocs := testing.AllocsPerRun(100, func() {
+		m.Get(Key2[uint64, uint32]{1, 1})
+		n.Get(Key3[string, int8, int64]{"a", 1, 2})
+	}); allocs != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, allocs)
+	}
+}
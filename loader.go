@@ -0,0 +1,151 @@
+package shardmap
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Loader is a loading cache. Values are loaded on a miss by a user function,
+// and values older than a refresh interval are returned immediately while
+// being reloaded in the background by a bounded pool of workers.
+type Loader[K comparable, V any] struct {
+	m       *Map[K, loaded[V]]
+	load    func(key K) (V, error)
+	refresh int64
+	pending *Map[K, struct{}] // keys queued or being reloaded
+	queue   chan K
+	done    chan struct{}
+	closing sync.Once
+	wg      sync.WaitGroup
+	gen     uint64 // of the last assigned value
+}
+
+// loaded is a value along with the clock nanoseconds it was loaded at, and a
+// generation telling it from the values assigned to the key later.
+type loaded[V any] struct {
+	value V
+	at    int64
+	gen   uint64
+}
+
+// NewLoader returns a new loading cache with the specified capacity, which
+// reloads values older than refresh with at most workers concurrent calls of
+// load. A refresh <= 0 means values are never reloaded.
+func NewLoader[K comparable, V any](cap int, refresh time.Duration, workers int, load func(key K) (V, error)) *Loader[K, V] {
+	if workers <= 0 {
+		workers = 1
+	}
+	l := &Loader[K, V]{
+		m:       New[K, loaded[V]](cap),
+		load:    load,
+		refresh: int64(refresh),
+		pending: New[K, struct{}](0),
+		queue:   make(chan K, workers),
+		done:    make(chan struct{}),
+	}
+	if refresh > 0 {
+		l.wg.Add(workers)
+		for i := 0; i < workers; i++ {
+			go l.worker()
+		}
+	}
+	return l
+}
+
+// Get returns the value for a key, loading it when the key is absent.
+// Concurrent loads of the same key are deduplicated like GetOrCompute. A
+// stale value is returned as is and reloaded in the background, unless all
+// workers are busy in which case a later Get reloads it.
+// Returns the error of load, nothing is assigned then.
+func (l *Loader[K, V]) Get(key K) (V, error) {
+	e, err := l.m.GetOrCompute(key, func() (loaded[V], error) {
+		value, err := l.load(key)
+		return l.loaded(value), err
+	})
+	if err != nil {
+		var zero V
+		return zero, err
+	}
+	if l.refresh > 0 && clock()-e.at > l.refresh {
+		l.schedule(key)
+	}
+	return e.value, nil
+}
+
+// Set assigns a value to a key, as if it was just loaded.
+func (l *Loader[K, V]) Set(key K, value V) {
+	l.m.Set(key, l.loaded(value))
+}
+
+// loaded returns value as just loaded, with a new generation.
+func (l *Loader[K, V]) loaded(value V) loaded[V] {
+	return loaded[V]{value, clock(), atomic.AddUint64(&l.gen, 1)}
+}
+
+// Invalidate deletes the value for a key, so the next Get loads it again.
+func (l *Loader[K, V]) Invalidate(key K) {
+	l.m.Delete(key)
+}
+
+// Len returns the number of values in the cache.
+func (l *Loader[K, V]) Len() int {
+	return l.m.Len()
+}
+
+// Close stops the workers, waiting for the reloads in progress, then closes
+// the underlying map.
+func (l *Loader[K, V]) Close() error {
+	err := ErrClosed
+	l.closing.Do(func() {
+		close(l.done)
+		l.wg.Wait()
+		err = l.m.Close()
+	})
+	return err
+}
+
+// schedule queues a reload of key, unless it is already queued or the
+// workers are busy.
+func (l *Loader[K, V]) schedule(key K) {
+	if !l.pending.SetIfAbsent(key, struct{}{}) {
+		return
+	}
+	select {
+	case l.queue <- key:
+	default:
+		l.pending.Delete(key)
+	}
+}
+
+func (l *Loader[K, V]) worker() {
+	defer l.wg.Done()
+	for {
+		select {
+		case <-l.done:
+			return
+		case key := <-l.queue:
+			l.reload(key)
+			l.pending.Delete(key)
+		}
+	}
+}
+
+// reload loads the value of key again, and assigns it unless the key was
+// set or invalidated meanwhile. A failed reload keeps the stale value, to
+// retry later.
+func (l *Loader[K, V]) reload(key K) {
+	e, ok := l.m.Peek(key)
+	if !ok {
+		return
+	}
+	value, err := l.load(key)
+	if err != nil {
+		return
+	}
+	l.m.Update(key, func(cur *loaded[V]) {
+		if cur.gen == e.gen {
+			*cur = l.loaded(value)
+		}
+	})
+}
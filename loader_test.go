@@ -0,0 +1,100 @@
+package shardmap
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoader(t *testing.T) {
+	var loads int64
+	l := NewLoader[string, int64](0, 50*time.Millisecond, 2, func(key string) (int64, error) {
+		return atomic.AddInt64(&loads, 1), nil
+	})
+	defer l.Close()
+	if v, err := l.Get("hello"); v != 1 || err != nil {
+		t.Fatalf("expected '%v', got '%v' '%v'", 1, v, err)
+	}
+	if v, _ := l.Get("hello"); v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+	time.Sleep(60 * time.Millisecond)
+	// the stale value is returned while it's reloaded
+	if v, _ := l.Get("hello"); v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+	for i := 0; i < 100; i++ {
+		if v, _ := l.Get("hello"); v == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if v, _ := l.Get("hello"); v != 2 {
+		t.Fatalf("expected '%v', got '%v'", 2, v)
+	}
+	l.Invalidate("hello")
+	if v, _ := l.Get("hello"); v != 3 {
+		t.Fatalf("expected '%v', got '%v'", 3, v)
+	}
+	if l.Len() != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, l.Len())
+	}
+}
+
+func TestLoaderReloadRace(t *testing.T) {
+	var loads int64
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	l := NewLoader[string, int64](0, time.Millisecond, 1, func(key string) (int64, error) {
+		if n := atomic.AddInt64(&loads, 1); n > 1 {
+			started <- struct{}{}
+			<-release
+			return n, nil
+		}
+		return 1, nil
+	})
+	defer l.Close()
+	reload := func(during func()) {
+		t.Helper()
+		time.Sleep(5 * time.Millisecond)
+		l.Get("hello") // schedules a reload
+		<-started
+		during()
+		release <- struct{}{}
+		for i := 0; i < 100 && l.pending.Len() != 0; i++ {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	l.Get("hello")
+	// a value set during a reload is kept
+	reload(func() { l.Set("hello", 100) })
+	if v, _ := l.m.Peek("hello"); v.value != 100 {
+		t.Fatalf("expected '%v', got '%v'", 100, v.value)
+	}
+	// a key invalidated during a reload stays absent
+	reload(func() { l.Invalidate("hello") })
+	if l.Len() != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, l.Len())
+	}
+}
+
+func TestLoaderCloseConcurrent(t *testing.T) {
+	l := NewLoader[string, int](0, time.Hour, 2, func(key string) (int, error) { return 0, nil })
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() { errs <- l.Close() }()
+	}
+	var closed int
+	for i := 0; i < cap(errs); i++ {
+		switch err := <-errs; err {
+		case nil:
+			closed++
+		case ErrClosed:
+		default:
+			t.Fatalf("unexpected error '%v'", err)
+		}
+	}
+	if closed != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, closed)
+	}
+}
@@ -0,0 +1,252 @@
+package shardmap
+
+import (
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// LockFreeMap is a hashmap whose operations never wait on each other: buckets
+// are chains of immutable nodes swapped with compare-and-swap, so Get is a few
+// atomic loads and Set retries only when it raced with another write to the
+// same bucket. When the table doubles, the goroutine resizing it migrates the
+// buckets while others keep going, helping to migrate the buckets they need.
+//
+// Replaced nodes are reclaimed by the garbage collector once no reader holds
+// them, which takes the place of the epochs or hazard pointers of lock-free
+// tables in languages without one.
+//
+// The zero value is not safe for use; use NewLockFree.
+type LockFreeMap[K comparable, V any] struct {
+	table unsafe.Pointer // *lfTable[K, V], the newest table
+	count int64
+	keys  keyHash[K]
+	seed  uint64
+	mu    sync.Mutex // held by the goroutine resizing
+}
+
+// lfTable is a table of buckets, which may still be migrating from prev.
+type lfTable[K comparable, V any] struct {
+	buckets []unsafe.Pointer // *lfNode[K, V]
+	mask    uint64
+	prev    unsafe.Pointer // *lfTable[K, V], nil once migrated
+	pending *lfNode[K, V]  // bucket not migrated yet
+}
+
+// lfNode is an immutable key/value of a chain. A frozen node heads the chain
+// of a bucket which is being migrated, which can't be written anymore.
+type lfNode[K comparable, V any] struct {
+	hash   uint64
+	key    K
+	value  V
+	next   *lfNode[K, V]
+	frozen bool
+}
+
+// NewLockFree returns a new lock-free hashmap with the specified capacity.
+func NewLockFree[K comparable, V any](cap int) *LockFreeMap[K, V] {
+	n := 8
+	for n < cap {
+		n *= 2
+	}
+	m := &LockFreeMap[K, V]{seed: new(maphash.Hash).Sum64()}
+	m.keys.init()
+	t := &lfTable[K, V]{buckets: make([]unsafe.Pointer, n), mask: uint64(n - 1)}
+	m.table = unsafe.Pointer(t)
+	return m
+}
+
+func (m *LockFreeMap[K, V]) load() *lfTable[K, V] {
+	return (*lfTable[K, V])(atomic.LoadPointer(&m.table))
+}
+
+func (t *lfTable[K, V]) load(i uint64) *lfNode[K, V] {
+	return (*lfNode[K, V])(atomic.LoadPointer(&t.buckets[i]))
+}
+
+func (t *lfTable[K, V]) cas(i uint64, old, new *lfNode[K, V]) bool {
+	return atomic.CompareAndSwapPointer(&t.buckets[i], unsafe.Pointer(old), unsafe.Pointer(new))
+}
+
+func (t *lfTable[K, V]) prevTable() *lfTable[K, V] {
+	return (*lfTable[K, V])(atomic.LoadPointer(&t.prev))
+}
+
+// chain returns the chain of key/values of bucket i, reading it from the
+// previous table while it's not migrated.
+func (t *lfTable[K, V]) chain(i uint64) *lfNode[K, V] {
+	for {
+		head := t.load(i)
+		if t.pending == nil || head != t.pending {
+			if head != nil && head.frozen {
+				head = head.next
+			}
+			return head
+		}
+		if prev := t.prevTable(); prev != nil {
+			return prev.chain(i & prev.mask)
+		}
+		// migrated meanwhile
+	}
+}
+
+// Get returns a value for a key.
+// Returns false when no value has been assign for key.
+func (m *LockFreeMap[K, V]) Get(key K) (value V, ok bool) {
+	hash := m.keys.hash(key, m.seed)
+	t := m.load()
+	for n := t.chain(hash & t.mask); n != nil; n = n.next {
+		if n.hash == hash && n.key == key {
+			return n.value, true
+		}
+	}
+	return value, false
+}
+
+// Set assigns a value to a key.
+// Returns the previous value, or false when no value was assigned.
+func (m *LockFreeMap[K, V]) Set(key K, value V) (prev V, replaced bool) {
+	hash := m.keys.hash(key, m.seed)
+	for {
+		t, i, head := m.bucket(hash)
+		if head != nil && head.frozen {
+			continue
+		}
+		rest, old, found := without(head, hash, key)
+		if t.cas(i, head, &lfNode[K, V]{hash: hash, key: key, value: value, next: rest}) {
+			if !found {
+				m.grow(atomic.AddInt64(&m.count, 1))
+			}
+			return old, found
+		}
+	}
+}
+
+// Delete deletes a value for a key.
+// Returns the deleted value, or false when no value was assigned.
+func (m *LockFreeMap[K, V]) Delete(key K) (prev V, deleted bool) {
+	hash := m.keys.hash(key, m.seed)
+	for {
+		t, i, head := m.bucket(hash)
+		if head != nil && head.frozen {
+			continue
+		}
+		rest, old, found := without(head, hash, key)
+		if !found {
+			return prev, false
+		}
+		if t.cas(i, head, rest) {
+			atomic.AddInt64(&m.count, -1)
+			return old, true
+		}
+	}
+}
+
+// Len returns the number of values in map.
+func (m *LockFreeMap[K, V]) Len() int {
+	return int(atomic.LoadInt64(&m.count))
+}
+
+// Range iterates over all key/values, bucket by bucket. Each bucket is read
+// at once, so writes made while ranging may or may not be observed.
+func (m *LockFreeMap[K, V]) Range(iter func(key K, value V) bool) {
+	t := m.load()
+	for i := uint64(0); i <= t.mask; i++ {
+		for n := t.chain(i); n != nil; n = n.next {
+			// the chain of a previous table is shared by several buckets
+			if n.hash&t.mask == i && !iter(n.key, n.value) {
+				return
+			}
+		}
+	}
+}
+
+// bucket returns the newest table, the bucket of hash in it and its chain,
+// migrating the bucket first if needed. A frozen chain means that a newer
+// table was published meanwhile.
+func (m *LockFreeMap[K, V]) bucket(hash uint64) (*lfTable[K, V], uint64, *lfNode[K, V]) {
+	t := m.load()
+	i := hash & t.mask
+	head := t.load(i)
+	for head != nil && head == t.pending {
+		t.migrate(i)
+		head = t.load(i)
+	}
+	return t, i, head
+}
+
+// without returns the chain of head without key, copying the nodes before
+// it, along with the value of key.
+func without[K comparable, V any](head *lfNode[K, V], hash uint64, key K) (rest *lfNode[K, V], value V, found bool) {
+	for n := head; n != nil; n = n.next {
+		if n.hash == hash && n.key == key {
+			rest = n.next
+			for p := head; p != n; p = p.next {
+				rest = &lfNode[K, V]{hash: p.hash, key: p.key, value: p.value, next: rest}
+			}
+			return rest, n.value, true
+		}
+	}
+	return head, value, false
+}
+
+// grow doubles the table once it holds more values than buckets, unless
+// another goroutine is already resizing it.
+func (m *LockFreeMap[K, V]) grow(count int64) {
+	if count <= int64(len(m.load().buckets)) || !m.mu.TryLock() {
+		return
+	}
+	defer m.mu.Unlock()
+	t := m.load()
+	if atomic.LoadInt64(&m.count) <= int64(len(t.buckets)) {
+		return
+	}
+	n := len(t.buckets) * 2
+	nt := &lfTable[K, V]{buckets: make([]unsafe.Pointer, n), mask: uint64(n - 1), pending: &lfNode[K, V]{}}
+	for i := range nt.buckets {
+		nt.buckets[i] = unsafe.Pointer(nt.pending)
+	}
+	nt.prev = unsafe.Pointer(t)
+	atomic.StorePointer(&m.table, unsafe.Pointer(nt))
+	for i := uint64(0); i <= nt.mask; i++ {
+		if nt.load(i) == nt.pending {
+			nt.migrate(i)
+		}
+	}
+	atomic.StorePointer(&nt.prev, nil)
+}
+
+// migrate freezes the bucket of the previous table which bucket i comes from,
+// then fills the buckets of t which come from it, unless another goroutine did.
+func (t *lfTable[K, V]) migrate(i uint64) {
+	prev := t.prevTable()
+	if prev == nil {
+		return
+	}
+	j := i & prev.mask
+	var chain *lfNode[K, V]
+	for {
+		head := prev.load(j)
+		if head != nil && head.frozen {
+			chain = head.next
+			break
+		}
+		if prev.cas(j, head, &lfNode[K, V]{next: head, frozen: true}) {
+			chain = head
+			break
+		}
+	}
+	for nb := j; nb <= t.mask; nb += prev.mask + 1 {
+		if t.load(nb) != t.pending {
+			continue
+		}
+		var split *lfNode[K, V]
+		for n := chain; n != nil; n = n.next {
+			if n.hash&t.mask == nb {
+				split = &lfNode[K, V]{hash: n.hash, key: n.key, value: n.value, next: split}
+			}
+		}
+		t.cas(nb, t.pending, split)
+	}
+}
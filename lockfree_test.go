@@ -0,0 +1,66 @@
+package shardmap
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestLockFreeMap(t *testing.T) {
+	m := NewLockFree[string, int](0)
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < 20000; i += 8 {
+				if _, replaced := m.Set(k(i), i); replaced {
+					t.Errorf("expected '%v' to be new", k(i))
+				}
+				if v, ok := m.Get(k(i)); !ok || v != i {
+					t.Errorf("expected '%v', got '%v'", i, v)
+				}
+				if i%2 == 0 {
+					if v, deleted := m.Delete(k(i)); !deleted || v != i {
+						t.Errorf("expected '%v', got '%v'", i, v)
+					}
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if n := m.Len(); n != 10000 {
+		t.Fatalf("expected '%v', got '%v'", 10000, n)
+	}
+	var n int
+	m.Range(func(key string, value int) bool {
+		if key != k(value) || value%2 == 0 {
+			t.Fatalf("unexpected '%v' '%v'", key, value)
+		}
+		n++
+		return true
+	})
+	if n != 10000 {
+		t.Fatalf("expected '%v', got '%v'", 10000, n)
+	}
+	if prev, replaced := m.Set(k(1), -1); !replaced || prev != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, prev)
+	}
+	if _, ok := m.Get(k(2)); ok {
+		t.Fatalf("expected '%v' to be deleted", k(2))
+	}
+}
+
+func BenchmarkLockFreeGet(b *testing.B) {
+	m := NewLockFree[int, int](0)
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			m.Get(i % 1000)
+			i++
+		}
+	})
+}
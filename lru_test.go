@@ -0,0 +1,123 @@
+package shardmap
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLRU(t *testing.T) {
+	const n = 10000
+	m := New[int, int](0, WithLRU[int, int](n))
+	m.SetDebugLevel(DebugVerify)
+	for i := 0; i < n*2; i++ {
+		m.Set(i, i)
+		if i%10 == 0 {
+			// keep the first keys hot
+			for j := 0; j < 10; j++ {
+				m.Get(j)
+			}
+		}
+	}
+	if l := m.Len(); l > n+len(m.mus) || l < n/2 {
+		t.Fatalf("expected about '%v', got '%v'", n, l)
+	}
+	for j := 0; j < 10; j++ {
+		if _, ok := m.Get(j); !ok {
+			t.Fatalf("expected hot key %v to be kept", j)
+		}
+	}
+	var old int
+	for i := 0; i < n/2; i++ {
+		if _, ok := m.Peek(i + 10); ok {
+			old++
+		}
+	}
+	if old > n/10 {
+		t.Fatalf("expected most old keys to be evicted, got %v", old)
+	}
+}
+
+func TestMaxCost(t *testing.T) {
+	const budget = 1 << 20
+	m := New[int, []byte](0, WithMaxCost[int, []byte](budget, func(key int, value []byte) int64 {
+		return int64(len(value))
+	}))
+	m.SetDebugLevel(DebugVerify)
+	for i := 0; i < 20000; i++ {
+		m.Set(i, make([]byte, 256))
+	}
+	var total int64
+	m.Range(func(key int, value []byte) bool {
+		total += int64(len(value))
+		return true
+	})
+	if total > budget+int64(len(m.mus))*256 || total < budget/2 {
+		t.Fatalf("expected about '%v', got '%v'", budget, total)
+	}
+	// growing a value counts against the budget
+	n := m.Len()
+	for i := 0; i < 20000; i++ {
+		if _, ok := m.Replace(i, make([]byte, 4096)); ok {
+			break
+		}
+	}
+	if l := m.Len(); l >= n {
+		t.Fatalf("expected less than '%v', got '%v'", n, l)
+	}
+}
+
+func TestOnEvict(t *testing.T) {
+	var mu sync.Mutex
+	reasons := make(map[EvictReason]int)
+	m := New[int, int](0, WithLRU[int, int](1000), WithOnEvict(func(key, value int, reason EvictReason) {
+		mu.Lock()
+		reasons[reason]++
+		mu.Unlock()
+	}))
+	for i := 0; i < 2000; i++ {
+		m.Set(i, i)
+	}
+	m.Clear()
+	m.SetWithTTL(0, 0, time.Millisecond)
+	m.Set(1, 1)
+	m.Set(2, 2)
+	time.Sleep(5 * time.Millisecond)
+	m.Get(0)
+	m.Delete(1)
+	m.CompareAndDelete(2, 2)
+	mu.Lock()
+	defer mu.Unlock()
+	if n := reasons[ReasonEvicted] + reasons[ReasonDeleted]; n != 2002 {
+		t.Fatalf("expected '%v', got '%v'", 2002, n)
+	}
+	if reasons[ReasonEvicted] < 1000-len(m.mus) {
+		t.Fatalf("expected at least '%v', got '%v'", 1000-len(m.mus), reasons[ReasonEvicted])
+	}
+	if reasons[ReasonExpired] != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, reasons[ReasonExpired])
+	}
+	if s := ReasonEvicted.String(); s != "evicted" {
+		t.Fatalf("expected '%v', got '%v'", "evicted", s)
+	}
+}
+
+func TestCloneMaxCost(t *testing.T) {
+	// the clone keeps the cost of every value, not only the total
+	m := New[int, int](0, WithShards[int, int](1), WithMaxCost[int, int](1000, func(key, value int) int64 {
+		return int64(value)
+	}))
+	for i := 1; i <= 10; i++ {
+		m.Set(i, 10)
+	}
+	c := m.Clone()
+	if err := c.shards[0].verify(); err != nil {
+		t.Fatalf("expected '%v', got '%v'", nil, err)
+	}
+	for i := 1; i <= 10; i++ {
+		c.Delete(i)
+	}
+	if c.shards[0].cost != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, c.shards[0].cost)
+	}
+}
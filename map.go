@@ -1,116 +1,604 @@
 package shardmap
 
 import (
+	"context"
+	"errors"
+	"hash/maphash"
 	"runtime"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
+// ErrClosed is returned by Close, and is the panic value of mutating
+// operations, once the map has been closed.
+var ErrClosed = errors.New("shardmap: map is closed")
+
+// ErrReadOnly is the panic value of mutating operations on a read-only map
+// created with WithReadOnlyPanic.
+var ErrReadOnly = errors.New("shardmap: map is read-only")
+
+const (
+	stateOpen uint32 = iota
+	stateReadOnly
+	stateClosed
+)
+
 // Map is a hashmap. Like map[comparable]any, but sharded and thread-safe.
 //
-// The zero value is not safe for use; use New.
+// The zero value is an empty map ready to use, like New(0) without options.
+// A Map must not be copied after first use.
+//
+// Values are stored inline in the buckets, and moved when buckets are
+// displaced or resized. Runs of entries above 128 bytes are moved with a
+// single copy rather than swapped one by one.
 type Map[K comparable, V any] struct {
 	mus    []syncRWMutex
 	shards []shard[K, V]
-	ksize  int
+	calls  []map[K]*call[V] // in-flight GetOrCompute, guarded by mus
+	data   []any            // per-shard user data of ShardData, guarded by mus
+	keys   keyHash[K]
+	hasher func(key K) uint64
+	seed   uint64
 	cap    int
+	opts   []Option[K, V]
+
+	nshards  int
+	stripes  int
+	sbits    uint // log2 of the lock stripes per shard
+	grow     float64
+	shrink   float64
+	janitor  time.Duration
+	onExpire func(key K, value V)
+	onEvict  func(key K, value V, reason EvictReason)
+	lru      int
+	maxCost  int64
+	costFn   func(key K, value V) int64
+	indexes  []string // names of the secondary indexes
+	indexFns []func(value V) string
+	bloom    bool
+	filters  []filter      // bloom filters of the shards, when bloom
+	lazy     bool          // resize shards incrementally
+	kick     chan struct{} // wakes up the background resizer, when set
+	cow      bool
+	tables   []unsafe.Pointer // read-only copies of the shards, when cow
+	seqlock  bool
+	spin     bool
+	hotTop   int
+	hotRate  uint32
+	hot      []hotKeys[K] // top keys of the shards, when hotTop > 0
+	logSize  int
+	logs     []changeLog[K, V] // change logs of the shards, when logSize > 0
+	stamp    bool
+	flush    func(events []Event[K, V])
+	backlog  int // size of the write-behind queues
+	flushers int
+	dirty    []writeQueue[K, V] // write-behind queues of the shards, when flush is set
+	wakes    []chan struct{}    // wake up the write-behind workers
+	coalesce time.Duration
+	pending  []coalesced[K, V] // buffers of SetCoalesced, when coalesce > 0
+	onGet    func(key K, ok bool)
+	onSet    func(key K, value V, replaced bool)
+	onDelete func(key K, deleted bool)
+	sizeFn   func(key K, value V) uint64
+	intern   func(key K) K
+
+	reseed  uint64 // mixed into the hashes picking shards, set by Rehash
+	pinned  bool   // the hasher picks the shards, as for Map2, so no Rehash
+	logSeq  uint64 // sequence number of the last change logged
+	gen     uint32 // odd while Rehash moves the entries
+	state   uint32
+	roPanic bool
+	debug   uint32
+	dbg     debugState
+	done    chan struct{}
+	wg      sync.WaitGroup
+	closers []func() error
+	subMu   sync.Mutex     // serializes Subscribe and cancellations
+	subs    unsafe.Pointer // *[]*subscription[K, V], read by unlock
+	applyMu sync.Mutex     // serializes Apply
+	applied uint64         // sequence number of the last change applied
+	ready   uint32         // set once initialized, see lazyInit
+	initMu  sync.Mutex     // serializes lazyInit
 }
 
 type syncRWMutex struct {
 	sync.RWMutex
-	_ [64 - unsafe.Sizeof(sync.RWMutex{})]byte // avoid false sharing
+	length     int64                                         // shard length as of the last unlock, for LenApprox
+	seq        uint32                                        // odd while write locked, when optimistic
+	spinState  uint32                                        // spin lock state, when spin
+	optimistic bool                                          // count write locks in seq
+	spin       bool                                          // lock with spinState
+	_          [64 - unsafe.Sizeof(sync.RWMutex{}) - 24]byte // avoid false sharing
 }
 
 // New returns a new hashmap with the specified capacity.
-func New[K comparable, V any](cap int) (m *Map[K, V]) {
-	m = &Map[K, V]{cap: cap}
+func New[K comparable, V any](cap int, opts ...Option[K, V]) (m *Map[K, V]) {
+	m = newMap[K, V](cap, opts)
+	m.initShards()
+	return
+}
 
-	n := 1
-	for n < runtime.NumCPU()*16 {
+// initShards initializes the shards of a configured map.
+func (m *Map[K, V]) initShards() {
+	scap := m.cap / len(m.shards)
+	for i := 0; i < len(m.shards); i++ {
+		m.shards[i].init(scap)
+	}
+}
+
+// lazyInit initializes the zero Map on first use, like New(0). It's called
+// by hash, as most methods hash a key first, and by the other methods which
+// would fail on the zero Map.
+func (m *Map[K, V]) lazyInit() {
+	if atomic.LoadUint32(&m.ready) == 0 {
+		m.lazyInitSlow()
+	}
+}
+
+func (m *Map[K, V]) lazyInitSlow() {
+	m.initMu.Lock()
+	defer m.initMu.Unlock()
+	if m.ready == 0 {
+		m.init(0, nil)
+		m.initShards()
+		atomic.StoreUint32(&m.ready, 1)
+	}
+}
+
+// newMap returns a configured hashmap whose shards are not initialized yet.
+func newMap[K comparable, V any](cap int, opts []Option[K, V]) (m *Map[K, V]) {
+	m = &Map[K, V]{ready: 1}
+	m.init(cap, opts)
+	return
+}
+
+func (m *Map[K, V]) init(cap int, opts []Option[K, V]) {
+	m.cap, m.opts, m.done = cap, opts, make(chan struct{})
+	m.seed = new(maphash.Hash).Sum64() // randomly seeded on first use
+	m.grow, m.shrink = loadFactor, 1-loadFactor
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	n, want := 1, m.nshards
+	if want <= 0 {
+		want = runtime.NumCPU() * 16
+	}
+	for n < want {
 		n *= 2
 	}
-	scap := m.cap / n
+	for m.stripes > 1<<m.sbits {
+		m.sbits++
+	}
+	n <<= m.sbits
 	m.mus = make([]syncRWMutex, n)
+	for i := range m.mus {
+		m.mus[i].optimistic = m.seqlock && m.lru == 0 && m.maxCost == 0
+		m.mus[i].spin = m.spin
+	}
 	m.shards = make([]shard[K, V], n)
+	m.calls = make([]map[K]*call[V], n)
+	m.data = make([]any, n)
+	if m.bloom {
+		m.filters = make([]filter, n)
+	}
+	if m.cow {
+		m.tables = make([]unsafe.Pointer, n)
+	}
+	if m.hotTop > 0 {
+		m.hot = make([]hotKeys[K], n)
+	}
+	if m.logSize > 0 {
+		m.logs = make([]changeLog[K, V], n)
+	}
+	if m.flush != nil {
+		m.initWriteBehind(n)
+	}
+	if m.coalesce > 0 {
+		m.pending = make([]coalesced[K, V], runtime.GOMAXPROCS(0))
+	}
 	for i := 0; i < n; i++ {
-		m.shards[i].init(scap)
+		m.shards[i].conf = shardConf[K, V]{
+			notify: m.onExpire != nil || m.onEvict != nil,
+			grow:   m.grow,
+			shrink: m.shrink,
+			index:  m.indexFns,
+			bloom:  m.bloom,
+			rng:    wyhash_RNG(i),
+			lazy:   m.lazy,
+			kick:   m.kick,
+			stamp:  m.stamp,
+			intern: m.intern,
+		}
+		if m.filters != nil {
+			m.shards[i].filter = &m.filters[i]
+		}
+		if m.lru > 0 {
+			m.shards[i].conf.limit = (m.lru + n - 1) / n
+		}
+		if m.logs != nil {
+			m.logs[i].size = (m.logSize + n - 1) / n
+		}
+		if m.records() {
+			m.shards[i].conf.notify, m.shards[i].conf.watch = true, true
+		}
+		if m.maxCost > 0 {
+			m.shards[i].conf.maxCost = (m.maxCost + int64(n) - 1) / int64(n)
+			m.shards[i].conf.cost = m.costFn
+		}
 	}
 
-	var k K
-	switch ((any)(k)).(type) {
-	case string:
-		m.ksize = 0
-	default:
-		m.ksize = int(unsafe.Sizeof(k))
+	m.keys.init()
+
+	if m.janitor > 0 {
+		m.goroutine(m.runJanitor)
 	}
+	if m.kick != nil {
+		m.goroutine(m.runResizer)
+	}
+	if m.pending != nil {
+		m.goroutine(m.runCoalescer)
+	}
+	for w := range m.wakes {
+		w := w
+		m.goroutine(func(done <-chan struct{}) { m.runFlusher(w, done) })
+	}
+}
+
+// NewFromMap returns a new hashmap holding the key/values of src, with a
+// capacity of at least len(src). Large maps are loaded in parallel.
+func NewFromMap[K comparable, V any](src map[K]V, cap int, opts ...Option[K, V]) (m *Map[K, V]) {
+	if cap < len(src) {
+		cap = len(src)
+	}
+	m = New[K, V](cap, opts...)
+
+	workers := runtime.GOMAXPROCS(0)
+	if len(src) < 4096 || workers == 1 {
+		for key, value := range src {
+			m.Set(key, value)
+		}
+		return
+	}
+
+	entries := make([]entry[K, V], 0, len(src))
+	for key, value := range src {
+		entries = append(entries, entry[K, V]{key: key, value: value})
+	}
+	var wg sync.WaitGroup
+	chunk := (len(entries) + workers - 1) / workers
+	for i := 0; i < len(entries); i += chunk {
+		j := i + chunk
+		if j > len(entries) {
+			j = len(entries)
+		}
+		wg.Add(1)
+		go func(entries []entry[K, V]) {
+			defer wg.Done()
+			for _, e := range entries {
+				m.Set(e.key, e.value)
+			}
+		}(entries[i:j])
+	}
+	wg.Wait()
 
 	return
 }
 
-// Clear out all values from map
+func (m *Map[K, V]) hash(key K) uint64 {
+	m.lazyInit()
+	if m.hasher != nil {
+		return m.hasher(key)
+	}
+	return m.keys.hash(key, m.seed)
+}
+
+// shardOf returns the shard of a hash, picked by its low bits and its high bits
+// for the lock stripes, once mixed with the seed of Rehash if any.
+func (m *Map[K, V]) shardOf(hash uint64) int {
+	if seed := atomic.LoadUint64(&m.reseed); seed != 0 {
+		hash = wyhash__wymum(hash^seed, wyhash__wyp0)
+	}
+	if m.sbits == 0 {
+		return int(hash & uint64(len(m.mus)-1))
+	}
+	return int(hash&uint64(len(m.mus)>>m.sbits-1))<<m.sbits | int(hash>>(64-m.sbits))
+}
+
+// Clear out all values from map, reallocating the shards at the capacity
+// given to New.
 func (m *Map[K, V]) Clear() {
+	m.clearAll()
+}
+
+// clearAll is Clear, returning false when the map is read-only.
+func (m *Map[K, V]) clearAll() bool {
+	m.lazyInit()
+	return m.clear(func(s *shard[K, V]) { s.init(m.cap / len(m.mus)) })
+}
+
+// Reset removes all values like Clear, but keeps the buckets of the shards
+// as they are for reuse, which saves allocations and GC work when the map is
+// refilled to a similar size, at the cost of holding on to their memory.
+func (m *Map[K, V]) Reset() {
+	m.lazyInit()
+	m.clear((*shard[K, V]).reset)
+}
+
+// Release removes all values like Clear, and shrinks the shards to their
+// minimum size regardless of the capacity given to New, so that the memory
+// of their buckets can be reclaimed.
+func (m *Map[K, V]) Release() {
+	m.lazyInit()
+	m.clear(func(s *shard[K, V]) { s.init(0) })
+}
+
+// clear drops the values of every shard, then empties it with empty.
+// Returns false when the map is read-only.
+func (m *Map[K, V]) clear(empty func(s *shard[K, V])) bool {
 	for i := 0; i < len(m.mus); i++ {
-		m.mus[i].Lock()
-		m.shards[i].init(m.cap / len(m.mus))
-		m.mus[i].Unlock()
+		debug, ok := m.lock(i)
+		if !ok {
+			return false
+		}
+		m.shards[i].dropAll()
+		empty(&m.shards[i])
+		m.unlock(i, debug)
+	}
+	return true
+}
+
+// Grow makes room for n more values, resizing every shard for its share of
+// them at once, so that loading them does not resize the shards repeatedly.
+func (m *Map[K, V]) Grow(n int) {
+	m.lazyInit()
+	if n <= 0 {
+		return
+	}
+	per := (n + len(m.mus) - 1) / len(m.mus)
+	for i := 0; i < len(m.mus); i++ {
+		debug, ok := m.lock(i)
+		if !ok {
+			return
+		}
+		if s := &m.shards[i]; s.length+per > s.growAt {
+			s.resize(s.sizeFor(s.length + per))
+		}
+		m.unlock(i, debug)
+	}
+}
+
+// Compact resizes every shard down to fit its values, dropping the expired
+// ones, to release the memory of the buckets left empty by deletions. Shards
+// are not shrunk below their share of the capacity given to New.
+func (m *Map[K, V]) Compact() {
+	m.lazyInit()
+	for i := 0; i < len(m.mus); i++ {
+		debug, ok := m.lock(i)
+		if !ok {
+			return
+		}
+		if s := &m.shards[i]; len(s.buckets) > s.cap {
+			s.resize(s.sizeFor(s.length))
+		}
+		m.unlock(i, debug)
 	}
 }
 
 // Set assigns a value to a key.
 // Returns the previous value, or false when no value was assigned.
 func (m *Map[K, V]) Set(key K, value V) (prev V, replaced bool) {
-	var hash uint64
-	if m.ksize == 0 {
-		hash = wyhash_HashString(*(*string)(unsafe.Pointer(&key)), 0)
-	} else {
-		hash = wyhash_HashString(*(*string)(unsafe.Pointer(&struct {
-			data unsafe.Pointer
-			len  int
-		}{unsafe.Pointer(&key), m.ksize})), 0)
+	return m.SetHashed(m.hash(key), key, value)
+}
+
+// SetHashed assigns a value to a key like Set, given the hash of the key
+// returned by Hash, which saves hashing it again.
+func (m *Map[K, V]) SetHashed(hash uint64, key K, value V) (prev V, replaced bool) {
+	m.lazyInit()
+	if m.hot != nil {
+		m.recordHot(hash, key)
+	}
+	shard, debug, ok := m.lockHash(hash)
+	if !ok {
+		return
 	}
-	shard := int(hash & uint64(len(m.mus)-1))
-	m.mus[shard].Lock()
 	prev, replaced = m.shards[shard].Set(hash, key, value)
-	m.mus[shard].Unlock()
+	m.unlock(shard, debug)
 	return prev, replaced
 }
 
 // Get returns a value for a key.
 // Returns false when no value has been assign for key.
 func (m *Map[K, V]) Get(key K) (value V, ok bool) {
-	var hash uint64
-	if m.ksize == 0 {
-		hash = wyhash_HashString(*(*string)(unsafe.Pointer(&key)), 0)
-	} else {
-		hash = wyhash_HashString(*(*string)(unsafe.Pointer(&struct {
-			data unsafe.Pointer
-			len  int
-		}{unsafe.Pointer(&key), m.ksize})), 0)
-	}
-	shard := int(hash & uint64(len(m.mus)-1))
-	m.mus[shard].RLock()
-	value, ok = m.shards[shard].Get(hash, key)
+	return m.GetHashed(m.hash(key), key)
+}
+
+// GetHashed returns a value for a key like Get, given the hash of the key
+// returned by Hash, which saves hashing it again.
+func (m *Map[K, V]) GetHashed(hash uint64, key K) (value V, ok bool) {
+	m.lazyInit()
+	if m.hot != nil {
+		m.recordHot(hash, key)
+	}
+	if value, ok, done := m.getUnlocked(hash, key); done {
+		if m.onGet != nil {
+			m.onGet(key, ok)
+		}
+		return value, ok
+	}
+	shard := m.rlockHash(hash)
+	s := &m.shards[shard]
+	value, ok, expiring := s.fetch(hash, key, true)
 	m.mus[shard].RUnlock()
+	if expiring {
+		m.expireKey(shard, hash, key)
+	}
+	if m.onGet != nil {
+		m.onGet(key, ok)
+	}
 	return value, ok
 }
 
+// Peek returns a value for a key like Get, but without touching the entry,
+// so it neither promotes it in the eviction order nor extends its expiration.
+func (m *Map[K, V]) Peek(key K) (value V, ok bool) {
+	hash := m.hash(key)
+	if m.hot != nil {
+		m.recordHot(hash, key)
+	}
+	if value, ok, done := m.getUnlocked(hash, key); done {
+		return value, ok
+	}
+	shard := m.rlockHash(hash)
+	value, ok = m.shards[shard].Get(hash, key, false)
+	m.mus[shard].RUnlock()
+	return value, ok
+}
+
+// getUnlocked looks up a key without locking its shard, through the bloom
+// filter, the read-only copy or an optimistic read of the shard. It returns
+// false when the caller must look the key up under the read lock instead,
+// which is always the case while Rehash moves the entries.
+func (m *Map[K, V]) getUnlocked(hash uint64, key K) (value V, ok, done bool) {
+	gen := atomic.LoadUint32(&m.gen)
+	if gen&1 != 0 {
+		return
+	}
+	shard := m.shardOf(hash)
+	switch {
+	case m.filters != nil && !m.filters[shard].has(hash):
+		done = true
+	case m.tables != nil:
+		if t := m.table(shard); t != nil {
+			value, ok = t.Get(hash, key, false)
+		}
+		done = true
+	case m.mus[shard].optimistic:
+		value, ok, done = m.getOptimistic(shard, hash, key)
+	}
+	return value, ok, done && atomic.LoadUint32(&m.gen) == gen
+}
+
+// GetOrSet returns the existing value for a key if present. Otherwise, it
+// assigns the given value and returns it.
+// The loaded result is true if the value was loaded, false if assigned.
+func (m *Map[K, V]) GetOrSet(key K, value V) (actual V, loaded bool) {
+	hash := m.hash(key)
+	shard, debug, ok := m.lockHash(hash)
+	if !ok {
+		return
+	}
+	actual, loaded = m.shards[shard].GetOrSet(hash, key, value)
+	m.unlock(shard, debug)
+	if !loaded {
+		actual = value
+	}
+	return actual, loaded
+}
+
+// SetIfAbsent assigns a value to a key only if the key is absent, it never
+// overwrites an existing value.
+// Returns true when the value was assigned.
+func (m *Map[K, V]) SetIfAbsent(key K, value V) (stored bool) {
+	hash := m.hash(key)
+	shard, debug, ok := m.lockHash(hash)
+	if !ok {
+		return
+	}
+	_, loaded := m.shards[shard].GetOrSet(hash, key, value)
+	m.unlock(shard, debug)
+	return !loaded
+}
+
+// Replace assigns a value to a key only if the key is present, it never
+// adds a new key.
+// Returns the previous value, or false when no value was replaced.
+func (m *Map[K, V]) Replace(key K, value V) (prev V, replaced bool) {
+	hash := m.hash(key)
+	shard, debug, ok := m.lockHash(hash)
+	if !ok {
+		return
+	}
+	s := &m.shards[shard]
+	if i := s.find(hash, key); i >= 0 {
+		prev, replaced = s.buckets[i].value, true
+		s.replace(i, value)
+	}
+	m.unlock(shard, debug)
+	return prev, replaced
+}
+
 // Delete deletes a value for a key.
 // Returns the deleted value, or false when no value was assigned.
 func (m *Map[K, V]) Delete(key K) (prev V, deleted bool) {
-	var hash uint64
-	if m.ksize == 0 {
-		hash = wyhash_HashString(*(*string)(unsafe.Pointer(&key)), 0)
-	} else {
-		hash = wyhash_HashString(*(*string)(unsafe.Pointer(&struct {
-			data unsafe.Pointer
-			len  int
-		}{unsafe.Pointer(&key), m.ksize})), 0)
+	return m.DeleteHashed(m.hash(key), key)
+}
+
+// DeleteHashed deletes a value for a key like Delete, given the hash of the
+// key returned by Hash, which saves hashing it again.
+func (m *Map[K, V]) DeleteHashed(hash uint64, key K) (prev V, deleted bool) {
+	prev, deleted, _ = m.deleteHashed(hash, key)
+	return prev, deleted
+}
+
+// deleteHashed is DeleteHashed, also returning false when the map is
+// read-only.
+func (m *Map[K, V]) deleteHashed(hash uint64, key K) (prev V, deleted, ok bool) {
+	m.lazyInit()
+	if m.hot != nil {
+		m.recordHot(hash, key)
+	}
+	shard, debug, ok := m.lockHash(hash)
+	if !ok {
+		return
 	}
-	shard := int(hash & uint64(len(m.mus)-1))
-	m.mus[shard].Lock()
 	prev, deleted = m.shards[shard].Delete(hash, key)
-	m.mus[shard].Unlock()
-	return prev, deleted
+	m.unlock(shard, debug)
+	if m.onDelete != nil && !deleted {
+		m.onDelete(key, false) // deletions are reported by unlock
+	}
+	return prev, deleted, true
+}
+
+// CompareAndDelete deletes the value for a key if it is equal to old.
+// Returns true when the value was deleted.
+// It panics if V is not a comparable type.
+func (m *Map[K, V]) CompareAndDelete(key K, old V) (deleted bool) {
+	hash := m.hash(key)
+	shard, debug, ok := m.lockHash(hash)
+	if !ok {
+		return
+	}
+	s := &m.shards[shard]
+	if i := s.find(hash, key); i >= 0 && any(s.buckets[i].value) == any(old) {
+		s.drop(i, ReasonDeleted)
+		s.remove(i)
+		deleted = true
+	}
+	m.unlock(shard, debug)
+	return deleted
+}
+
+// CompareAndSwap assigns new to a key if its value is equal to old, leaving
+// the map untouched otherwise.
+// Returns true when the value was swapped.
+// It panics if V is not a comparable type.
+func (m *Map[K, V]) CompareAndSwap(key K, old, new V) (swapped bool) {
+	hash := m.hash(key)
+	shard, debug, ok := m.lockHash(hash)
+	if !ok {
+		return
+	}
+	s := &m.shards[shard]
+	if i := s.find(hash, key); i >= 0 && any(s.buckets[i].value) == any(old) {
+		s.replace(i, new)
+		swapped = true
+	}
+	m.unlock(shard, debug)
+	return swapped
 }
 
 // Mutate atomically mutates m[k] by calling mutator.
@@ -122,36 +610,39 @@ func (m *Map[K, V]) Delete(key K) (prev V, deleted bool) {
 // It returns the change in size of the map as a result of the mutation, one of
 // -1 (delete), 0 (change), or 1 (addition).
 func (m *Map[K, V]) Mutate(key K, mutator func(oldValue V, oldValueExisted bool) (newValue V, keep bool)) (delta int) {
-	var hash uint64
-	if m.ksize == 0 {
-		hash = wyhash_HashString(*(*string)(unsafe.Pointer(&key)), 0)
-	} else {
-		hash = wyhash_HashString(*(*string)(unsafe.Pointer(&struct {
-			data unsafe.Pointer
-			len  int
-		}{unsafe.Pointer(&key), m.ksize})), 0)
-	}
-	shard := int(hash & uint64(len(m.mus)-1))
-	m.mus[shard].Lock()
-	defer m.mus[shard].Unlock()
-	oldV, oldOK := m.shards[shard].Get(hash, key)
+	hash := m.hash(key)
+	if m.hot != nil {
+		m.recordHot(hash, key)
+	}
+	shard, debug, ok := m.lockHash(hash)
+	if !ok {
+		return 0
+	}
+	defer m.unlock(shard, debug)
+	oldV, oldOK := m.shards[shard].Get(hash, key, false)
+	if debug != 0 {
+		m.debugPush(shard, false)
+		defer m.debugPop()
+	}
 	newV, newOK := mutator(oldV, oldOK)
 	if newOK {
 		m.shards[shard].Set(hash, key, newV)
+		delta = 1
 		if oldOK {
-			return 0
+			delta = 0
+		}
+	} else {
+		m.shards[shard].Delete(hash, key)
+		if oldOK {
+			delta = -1
 		}
-		return 1
-	}
-	m.shards[shard].Delete(hash, key)
-	if oldOK {
-		return -1
 	}
-	return 0
+	return delta
 }
 
 // Len returns the number of values in map.
 func (m *Map[K, V]) Len() int {
+	m.lazyInit()
 	var n int
 	for i := 0; i < len(m.mus); i++ {
 		m.mus[i].Lock()
@@ -161,22 +652,623 @@ func (m *Map[K, V]) Len() int {
 	return n
 }
 
+// LenApprox returns the number of values in map without locking the shards,
+// as of their last mutation. It may miss concurrent mutations, which makes it
+// suited to metrics which are read often.
+func (m *Map[K, V]) LenApprox() int {
+	m.lazyInit()
+	var n int64
+	for i := 0; i < len(m.mus); i++ {
+		n += atomic.LoadInt64(&m.mus[i].length)
+	}
+	return int(n)
+}
+
 // Range iterates overall all key/values.
 // It's not safe to call or Set or Delete while ranging.
 func (m *Map[K, V]) Range(iter func(key K, value V) bool) {
-	var done bool
+	m.lazyInit()
+	debug := atomic.LoadUint32(&m.debug)
+	for i := 0; i < len(m.mus); i++ {
+		if !m.rangeShard(i, debug, iter) {
+			break
+		}
+	}
+}
+
+// RangeContext iterates over all key/values like Range, checking ctx before
+// every shard and every 1024 key/values. It stops early and returns the error
+// of ctx once ctx is done.
+// It's not safe to call or Set or Delete while ranging.
+func (m *Map[K, V]) RangeContext(ctx context.Context, iter func(key K, value V) bool) error {
+	m.lazyInit()
+	debug := atomic.LoadUint32(&m.debug)
+	var n int
+	var err error
+	for i := 0; i < len(m.mus); i++ {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if !m.rangeShard(i, debug, func(key K, value V) bool {
+			if n++; n%1024 == 0 {
+				if err = ctx.Err(); err != nil {
+					return false
+				}
+			}
+			return iter(key, value)
+		}) {
+			return err
+		}
+	}
+	return nil
+}
+
+// RangeErr iterates over all key/values like Range, until iter returns an
+// error which is then returned.
+// It's not safe to call or Set or Delete while ranging.
+func (m *Map[K, V]) RangeErr(iter func(key K, value V) error) (err error) {
+	m.Range(func(key K, value V) bool {
+		err = iter(key, value)
+		return err == nil
+	})
+	return err
+}
+
+// RangeSnapshot iterates over all key/values like Range, but calls iter
+// outside of the shard locks with a copy of the entries of each shard, so
+// it's safe to Set or Delete while ranging. Mutations of a shard made after
+// it was copied are not observed.
+func (m *Map[K, V]) RangeSnapshot(iter func(key K, value V) bool) {
+	m.lazyInit()
+	var entries []entry[K, V]
 	for i := 0; i < len(m.mus); i++ {
-		m.mus[i].RLock()
-		m.shards[i].Range(func(key K, value V) bool {
-			if !iter(key, value) {
-				done = true
-				return false
+		m.readShard(i, atomic.LoadUint32(&m.debug), func(s *shard[K, V]) {
+			entries = s.AppendEntries(entries[:0])
+		})
+		for _, e := range entries {
+			if !iter(e.key, e.value) {
+				return
 			}
-			return true
+		}
+	}
+}
+
+// RangeParallel iterates over all key/values like Range, with workers
+// goroutines ranging over different shards at the same time, so iter must
+// be safe for concurrent use. Once iter returns false the workers stop after
+// their current call. A workers <= 0 means GOMAXPROCS.
+// It's not safe to call or Set or Delete while ranging.
+func (m *Map[K, V]) RangeParallel(workers int, iter func(key K, value V) bool) {
+	m.lazyInit()
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > len(m.mus) {
+		workers = len(m.mus)
+	}
+	debug := atomic.LoadUint32(&m.debug)
+	var next, stop uint32
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for atomic.LoadUint32(&stop) == 0 {
+				i := int(atomic.AddUint32(&next, 1) - 1)
+				if i >= len(m.mus) {
+					return
+				}
+				m.rangeShard(i, debug, func(key K, value V) bool {
+					if atomic.LoadUint32(&stop) != 0 || !iter(key, value) {
+						atomic.StoreUint32(&stop, 1)
+						return false
+					}
+					return true
+				})
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// NumShards returns the number of shards of the map, for RangeShard.
+func (m *Map[K, V]) NumShards() int {
+	m.lazyInit()
+	return len(m.mus)
+}
+
+// Hash returns the hash of a key, as computed by the map with its seed or the
+// hasher of WithHasher.
+func (m *Map[K, V]) Hash(key K) uint64 {
+	return m.hash(key)
+}
+
+// ShardIndex returns the shard of a key in [0, NumShards()), so that other
+// structures can be partitioned like the map. It changes on Rehash.
+func (m *Map[K, V]) ShardIndex(key K) int {
+	return m.shardOf(m.hash(key))
+}
+
+// RangeShard iterates over the key/values of the shard i, which must be in
+// [0, NumShards()). Ranging over every shard in turn is like Range, which
+// lets scanners spread the work over goroutines or over time.
+// It's not safe to call or Set or Delete while ranging.
+func (m *Map[K, V]) RangeShard(i int, iter func(key K, value V) bool) {
+	m.lazyInit()
+	m.rangeShard(i, atomic.LoadUint32(&m.debug), iter)
+}
+
+// rangeShard iterates over the key/values of shard i under its read lock.
+// Returns false when iter stopped the iteration.
+func (m *Map[K, V]) rangeShard(i int, debug uint32, iter func(key K, value V) bool) bool {
+	done := false
+	if debug != 0 {
+		m.debugLock(i, false)
+		m.debugPush(i, true)
+		defer m.debugPop()
+	}
+	m.mus[i].RLock()
+	defer m.mus[i].RUnlock()
+	m.shards[i].Range(func(key K, value V) bool {
+		if !iter(key, value) {
+			done = true
+			return false
+		}
+		return true
+	})
+	return !done
+}
+
+// readShard calls fn with shard i under its read lock, which is released even
+// when fn panics.
+func (m *Map[K, V]) readShard(i int, debug uint32, fn func(s *shard[K, V])) {
+	if debug != 0 {
+		m.debugLock(i, false)
+	}
+	m.mus[i].RLock()
+	defer m.mus[i].RUnlock()
+	fn(&m.shards[i])
+}
+
+// writeShard calls fn with shard i under its write lock, which is released
+// even when fn panics. Returns false, without calling fn, when the map is
+// read-only or closed.
+func (m *Map[K, V]) writeShard(i int, fn func(s *shard[K, V])) bool {
+	debug, ok := m.lock(i)
+	if !ok {
+		return false
+	}
+	defer m.unlock(i, debug)
+	if debug != 0 {
+		m.debugPush(i, false)
+		defer m.debugPop()
+	}
+	fn(&m.shards[i])
+	return true
+}
+
+// AppendKeys appends all keys to buf and returns the extended buffer.
+func (m *Map[K, V]) AppendKeys(buf []K) []K {
+	m.lazyInit()
+	debug := atomic.LoadUint32(&m.debug)
+	for i := 0; i < len(m.mus); i++ {
+		m.readShard(i, debug, func(s *shard[K, V]) { buf = s.AppendKeys(buf) })
+	}
+	return buf
+}
+
+// AppendValues appends all values to buf and returns the extended buffer.
+func (m *Map[K, V]) AppendValues(buf []V) []V {
+	m.lazyInit()
+	debug := atomic.LoadUint32(&m.debug)
+	for i := 0; i < len(m.mus); i++ {
+		m.readShard(i, debug, func(s *shard[K, V]) { buf = s.AppendValues(buf) })
+	}
+	return buf
+}
+
+// Random returns a key/value picked uniformly at random, or false when the
+// map is empty. A shard is picked in proportion to its length, then one of
+// its values.
+func (m *Map[K, V]) Random() (key K, value V, ok bool) {
+	m.lazyInit()
+	rng := wyhash_RNG(wyhash_Uint64())
+	lens, total := m.lens()
+	if total == 0 {
+		return
+	}
+	for try := 0; try < 8 && !ok; try++ {
+		key, value, ok = m.randomShard(m.pickShard(&rng, lens, total), &rng)
+	}
+	// the picked shards were emptied meanwhile
+	start := rng.Int()
+	for i := 0; i < len(m.mus) && !ok; i++ {
+		key, value, ok = m.randomShard((start+i)&(len(m.mus)-1), &rng)
+	}
+	return key, value, ok
+}
+
+// Entry is a key/value of a map.
+type Entry[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// Sample returns about n key/values picked uniformly at random, possibly
+// repeated. Fewer values are returned when shards are emptied meanwhile.
+func (m *Map[K, V]) Sample(n int) []Entry[K, V] {
+	m.lazyInit()
+	rng := wyhash_RNG(wyhash_Uint64())
+	lens, total := m.lens()
+	if n <= 0 || total == 0 {
+		return nil
+	}
+	counts := make([]int, len(m.mus))
+	for j := 0; j < n; j++ {
+		counts[m.pickShard(&rng, lens, total)]++
+	}
+	samples := make([]Entry[K, V], 0, n)
+	for i, count := range counts {
+		if count == 0 {
+			continue
+		}
+		m.readShard(i, atomic.LoadUint32(&m.debug), func(s *shard[K, V]) {
+			for ; count > 0; count-- {
+				key, value, ok := s.Random(&rng)
+				if !ok {
+					break
+				}
+				samples = append(samples, Entry[K, V]{key, value})
+			}
+		})
+	}
+	return samples
+}
+
+// lens returns the cumulative lengths of the shards as of LenApprox.
+func (m *Map[K, V]) lens() (lens []int64, total int64) {
+	lens = make([]int64, len(m.mus))
+	for i := range lens {
+		total += atomic.LoadInt64(&m.mus[i].length)
+		lens[i] = total
+	}
+	return lens, total
+}
+
+// pickShard returns a shard picked in proportion to its length.
+func (m *Map[K, V]) pickShard(rng *wyhash_RNG, lens []int64, total int64) int {
+	r := int64(rng.Uint64n(uint64(total)))
+	return sort.Search(len(lens), func(i int) bool { return lens[i] > r })
+}
+
+// randomShard returns a key/value of shard i picked uniformly at random.
+func (m *Map[K, V]) randomShard(i int, rng *wyhash_RNG) (key K, value V, ok bool) {
+	m.readShard(i, atomic.LoadUint32(&m.debug), func(s *shard[K, V]) {
+		key, value, ok = s.Random(rng)
+	})
+	return key, value, ok
+}
+
+// Clone returns a copy of the map with the same options, shard count and
+// capacity. Shards are copied wholesale under their read locks, so the clone
+// is consistent per shard but not across shards.
+func (m *Map[K, V]) Clone() *Map[K, V] {
+	m.lazyInit()
+	for {
+		// a Rehash meanwhile would mix shards picked by both seeds
+		gen := atomic.LoadUint32(&m.gen)
+		if gen&1 != 0 {
+			runtime.Gosched()
+			continue
+		}
+		c := newMap[K, V](m.cap, m.opts)
+		c.seed, c.reseed, c.pinned = m.seed, atomic.LoadUint64(&m.reseed), m.pinned
+		debug := atomic.LoadUint32(&m.debug)
+		for i := 0; i < len(m.mus); i++ {
+			if debug != 0 {
+				m.debugLock(i, false)
+			}
+			m.mus[i].RLock()
+			c.shards[i] = m.shards[i].Clone()
+			c.shards[i].conf.watch = c.records() // no subscriptions yet
+			if c.filters != nil {
+				c.shards[i].filter = &c.filters[i]
+				c.filters[i].store(c.shards[i].bloom)
+			}
+			c.mus[i].length = int64(c.shards[i].length)
+			if c.tables != nil {
+				c.publish(i)
+			}
+			m.mus[i].RUnlock()
+		}
+		if atomic.LoadUint32(&m.gen) == gen {
+			return c
+		}
+		c.Close()
+	}
+}
+
+// Merge copies all key/values of other into the map, shard by shard. When a
+// key exists in both maps, resolve is called with the current and the other
+// value and its result is stored; a nil resolve keeps the other value.
+// The resolve function is called under the shard lock and must not access
+// the map.
+func (m *Map[K, V]) Merge(other *Map[K, V], resolve func(key K, a, b V) V) {
+	m.lazyInit()
+	if other == m {
+		return
+	}
+	rehash := len(m.mus) != len(other.mus) || m.sbits != other.sbits || m.seed != other.seed ||
+		m.hasher != nil || other.hasher != nil
+	var entries []entry[K, V]
+	for i := 0; i < len(other.mus); i++ {
+		var reseed uint64
+		other.readShard(i, atomic.LoadUint32(&other.debug), func(s *shard[K, V]) {
+			entries = s.AppendEntries(entries[:0])
+			reseed = atomic.LoadUint64(&other.reseed)
 		})
-		m.mus[i].RUnlock()
-		if done {
+		if !rehash {
+			merged := false
+			if !m.writeShard(i, func(s *shard[K, V]) {
+				// the maps pick shards differently since a Rehash
+				if merged = atomic.LoadUint64(&m.reseed) == reseed; merged {
+					for _, e := range entries {
+						s.merge(e.hdib>>dibBitSize<<dibBitSize, e.key, e.value, resolve)
+					}
+				}
+			}) {
+				return
+			}
+			if merged {
+				continue
+			}
+		}
+		for _, e := range entries {
+			m.merge(m.hash(e.key), e.key, e.value, resolve)
+		}
+	}
+}
+
+func (m *Map[K, V]) merge(hash uint64, key K, value V, resolve func(key K, a, b V) V) {
+	shard, debug, ok := m.lockHash(hash)
+	if !ok {
+		return
+	}
+	defer m.unlock(shard, debug)
+	if debug != 0 {
+		m.debugPush(shard, false)
+		defer m.debugPop()
+	}
+	m.shards[shard].merge(hash, key, value, resolve)
+}
+
+// DeleteFunc deletes all key/values for which pred returns true.
+// The pred function is called under the shard lock and must not access the map.
+// Returns the number of deleted values.
+func (m *Map[K, V]) DeleteFunc(pred func(key K, value V) bool) (n int) {
+	m.lazyInit()
+	var buf []entry[K, V]
+	for i := 0; i < len(m.mus); i++ {
+		var deleted int
+		if !m.writeShard(i, func(s *shard[K, V]) { deleted, buf = s.DeleteFunc(pred, buf) }) {
+			return
+		}
+		n += deleted
+	}
+	return n
+}
+
+// ToMap returns a standard Go map holding all key/values.
+func (m *Map[K, V]) ToMap() map[K]V {
+	dst := make(map[K]V, m.Len())
+	m.Range(func(key K, value V) bool {
+		dst[key] = value
+		return true
+	})
+	return dst
+}
+
+// Close stops the background goroutines of the map, flushes any pending work
+// and releases the shards. Mutating a closed map panics with ErrClosed, while
+// reads behave as if the map is empty.
+// Closing an already closed map returns ErrClosed.
+func (m *Map[K, V]) Close() (err error) {
+	m.lazyInit()
+	if m.pending != nil && atomic.LoadUint32(&m.state) == stateOpen {
+		m.FlushCoalesced()
+	}
+	for {
+		state := atomic.LoadUint32(&m.state)
+		if state == stateClosed {
+			return ErrClosed
+		}
+		if atomic.CompareAndSwapUint32(&m.state, state, stateClosed) {
 			break
 		}
 	}
+	// wait for in-flight writers, they observe the state under shard lock.
+	for i := 0; i < len(m.mus); i++ {
+		m.mus[i].Lock()
+		m.mus[i].Unlock()
+	}
+
+	close(m.done)
+	m.wg.Wait()
+
+	for _, closer := range m.closers {
+		if e := closer(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	for i := 0; i < len(m.mus); i++ {
+		m.mus[i].Lock()
+		m.shards[i] = shard[K, V]{}
+		if m.filters != nil {
+			m.filters[i].store(nil)
+		}
+		if m.tables != nil {
+			atomic.StorePointer(&m.tables[i], nil)
+		}
+		atomic.StoreInt64(&m.mus[i].length, 0)
+		m.mus[i].Unlock()
+	}
+
+	return err
+}
+
+// SetReadOnly switches the map into or out of read-only mode. While read-only,
+// Get and Range work as usual, but Set, Delete, Mutate and Clear leave the map
+// untouched and report that nothing was changed, or panic with ErrReadOnly if
+// the map was created with WithReadOnlyPanic.
+// Writers already holding a shard lock are waited for before it returns.
+func (m *Map[K, V]) SetReadOnly(readonly bool) {
+	m.lazyInit()
+	old, state := stateReadOnly, stateOpen
+	if readonly {
+		old, state = stateOpen, stateReadOnly
+	}
+	if !atomic.CompareAndSwapUint32(&m.state, old, state) {
+		return
+	}
+	for i := 0; i < len(m.mus); i++ {
+		m.mus[i].Lock()
+		m.mus[i].Unlock()
+	}
+}
+
+// ReadOnly reports whether the map is in read-only mode.
+func (m *Map[K, V]) ReadOnly() bool {
+	return atomic.LoadUint32(&m.state) == stateReadOnly
+}
+
+// goroutine runs fn in background until the map is closed.
+// fn must return once done is closed.
+func (m *Map[K, V]) goroutine(fn func(done <-chan struct{})) {
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		fn(m.done)
+	}()
+}
+
+// onClose registers fn to be called by Close after background goroutines
+// have stopped and before the shards are released.
+func (m *Map[K, V]) onClose(fn func() error) {
+	m.closers = append(m.closers, fn)
+}
+
+// lock write locks shard i for a mutation. It returns the debug level to pass
+// to unlock, and false if the map is not writable, in which case the shard is
+// not locked.
+func (m *Map[K, V]) lock(i int) (debug uint32, ok bool) {
+	debug = atomic.LoadUint32(&m.debug)
+	if debug != 0 {
+		m.debugLock(i, true)
+	}
+	m.mus[i].Lock()
+	return debug, m.writable(i)
+}
+
+// lockHash write locks the shard of a hash like lock, and returns it. The
+// shard is looked up again under the lock, lest Rehash moved the hash
+// meanwhile.
+func (m *Map[K, V]) lockHash(hash uint64) (shard int, debug uint32, ok bool) {
+	for {
+		shard = m.shardOf(hash)
+		if debug, ok = m.lock(shard); !ok || m.shardOf(hash) == shard {
+			return shard, debug, ok
+		}
+		m.mus[shard].Unlock()
+	}
+}
+
+// rlockHash read locks the shard of a hash, and returns it.
+func (m *Map[K, V]) rlockHash(hash uint64) int {
+	for {
+		shard := m.shardOf(hash)
+		if atomic.LoadUint32(&m.debug) != 0 {
+			m.debugLock(shard, false)
+		}
+		m.mus[shard].RLock()
+		if m.shardOf(hash) == shard {
+			return shard
+		}
+		m.mus[shard].RUnlock()
+	}
+}
+
+// unlock write unlocks shard i locked by lock, then calls the callbacks of
+// the entries removed meanwhile.
+func (m *Map[K, V]) unlock(i int, debug uint32) {
+	if debug != 0 {
+		m.debugVerify(i, debug)
+	}
+	s := &m.shards[i]
+	atomic.StoreInt64(&m.mus[i].length, int64(s.length))
+	if m.tables != nil {
+		m.publish(i)
+	}
+	if m.logs != nil {
+		m.logs[i].append(&m.logSeq, s.dropped)
+	}
+	if s.dropped == nil {
+		m.mus[i].Unlock()
+		return
+	}
+	dropped := s.dropped
+	s.dropped = nil
+	// number the write-behind events while locked, as the changes are
+	var seq uint64
+	if m.dirty != nil {
+		seq = m.dirty[i].seq
+		for _, e := range dropped {
+			if flushed(EventType(e.reason)) {
+				m.dirty[i].seq++
+			}
+		}
+	}
+	m.mus[i].Unlock()
+	subs := m.subscriptions()
+	for _, e := range dropped {
+		switch {
+		case e.reason == 0 && m.onSet != nil:
+			m.onSet(e.key, e.value, e.replaced)
+		case e.reason == ReasonDeleted && m.onDelete != nil:
+			m.onDelete(e.key, true)
+		}
+		if e.reason != 0 {
+			if m.onExpire != nil && e.reason == ReasonExpired {
+				m.onExpire(e.key, e.value)
+			}
+			if m.onEvict != nil {
+				m.onEvict(e.key, e.value, e.reason)
+			}
+		}
+		event := Event[K, V]{Type: EventType(e.reason), Key: e.key, Value: e.value}
+		for _, sub := range subs {
+			sub.fn(event)
+		}
+		if m.dirty != nil && flushed(event.Type) {
+			seq++
+			m.enqueue(i, seq, event)
+		}
+	}
+}
+
+// writable reports whether the locked shard i may be mutated. If not, the
+// shard is unlocked and the call either returns false or panics.
+func (m *Map[K, V]) writable(i int) bool {
+	state := atomic.LoadUint32(&m.state)
+	if state == stateOpen {
+		return true
+	}
+	m.mus[i].Unlock()
+	switch {
+	case state == stateClosed:
+		panic(ErrClosed)
+	case m.roPanic:
+		panic(ErrReadOnly)
+	}
+	return false
 }
@@ -0,0 +1,98 @@
+package shardmap
+
+import (
+	"sync/atomic"
+)
+
+// Map2 is a hashmap keyed by pairs of keys. All pairs sharing their outer
+// key are kept in the same shard, so that they can be ranged over or deleted
+// together without scanning the whole map.
+//
+// The zero value is not safe for use; use NewMap2.
+type Map2[K1, K2 comparable, V any] struct {
+	m     *Map[Key2[K1, K2], V]
+	outer keyHash[K1]
+}
+
+// NewMap2 returns a new Map2 with the specified capacity.
+func NewMap2[K1, K2 comparable, V any](cap int) *Map2[K1, K2, V] {
+	m := &Map2[K1, K2, V]{}
+	m.outer.init()
+	var inner keyHash[Key2[K1, K2]]
+	inner.init()
+	// the shard is picked by the outer key, the bucket by the pair
+	m.m = New[Key2[K1, K2], V](cap, WithHasher[Key2[K1, K2], V](func(key Key2[K1, K2]) uint64 {
+		mask := uint64(len(m.m.mus) - 1)
+		return m.outer.hash(key.A, m.m.seed)&mask | inner.hash(key, m.m.seed)&^mask
+	}))
+	m.m.pinned = true
+	return m
+}
+
+// Map returns the underlying Map.
+func (m *Map2[K1, K2, V]) Map() *Map[Key2[K1, K2], V] {
+	return m.m
+}
+
+// Set assigns a value to a pair of keys.
+// Returns the previous value, or false when no value was assigned.
+func (m *Map2[K1, K2, V]) Set(k1 K1, k2 K2, value V) (prev V, replaced bool) {
+	return m.m.Set(Key2[K1, K2]{k1, k2}, value)
+}
+
+// Get returns a value for a pair of keys.
+// Returns false when no value has been assign for the pair.
+func (m *Map2[K1, K2, V]) Get(k1 K1, k2 K2) (value V, ok bool) {
+	return m.m.Get(Key2[K1, K2]{k1, k2})
+}
+
+// Delete deletes a value for a pair of keys.
+// Returns the deleted value, or false when no value was assigned.
+func (m *Map2[K1, K2, V]) Delete(k1 K1, k2 K2) (prev V, deleted bool) {
+	return m.m.Delete(Key2[K1, K2]{k1, k2})
+}
+
+// Len returns the number of values in map.
+func (m *Map2[K1, K2, V]) Len() int {
+	return m.m.Len()
+}
+
+// Range iterates over all key pairs and values.
+// It's not safe to call or Set or Delete while ranging.
+func (m *Map2[K1, K2, V]) Range(iter func(k1 K1, k2 K2, value V) bool) {
+	m.m.Range(func(key Key2[K1, K2], value V) bool {
+		return iter(key.A, key.B, value)
+	})
+}
+
+// RangeOuter iterates over the inner keys and values of an outer key, only
+// ranging over the shard of k1.
+// It's not safe to call or Set or Delete while ranging.
+func (m *Map2[K1, K2, V]) RangeOuter(k1 K1, iter func(k2 K2, value V) bool) {
+	m.m.rangeShard(m.shard(k1), atomic.LoadUint32(&m.m.debug), func(key Key2[K1, K2], value V) bool {
+		if key.A != k1 {
+			return true
+		}
+		return iter(key.B, value)
+	})
+}
+
+// DeleteOuter deletes all values of an outer key.
+// Returns the number of deleted values.
+func (m *Map2[K1, K2, V]) DeleteOuter(k1 K1) (n int) {
+	shard := m.shard(k1)
+	debug, ok := m.m.lock(shard)
+	if !ok {
+		return
+	}
+	n, _ = m.m.shards[shard].DeleteFunc(func(key Key2[K1, K2], _ V) bool {
+		return key.A == k1
+	}, nil)
+	m.m.unlock(shard, debug)
+	return n
+}
+
+// shard returns the shard of the pairs of an outer key.
+func (m *Map2[K1, K2, V]) shard(k1 K1) int {
+	return m.m.shardOf(m.outer.hash(k1, m.m.seed))
+}
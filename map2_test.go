@@ -0,0 +1,38 @@
+package shardmap
+
+import (
+	"testing"
+)
+
+func TestMap2(t *testing.T) {
+	m := NewMap2[string, int, int](0)
+	m.m.SetDebugLevel(DebugVerify)
+	for tenant := 0; tenant < 10; tenant++ {
+		for id := 0; id < 100; id++ {
+			m.Set(k(tenant), id, tenant*1000+id)
+		}
+	}
+	if v, ok := m.Get(k(3), 42); !ok || v != 3042 {
+		t.Fatalf("expected '%v', got '%v'", 3042, v)
+	}
+	var n int
+	m.RangeOuter(k(3), func(id, value int) bool {
+		if value != 3000+id {
+			t.Fatalf("expected '%v', got '%v'", 3000+id, value)
+		}
+		n++
+		return true
+	})
+	if n != 100 {
+		t.Fatalf("expected '%v', got '%v'", 100, n)
+	}
+	if n := m.DeleteOuter(k(3)); n != 100 {
+		t.Fatalf("expected '%v', got '%v'", 100, n)
+	}
+	if _, ok := m.Get(k(3), 42); ok || m.Len() != 900 {
+		t.Fatalf("expected '%v', got '%v'", 900, m.Len())
+	}
+	if v, ok := m.Delete(k(4), 42); !ok || v != 4042 {
+		t.Fatalf("expected '%v', got '%v'", 4042, v)
+	}
+}
@@ -5,10 +5,16 @@
 package shardmap
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"math/rand"
+	"runtime"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -289,6 +295,46 @@ func TestClear(t *testing.T) {
 
 }
 
+func TestResetRelease(t *testing.T) {
+	buckets := func(m *Map[int, int]) (n int) {
+		for _, s := range m.Stats().Shards {
+			n += s.Buckets
+		}
+		return n
+	}
+	m := New[int, int](0, WithShards[int, int](4), WithBloomFilter[int, int](), WithIndex[int, int]("parity", func(v int) string {
+		return strconv.Itoa(v % 2)
+	}))
+	for i := 0; i < 10000; i++ {
+		m.Set(i, i)
+	}
+	before := buckets(m)
+	m.Reset()
+	if m.Len() != 0 || buckets(m) != before {
+		t.Fatalf("expected '%v' buckets, got '%v'", before, buckets(m))
+	}
+	if _, ok := m.Get(1); ok {
+		t.Fatalf("expected '%v', got '%v'", false, ok)
+	}
+	if entries := m.GetByIndex("parity", "1"); len(entries) != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, len(entries))
+	}
+	for i := 0; i < 10000; i++ {
+		m.Set(i, i)
+	}
+	if v, ok := m.Get(9999); !ok || v != 9999 || buckets(m) != before {
+		t.Fatalf("expected '%v', got '%v'", 9999, v)
+	}
+	m.Release()
+	if m.Len() != 0 || buckets(m) != 4*8 {
+		t.Fatalf("expected '%v' buckets, got '%v'", 4*8, buckets(m))
+	}
+	m.Set(1, 1)
+	if v, ok := m.Get(1); !ok || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+}
+
 // see https://github.com/cornelk/hashmap/issues/73
 func BenchmarkHashMap_RaceCase1(b *testing.B) {
 	const (
@@ -368,3 +414,890 @@ func BenchmarkHashMap_RaceCase3(b *testing.B) {
 	}
 
 }
+
+func TestClose(t *testing.T) {
+	m := New[string, int](0)
+	for i := 0; i < 1000; i++ {
+		m.Set(fmt.Sprintf("%d", i), i)
+	}
+	var stopped, flushed bool
+	m.goroutine(func(done <-chan struct{}) {
+		<-done
+		stopped = true
+	})
+	m.onClose(func() error {
+		if !stopped {
+			t.Fatal("expected background goroutine to be stopped")
+		}
+		flushed = true
+		return nil
+	})
+	if err := m.Close(); err != nil {
+		t.Fatalf("expected '%v', got '%v'", nil, err)
+	}
+	if !flushed {
+		t.Fatal("expected closer to be called")
+	}
+	if err := m.Close(); err != ErrClosed {
+		t.Fatalf("expected '%v', got '%v'", ErrClosed, err)
+	}
+	if m.Len() != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, m.Len())
+	}
+	if _, ok := m.Get("1"); ok {
+		t.Fatal("expected false")
+	}
+	defer func() {
+		if r := recover(); r != ErrClosed {
+			t.Fatalf("expected '%v', got '%v'", ErrClosed, r)
+		}
+	}()
+	m.Set("1", 1)
+}
+
+func TestReadOnly(t *testing.T) {
+	m := New[string, int](0)
+	m.Set("hello", 1)
+	m.SetReadOnly(true)
+	if !m.ReadOnly() {
+		t.Fatal("expected true")
+	}
+	if v, ok := m.Set("hello", 2); ok || v != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, v)
+	}
+	if v, ok := m.Delete("hello"); ok || v != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, v)
+	}
+	m.Clear()
+	if v, ok := m.Get("hello"); !ok || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+	m.SetReadOnly(false)
+	if v, ok := m.Set("hello", 2); !ok || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+
+	m = New[string, int](0, WithReadOnlyPanic[string, int]())
+	m.SetReadOnly(true)
+	defer func() {
+		if r := recover(); r != ErrReadOnly {
+			t.Fatalf("expected '%v', got '%v'", ErrReadOnly, r)
+		}
+		// the shard lock must have been released before panicking
+		if _, ok := m.Get("hello"); ok {
+			t.Fatal("expected false")
+		}
+	}()
+	m.Set("hello", 1)
+}
+
+func TestDebugLevel(t *testing.T) {
+	m := New[int, int](0)
+	m.SetDebugLevel(DebugVerify)
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	for i := 0; i < 1000; i += 2 {
+		m.Delete(i)
+	}
+	m.Mutate(1, func(v int, ok bool) (int, bool) { return v + 1, true })
+
+	expectPanic := func(want string, fn func()) {
+		t.Helper()
+		defer func() {
+			if r := recover(); !strings.HasPrefix(fmt.Sprint(r), want) {
+				t.Fatalf("expected '%v', got '%v'", want, r)
+			}
+		}()
+		fn()
+	}
+	expectPanic("shardmap: re-entrant call on locked shard", func() {
+		m.Mutate(3, func(v int, ok bool) (int, bool) {
+			m.Get(3)
+			return v, ok
+		})
+	})
+	if v, _ := m.Get(3); v != 3 {
+		t.Fatalf("expected '%v', got '%v'", 3, v)
+	}
+	expectPanic("shardmap: mutation during Range", func() {
+		m.Range(func(key, value int) bool {
+			m.Set(-1, -1)
+			return true
+		})
+	})
+	m.SetDebugLevel(DebugOff)
+	if _, ok := m.Get(-1); ok {
+		t.Fatal("expected false")
+	}
+
+	// the shards are unlocked after panics of callbacks
+	expectPanic("boom", func() { m.Range(func(int, int) bool { panic("boom") }) })
+	expectPanic("boom", func() { m.View(1, func(*int, bool) { panic("boom") }) })
+	expectPanic("boom", func() { m.Update(1, func(*int) { panic("boom") }) })
+	expectPanic("boom", func() { m.DeleteFunc(func(int, int) bool { panic("boom") }) })
+	expectPanic("boom", func() { m.DoShard(0, func() { panic("boom") }) })
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+}
+
+func TestPeek(t *testing.T) {
+	m := New[string, int](0)
+	if _, ok := m.Peek("hello"); ok {
+		t.Fatal("expected false")
+	}
+	m.Set("hello", 1)
+	if v, ok := m.Peek("hello"); !ok || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+}
+
+func TestGetOrSet(t *testing.T) {
+	m := New[string, int](0)
+	if v, loaded := m.GetOrSet("hello", 1); loaded || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+	if v, loaded := m.GetOrSet("hello", 2); !loaded || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+	if v, _ := m.Get("hello"); v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+	for i := 0; i < 1000; i++ {
+		m.GetOrSet(k(i), i)
+	}
+	if m.Len() != 1001 {
+		t.Fatalf("expected '%v', got '%v'", 1001, m.Len())
+	}
+}
+
+func TestCompareAndDelete(t *testing.T) {
+	m := New[string, int](0)
+	if m.CompareAndDelete("hello", 0) {
+		t.Fatal("expected false")
+	}
+	m.Set("hello", 1)
+	if m.CompareAndDelete("hello", 2) {
+		t.Fatal("expected false")
+	}
+	if !m.CompareAndDelete("hello", 1) {
+		t.Fatal("expected true")
+	}
+	if _, ok := m.Get("hello"); ok {
+		t.Fatal("expected false")
+	}
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	m := New[string, int](0)
+	if m.CompareAndSwap("hello", 0, 1) {
+		t.Fatal("expected false")
+	}
+	m.Set("hello", 1)
+	var events int
+	m.Subscribe(func(Event[string, int]) { events++ })
+	if m.CompareAndSwap("hello", 2, 3) || events != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, events)
+	}
+	if !m.CompareAndSwap("hello", 1, 3) || events != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, events)
+	}
+	if v, _ := m.Get("hello"); v != 3 {
+		t.Fatalf("expected '%v', got '%v'", 3, v)
+	}
+}
+
+func TestSetIfAbsent(t *testing.T) {
+	m := New[string, int](0)
+	if !m.SetIfAbsent("hello", 1) {
+		t.Fatal("expected true")
+	}
+	if m.SetIfAbsent("hello", 2) {
+		t.Fatal("expected false")
+	}
+	if v, _ := m.Get("hello"); v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+	m.SetReadOnly(true)
+	if m.SetIfAbsent("world", 1) {
+		t.Fatal("expected false")
+	}
+}
+
+func TestReplace(t *testing.T) {
+	m := New[string, int](0)
+	if _, replaced := m.Replace("hello", 1); replaced {
+		t.Fatal("expected false")
+	}
+	if _, ok := m.Get("hello"); ok {
+		t.Fatal("expected false")
+	}
+	m.Set("hello", 1)
+	if v, replaced := m.Replace("hello", 2); !replaced || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+	if v, _ := m.Get("hello"); v != 2 {
+		t.Fatalf("expected '%v', got '%v'", 2, v)
+	}
+}
+
+func TestAppendKeys(t *testing.T) {
+	m := New[int, int](0)
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	keys := m.AppendKeys([]int{-1})
+	if len(keys) != 1001 || keys[0] != -1 {
+		t.Fatalf("expected '%v', got '%v'", 1001, len(keys))
+	}
+	seen := make(map[int]bool)
+	for _, key := range keys[1:] {
+		seen[key] = true
+	}
+	if len(seen) != 1000 {
+		t.Fatalf("expected '%v', got '%v'", 1000, len(seen))
+	}
+}
+
+func TestAppendValues(t *testing.T) {
+	m := New[int, int](0)
+	var sum int
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+		sum += i
+	}
+	values := m.AppendValues(nil)
+	if len(values) != 1000 {
+		t.Fatalf("expected '%v', got '%v'", 1000, len(values))
+	}
+	for _, v := range values {
+		sum -= v
+	}
+	if sum != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, sum)
+	}
+}
+
+func TestClone(t *testing.T) {
+	m := New[int, int](0)
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	c := m.Clone()
+	m.Set(0, -1)
+	m.Delete(1)
+	if c.Len() != 1000 {
+		t.Fatalf("expected '%v', got '%v'", 1000, c.Len())
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := c.Get(i); !ok || v != i {
+			t.Fatalf("expected '%v', got '%v'", i, v)
+		}
+	}
+	c.Set(1000, 1000)
+	if _, ok := m.Get(1000); ok {
+		t.Fatal("expected false")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a := New[int, int](0)
+	b := New[int, int](0)
+	for i := 0; i < 1000; i++ {
+		a.Set(i, i)
+		b.Set(i+500, i+500)
+	}
+	a.Merge(b, func(key, x, y int) int {
+		return x + y
+	})
+	if a.Len() != 1500 {
+		t.Fatalf("expected '%v', got '%v'", 1500, a.Len())
+	}
+	for i := 0; i < 1500; i++ {
+		want := i
+		if i >= 500 && i < 1000 {
+			want = i * 2
+		}
+		if v, _ := a.Get(i); v != want {
+			t.Fatalf("expected '%v', got '%v'", want, v)
+		}
+	}
+	if b.Len() != 1000 {
+		t.Fatalf("expected '%v', got '%v'", 1000, b.Len())
+	}
+}
+
+func TestDeleteFunc(t *testing.T) {
+	m := New[int, int](0)
+	m.SetDebugLevel(DebugVerify)
+	for i := 0; i < 10000; i++ {
+		m.Set(i, i)
+	}
+	n := m.DeleteFunc(func(key, value int) bool {
+		return key%3 != 0
+	})
+	if n != 6666 {
+		t.Fatalf("expected '%v', got '%v'", 6666, n)
+	}
+	if m.Len() != 3334 {
+		t.Fatalf("expected '%v', got '%v'", 3334, m.Len())
+	}
+	m.Range(func(key, value int) bool {
+		if key%3 != 0 {
+			t.Fatalf("expected '%v', got '%v'", 0, key%3)
+		}
+		return true
+	})
+}
+
+func TestNewFromMap(t *testing.T) {
+	for _, n := range []int{100, 100000} {
+		src := make(map[int]int, n)
+		for i := 0; i < n; i++ {
+			src[i] = i
+		}
+		m := NewFromMap(src, 0)
+		if m.Len() != n {
+			t.Fatalf("expected '%v', got '%v'", n, m.Len())
+		}
+		for i := 0; i < n; i++ {
+			if v, ok := m.Get(i); !ok || v != i {
+				t.Fatalf("expected '%v', got '%v'", i, v)
+			}
+		}
+		dst := m.ToMap()
+		if len(dst) != n {
+			t.Fatalf("expected '%v', got '%v'", n, len(dst))
+		}
+		for key, value := range dst {
+			if key != value {
+				t.Fatalf("expected '%v', got '%v'", key, value)
+			}
+		}
+	}
+}
+
+func TestWithHasher(t *testing.T) {
+	hasher := func(key uint64) uint64 { return key * 0x9E3779B97F4A7C15 }
+	m := New[uint64, int](0, WithHasher[uint64, int](hasher))
+	m.SetDebugLevel(DebugVerify)
+	for i := 0; i < 1000; i++ {
+		m.Set(uint64(i), i)
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := m.Get(uint64(i)); !ok || v != i {
+			t.Fatalf("expected '%v', got '%v'", i, v)
+		}
+	}
+	// merging into a wyhash map rehashes the keys
+	other := New[uint64, int](0)
+	other.Merge(m, nil)
+	for i := 0; i < 1000; i++ {
+		if v, ok := other.Get(uint64(i)); !ok || v != i {
+			t.Fatalf("expected '%v', got '%v'", i, v)
+		}
+	}
+}
+
+func TestWithSeed(t *testing.T) {
+	a := New[string, int](0)
+	b := New[string, int](0)
+	if a.hash("hello") == b.hash("hello") {
+		t.Fatalf("expected random seeds")
+	}
+	a = New[string, int](0, WithSeed[string, int](42))
+	b = New[string, int](0, WithSeed[string, int](42))
+	if a.hash("hello") != b.hash("hello") {
+		t.Fatalf("expected '%v', got '%v'", a.hash("hello"), b.hash("hello"))
+	}
+	a.Set("hello", 1)
+	if v, _ := a.Clone().Get("hello"); v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+}
+
+func TestWithShards(t *testing.T) {
+	for _, tt := range []struct{ n, want int }{{1, 1}, {3, 4}, {64, 64}} {
+		m := New[int, int](0, WithShards[int, int](tt.n))
+		if len(m.mus) != tt.want {
+			t.Fatalf("expected '%v', got '%v'", tt.want, len(m.mus))
+		}
+		for i := 0; i < 1000; i++ {
+			m.Set(i, i)
+		}
+		if m.Len() != 1000 {
+			t.Fatalf("expected '%v', got '%v'", 1000, m.Len())
+		}
+	}
+}
+
+func TestWithLockStripes(t *testing.T) {
+	// the low bits of all hashes are the same
+	hasher := func(key int) uint64 { return uint64(key) * 0x9E3779B97F4A7C15 &^ 0xFF }
+	m := New[int, int](0, WithShards[int, int](2), WithLockStripes[int, int](3), WithHasher[int, int](hasher))
+	if len(m.mus) != 8 {
+		t.Fatalf("expected '%v', got '%v'", 8, len(m.mus))
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	for i, st := range m.Stats().Shards {
+		if (i < 4) != (st.Len > 0) {
+			t.Fatalf("unexpected length %v of shard %v", st.Len, i)
+		}
+	}
+	plain := New[int, int](0, WithShards[int, int](8))
+	plain.Merge(m, nil)
+	var buf bytes.Buffer
+	if _, err := plain.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	c := New[int, int](0, WithShards[int, int](2), WithLockStripes[int, int](4))
+	if _, err := c.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := c.Get(i); !ok || v != i {
+			t.Fatalf("expected '%v', got '%v'", i, v)
+		}
+	}
+}
+
+func TestLoadFactor(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](1), WithLoadFactor[int, int](0.5), WithShrinkFactor[int, int](0))
+	m.SetDebugLevel(DebugVerify)
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+		if s := &m.shards[0]; s.length > len(s.buckets)/2 {
+			t.Fatalf("expected at most '%v', got '%v'", len(s.buckets)/2, s.length)
+		}
+	}
+	n := len(m.shards[0].buckets)
+	for i := 0; i < 1000; i++ {
+		m.Delete(i)
+	}
+	if l := len(m.shards[0].buckets); l != n {
+		t.Fatalf("expected '%v', got '%v'", n, l)
+	}
+
+	m = New[int, int](0, WithShards[int, int](1))
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	for i := 0; i < 1000; i++ {
+		m.Delete(i)
+	}
+	if l := len(m.shards[0].buckets); l >= n {
+		t.Fatalf("expected less than '%v', got '%v'", n, l)
+	}
+}
+
+func TestGrow(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](1))
+	m.Set(-1, -1)
+	m.Grow(1000)
+	n := len(m.shards[0].buckets)
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	if l := len(m.shards[0].buckets); l != n {
+		t.Fatalf("expected '%v', got '%v'", n, l)
+	}
+	if m.Len() != 1001 {
+		t.Fatalf("expected '%v', got '%v'", 1001, m.Len())
+	}
+}
+
+func TestCompact(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](1), WithShrinkFactor[int, int](0))
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	for i := 10; i < 1000; i++ {
+		m.Delete(i)
+	}
+	n := len(m.shards[0].buckets)
+	m.Compact()
+	if l := len(m.shards[0].buckets); l >= n || l < 10 {
+		t.Fatalf("expected less than '%v', got '%v'", n, l)
+	}
+	for i := 0; i < 10; i++ {
+		if v, ok := m.Get(i); !ok || v != i {
+			t.Fatalf("expected '%v', got '%v'", i, v)
+		}
+	}
+}
+
+func TestLenApprox(t *testing.T) {
+	m := New[int, int](0)
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	for i := 0; i < 100; i++ {
+		m.Delete(i)
+	}
+	if n := m.LenApprox(); n != m.Len() {
+		t.Fatalf("expected '%v', got '%v'", m.Len(), n)
+	}
+	if n := m.Clone().LenApprox(); n != 900 {
+		t.Fatalf("expected '%v', got '%v'", 900, n)
+	}
+	m.Close()
+	if n := m.LenApprox(); n != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, n)
+	}
+}
+
+func TestRangeParallel(t *testing.T) {
+	m := New[int, int](0)
+	m.SetDebugLevel(DebugAssert)
+	for i := 0; i < 10000; i++ {
+		m.Set(i, i)
+	}
+	var mu sync.Mutex
+	seen := make(map[int]bool)
+	m.RangeParallel(4, func(key, value int) bool {
+		mu.Lock()
+		seen[key] = true
+		mu.Unlock()
+		return true
+	})
+	if len(seen) != 10000 {
+		t.Fatalf("expected '%v', got '%v'", 10000, len(seen))
+	}
+	var n int32
+	m.RangeParallel(0, func(key, value int) bool {
+		return atomic.AddInt32(&n, 1) < 10
+	})
+	if n < 10 || n > 10+int32(runtime.GOMAXPROCS(0)) {
+		t.Fatalf("expected about '%v', got '%v'", 10, n)
+	}
+}
+
+func TestRangeShard(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](8))
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	if m.NumShards() != 8 {
+		t.Fatalf("expected '%v', got '%v'", 8, m.NumShards())
+	}
+	var n int
+	for i := 0; i < m.NumShards(); i++ {
+		var shard int
+		m.RangeShard(i, func(key, value int) bool {
+			shard++
+			return true
+		})
+		if shard == 0 || shard == 1000 {
+			t.Fatalf("unexpected shard length '%v'", shard)
+		}
+		n += shard
+	}
+	if n != 1000 {
+		t.Fatalf("expected '%v', got '%v'", 1000, n)
+	}
+}
+
+func TestShardIndex(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](8), WithLockStripes[int, int](2))
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	for _, seed := range []uint64{0, 42} {
+		m.Rehash(seed)
+		for i := 0; i < m.NumShards(); i++ {
+			m.RangeShard(i, func(key, value int) bool {
+				if shard := m.ShardIndex(key); shard != i {
+					t.Fatalf("expected '%v', got '%v'", i, shard)
+				}
+				return true
+			})
+		}
+	}
+	if m.Hash(1) != m.hash(1) || m.Hash(1) == m.Hash(2) {
+		t.Fatalf("unexpected hashes '%v' and '%v'", m.Hash(1), m.Hash(2))
+	}
+}
+
+func TestHashed(t *testing.T) {
+	m := New[string, int](0)
+	for i := 0; i < 1000; i++ {
+		m.SetHashed(m.Hash(k(i)), k(i), i)
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := m.Get(k(i)); !ok || v != i {
+			t.Fatalf("expected '%v', got '%v'", i, v)
+		}
+		if v, ok := m.GetHashed(m.Hash(k(i)), k(i)); !ok || v != i {
+			t.Fatalf("expected '%v', got '%v'", i, v)
+		}
+		if v, ok := m.DeleteHashed(m.Hash(k(i)), k(i)); !ok || v != i {
+			t.Fatalf("expected '%v', got '%v'", i, v)
+		}
+	}
+	if n := m.Len(); n != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, n)
+	}
+}
+
+func TestRangeSnapshot(t *testing.T) {
+	m := New[int, int](0)
+	m.SetDebugLevel(DebugVerify)
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	var n int
+	m.RangeSnapshot(func(key, value int) bool {
+		m.Delete(key)
+		m.Set(key+1000, value)
+		n++
+		return n < 1000
+	})
+	if n != 1000 || m.Len() != 1000 {
+		t.Fatalf("expected '%v', got '%v' '%v'", 1000, n, m.Len())
+	}
+}
+
+func TestRangeContext(t *testing.T) {
+	m := New[int, int](0)
+	for i := 0; i < 10000; i++ {
+		m.Set(i, i)
+	}
+	var n int
+	if err := m.RangeContext(context.Background(), func(key, value int) bool {
+		n++
+		return true
+	}); err != nil || n != 10000 {
+		t.Fatalf("expected '%v', got '%v' '%v'", 10000, n, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	n = 0
+	err := m.RangeContext(ctx, func(key, value int) bool {
+		if n++; n == 10 {
+			cancel()
+		}
+		return true
+	})
+	if err != context.Canceled || n >= 10000 {
+		t.Fatalf("expected '%v', got '%v' '%v'", context.Canceled, n, err)
+	}
+	n = 0
+	if err := m.RangeContext(context.Background(), func(key, value int) bool {
+		n++
+		return false
+	}); err != nil || n != 1 {
+		t.Fatalf("expected '%v', got '%v' '%v'", 1, n, err)
+	}
+}
+
+func TestRangeErr(t *testing.T) {
+	m := New[int, int](0)
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+	}
+	var n int
+	if err := m.RangeErr(func(key, value int) error {
+		n++
+		return nil
+	}); err != nil || n != 100 {
+		t.Fatalf("expected '%v', got '%v' '%v'", 100, n, err)
+	}
+	errStop := fmt.Errorf("stop")
+	n = 0
+	if err := m.RangeErr(func(key, value int) error {
+		if n++; n == 10 {
+			return errStop
+		}
+		return nil
+	}); err != errStop || n != 10 {
+		t.Fatalf("expected '%v', got '%v' '%v'", errStop, n, err)
+	}
+}
+
+func TestRandom(t *testing.T) {
+	m := New[int, int](0)
+	if _, _, ok := m.Random(); ok {
+		t.Fatalf("expected no value")
+	}
+	m.Set(1, 1)
+	if k, v, ok := m.Random(); !ok || k != 1 || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, k)
+	}
+	for i := 2; i <= 100; i++ {
+		m.Set(i, i)
+	}
+	seen := make(map[int]bool)
+	for i := 0; i < 1000; i++ {
+		k, v, _ := m.Random()
+		if k != v {
+			t.Fatalf("expected '%v', got '%v'", k, v)
+		}
+		seen[k] = true
+	}
+	if len(seen) < 50 {
+		t.Fatalf("expected at least '%v' keys, got '%v'", 50, len(seen))
+	}
+}
+
+func TestSample(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](4))
+	if s := m.Sample(10); len(s) != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, len(s))
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	s := m.Sample(100)
+	if len(s) != 100 {
+		t.Fatalf("expected '%v', got '%v'", 100, len(s))
+	}
+	for _, e := range s {
+		if e.Key != e.Value {
+			t.Fatalf("expected '%v', got '%v'", e.Key, e.Value)
+		}
+	}
+}
+
+func TestRandomUniform(t *testing.T) {
+	// a sparse shard next to a dense one
+	m := New[int, int](0, WithShards[int, int](2), WithShrinkFactor[int, int](0))
+	for i := 0; i < 4000; i++ {
+		m.Set(i, i)
+	}
+	m.DeleteFunc(func(key, value int) bool {
+		return key >= 20 && m.hash(key)&1 == 0
+	})
+	counts := make(map[int]int)
+	const draws = 200000
+	for _, e := range m.Sample(draws) {
+		counts[e.Key]++
+	}
+	want := float64(draws) / float64(m.Len())
+	for key := range counts {
+		if c := float64(counts[key]); c < want/3 || c > want*3 {
+			t.Fatalf("key %v drawn %v times, expected about %v", key, c, want)
+		}
+	}
+	if len(counts) != m.Len() {
+		t.Fatalf("expected '%v', got '%v'", m.Len(), len(counts))
+	}
+}
+
+func TestZeroValue(t *testing.T) {
+	var s struct {
+		m Map[int, int]
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				s.m.Set(g*100+i, i)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if s.m.Len() != 800 {
+		t.Fatalf("expected '%v', got '%v'", 800, s.m.Len())
+	}
+	if v, ok := s.m.Get(799); !ok || v != 99 {
+		t.Fatalf("expected '%v', got '%v'", 99, v)
+	}
+
+	var m Map[int, int]
+	var events int
+	m.Subscribe(func(Event[int, int]) { events++ })
+	m.Set(1, 1)
+	if events != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, events)
+	}
+	var buf bytes.Buffer
+	if _, err := s.m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var c Map[int, int]
+	if _, err := c.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if c.Len() != 800 {
+		t.Fatalf("expected '%v', got '%v'", 800, c.Len())
+	}
+	var z Map[int, int]
+	if z.Len() != 0 || z.NumShards() == 0 {
+		t.Fatalf("expected an empty map, got '%v' '%v'", z.Len(), z.NumShards())
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLargeValues(t *testing.T) {
+	type large struct {
+		n   int
+		pad [200]byte
+	}
+	m := New[int, large](0, WithShards[int, large](2))
+	m.SetDebugLevel(DebugVerify)
+	ref := make(map[int]int)
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := 0; i < 20000; i++ {
+		key := r.Intn(2000)
+		switch r.Intn(3) {
+		case 0, 1:
+			if r.Intn(2) == 0 {
+				m.SetWithTTL(key, large{n: i}, time.Hour)
+			} else {
+				m.Set(key, large{n: i})
+			}
+			ref[key] = i
+		case 2:
+			m.Delete(key)
+			delete(ref, key)
+		}
+	}
+	if m.Len() != len(ref) {
+		t.Fatalf("expected '%v', got '%v'", len(ref), m.Len())
+	}
+	for key, n := range ref {
+		if v, ok := m.Get(key); !ok || v.n != n {
+			t.Fatalf("expected '%v', got '%v'", n, v.n)
+		}
+	}
+}
+
+func TestZeroValueConcurrent(t *testing.T) {
+	// the first use of a zero Map initializes it once, whichever method it is
+	reads := []func(m *Map[int, int]){
+		func(m *Map[int, int]) { m.Len() },
+		func(m *Map[int, int]) { m.LenApprox() },
+		func(m *Map[int, int]) { m.Range(func(int, int) bool { return true }) },
+		func(m *Map[int, int]) { m.RangeSnapshot(func(int, int) bool { return true }) },
+		func(m *Map[int, int]) { m.AppendKeys(nil) },
+		func(m *Map[int, int]) { m.AppendValues(nil) },
+		func(m *Map[int, int]) { m.Clone() },
+		func(m *Map[int, int]) { m.Random() },
+		func(m *Map[int, int]) { m.Sample(1) },
+		func(m *Map[int, int]) { m.DeleteFunc(func(int, int) bool { return false }) },
+		func(m *Map[int, int]) { m.Compact() },
+		func(m *Map[int, int]) { m.Clear() },
+		func(m *Map[int, int]) { m.WriteTo(io.Discard) },
+	}
+	for _, read := range reads {
+		var m Map[int, int]
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			m.Set(1, 1)
+		}()
+		go func() {
+			defer wg.Done()
+			read(&m)
+		}()
+		wg.Wait()
+		m.Close()
+	}
+}
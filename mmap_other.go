@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package shardmap
+
+// mmap allocates size bytes, on the Go heap where memory can't be mapped.
+func mmap(size int) []byte {
+	return make([]byte, size)
+}
+
+// munmap releases the memory of mmap to the garbage collector.
+func munmap(b []byte) {}
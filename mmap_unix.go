@@ -0,0 +1,23 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package shardmap
+
+import (
+	"syscall"
+)
+
+// mmap maps size bytes of anonymous memory outside of the Go heap.
+func mmap(size int) []byte {
+	b, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		panic("shardmap: mmap: " + err.Error())
+	}
+	return b
+}
+
+// munmap unmaps the memory of mmap.
+func munmap(b []byte) {
+	if err := syscall.Munmap(b); err != nil {
+		panic("shardmap: munmap: " + err.Error())
+	}
+}
@@ -0,0 +1,29 @@
+package shardmap
+
+// Number is the constraint of the values of Add.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Add adds delta to the value of a key under a single shard lock, an absent
+// key counts as zero.
+// Returns the new value.
+func Add[K comparable, N Number](m *Map[K, N], key K, delta N) N {
+	hash := m.hash(key)
+	shard, debug, ok := m.lockHash(hash)
+	if !ok {
+		return 0
+	}
+	s := &m.shards[shard]
+	value := delta
+	if i := s.find(hash, key); i >= 0 {
+		value += s.buckets[i].value
+		s.replace(i, value)
+	} else {
+		s.Set(hash, key, value)
+	}
+	m.unlock(shard, debug)
+	return value
+}
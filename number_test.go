@@ -0,0 +1,31 @@
+package shardmap
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestAdd(t *testing.T) {
+	m := New[string, int64](0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				Add(m, "hits", 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if v := Add(m, "hits", -8000); v != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, v)
+	}
+	f := New[int, float64](0)
+	if v := Add(f, 1, 0.5); v != 0.5 {
+		t.Fatalf("expected '%v', got '%v'", 0.5, v)
+	}
+	if allocs := testing.AllocsPerRun(100, func() { Add(m, "hits", 1) }); allocs != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, allocs)
+	}
+}
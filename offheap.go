@@ -0,0 +1,207 @@
+package shardmap
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// OffHeapMap is a map of strings to byte slices whose values are copied into
+// memory mapped regions outside of the Go heap, which the garbage collector
+// neither scans nor counts, so that huge caches don't inflate the heap and
+// its GC cycles. Values are copied in by Set and out by Get.
+//
+// The map holds an OffHeapRef per value, and accepts the options of a
+// Map[string, OffHeapRef] to bound or shard it, but not WithOnEvict, which
+// it uses to release the memory of removed values. Regions are unmapped by
+// Close, after which the map must not be used.
+//
+// The zero value is not safe for use; use NewOffHeapMap.
+type OffHeapMap struct {
+	m      *Map[string, OffHeapRef]
+	arenas []offHeapArena
+}
+
+// OffHeapRef locates a value of an OffHeapMap in its regions.
+type OffHeapRef struct {
+	arena  uint32
+	region uint32
+	off    uint32
+	len    uint32
+	class  uint8 // size class of the block, or offHeapLarge
+}
+
+const (
+	offHeapMinClass = 4  // 16 bytes blocks
+	offHeapMaxClass = 20 // 1MB blocks
+	offHeapLarge    = 255
+	offHeapRegion   = 4 << 20 // size of the regions holding blocks
+)
+
+// offHeapArena allocates blocks of powers of two sizes in its regions, and
+// maps a region of its own for every large value.
+type offHeapArena struct {
+	mu      sync.Mutex
+	regions [][]byte
+	holes   []uint32                          // indexes of unmapped regions
+	free    [offHeapMaxClass + 1][]OffHeapRef // freed blocks by class
+	region  uint32                            // region being carved into blocks
+	used    int                               // bytes carved from the region
+}
+
+// NewOffHeapMap returns a new OffHeapMap with the specified capacity.
+func NewOffHeapMap(cap int, opts ...Option[string, OffHeapRef]) *OffHeapMap {
+	m := &OffHeapMap{}
+	opts = append(opts[:len(opts):len(opts)], WithOnEvict(func(key string, ref OffHeapRef, reason EvictReason) {
+		m.free(ref)
+	}))
+	m.m = New[string, OffHeapRef](cap, opts...)
+	m.arenas = make([]offHeapArena, m.m.NumShards())
+	for i := range m.arenas {
+		m.arenas[i].region = ^uint32(0)
+	}
+	return m
+}
+
+// Map returns the underlying Map, whose values are only meaningful to the
+// OffHeapMap.
+func (m *OffHeapMap) Map() *Map[string, OffHeapRef] {
+	return m.m
+}
+
+// alloc copies a value into a block of an arena.
+func (m *OffHeapMap) alloc(key string, value []byte) OffHeapRef {
+	i := uint32(m.m.ShardIndex(key) % len(m.arenas))
+	a := &m.arenas[i]
+	class := uint8(bits.Len(uint(len(value) - 1)))
+	if len(value) <= 1 || class < offHeapMinClass {
+		class = offHeapMinClass
+	}
+	a.mu.Lock()
+	var ref OffHeapRef
+	switch {
+	case class > offHeapMaxClass:
+		ref = OffHeapRef{region: a.mapRegion(len(value)), class: offHeapLarge}
+	case len(a.free[class]) > 0:
+		ref = a.free[class][len(a.free[class])-1]
+		a.free[class] = a.free[class][:len(a.free[class])-1]
+	default:
+		if a.region == ^uint32(0) || a.used+1<<class > offHeapRegion {
+			a.region, a.used = a.mapRegion(offHeapRegion), 0
+		}
+		ref = OffHeapRef{region: a.region, off: uint32(a.used), class: class}
+		a.used += 1 << class
+	}
+	ref.arena, ref.len = i, uint32(len(value))
+	copy(a.regions[ref.region][ref.off:], value)
+	a.mu.Unlock()
+	return ref
+}
+
+// mapRegion maps a region of size bytes, and returns its index.
+func (a *offHeapArena) mapRegion(size int) uint32 {
+	region := mmap(size)
+	if n := len(a.holes); n > 0 {
+		i := a.holes[n-1]
+		a.holes = a.holes[:n-1]
+		a.regions[i] = region
+		return i
+	}
+	a.regions = append(a.regions, region)
+	return uint32(len(a.regions) - 1)
+}
+
+// free releases the block of a value which is no longer in the map.
+func (m *OffHeapMap) free(ref OffHeapRef) {
+	a := &m.arenas[ref.arena]
+	a.mu.Lock()
+	if ref.class == offHeapLarge {
+		munmap(a.regions[ref.region])
+		a.regions[ref.region] = nil
+		a.holes = append(a.holes, ref.region)
+	} else {
+		a.free[ref.class] = append(a.free[ref.class], ref)
+	}
+	a.mu.Unlock()
+}
+
+// bytes returns the memory of a value, which is valid until it's freed.
+func (m *OffHeapMap) bytes(ref OffHeapRef) []byte {
+	a := &m.arenas[ref.arena]
+	a.mu.Lock()
+	region := a.regions[ref.region]
+	a.mu.Unlock()
+	return region[ref.off : ref.off+ref.len : ref.off+ref.len]
+}
+
+// Set assigns a copy of a value to a key.
+// Returns true when a value was replaced.
+func (m *OffHeapMap) Set(key string, value []byte) (replaced bool) {
+	return m.SetWithTTL(key, value, 0)
+}
+
+// SetWithTTL assigns a copy of a value to a key which expires after ttl, a
+// ttl <= 0 means the value never expires.
+// Returns true when a value was replaced.
+func (m *OffHeapMap) SetWithTTL(key string, value []byte, ttl time.Duration) (replaced bool) {
+	prev, replaced := m.m.SetWithTTL(key, m.alloc(key, value), ttl)
+	if replaced {
+		// replaced values are not evicted
+		m.free(prev)
+	}
+	return replaced
+}
+
+// Get returns a copy of the value of a key.
+// Returns false when no value has been assign for key.
+func (m *OffHeapMap) Get(key string) (value []byte, ok bool) {
+	// copied under the shard lock, before the block can be freed
+	m.m.View(key, func(ref *OffHeapRef, found bool) {
+		if ok = found; ok {
+			value = append([]byte{}, m.bytes(*ref)...)
+		}
+	})
+	return value, ok
+}
+
+// Delete deletes the value of a key.
+// Returns true when a value was deleted.
+func (m *OffHeapMap) Delete(key string) (deleted bool) {
+	_, deleted = m.m.Delete(key)
+	return deleted
+}
+
+// Len returns the number of values in map.
+func (m *OffHeapMap) Len() int {
+	return m.m.Len()
+}
+
+// Range iterates over all key/values. The value shares the memory of the map
+// and must not be modified or retained.
+func (m *OffHeapMap) Range(iter func(key string, value []byte) bool) {
+	m.m.Range(func(key string, ref OffHeapRef) bool {
+		return iter(key, m.bytes(ref))
+	})
+}
+
+// Clear out all values from map
+func (m *OffHeapMap) Clear() {
+	m.m.Clear()
+}
+
+// Close closes the underlying Map, and unmaps the regions.
+func (m *OffHeapMap) Close() error {
+	err := m.m.Close()
+	for i := range m.arenas {
+		a := &m.arenas[i]
+		a.mu.Lock()
+		for j, region := range a.regions {
+			if region != nil {
+				munmap(region)
+				a.regions[j] = nil
+			}
+		}
+		a.mu.Unlock()
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package shardmap
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOffHeapMap(t *testing.T) {
+	m := NewOffHeapMap(0, WithShards[string, OffHeapRef](4))
+	defer m.Close()
+	large := bytes.Repeat([]byte("x"), 3<<20)
+	for i := 0; i < 1000; i++ {
+		m.Set(strconv.Itoa(i), []byte(strconv.Itoa(i)))
+	}
+	if m.Set("1", large) != true {
+		t.Fatalf("expected '%v', got '%v'", true, false)
+	}
+	if v, ok := m.Get("1"); !ok || !bytes.Equal(v, large) {
+		t.Fatalf("expected '%v' bytes, got '%v'", len(large), len(v))
+	}
+	m.Set("1", []byte("one"))
+	if v, ok := m.Get("1"); !ok || string(v) != "one" {
+		t.Fatalf("expected '%v', got '%s'", "one", v)
+	}
+	for i := 2; i < 1000; i += 2 {
+		if !m.Delete(strconv.Itoa(i)) {
+			t.Fatalf("expected '%v', got '%v'", true, false)
+		}
+	}
+	// freed blocks are reused
+	for i := 2; i < 1000; i += 2 {
+		m.Set(strconv.Itoa(i), []byte("even"))
+	}
+	regions := 0
+	for i := range m.arenas {
+		regions += len(m.arenas[i].regions)
+	}
+	if regions > 4+1 {
+		t.Fatalf("expected at most '%v' regions, got '%v'", 5, regions)
+	}
+	n := 0
+	m.Range(func(key string, value []byte) bool {
+		i, _ := strconv.Atoi(key)
+		switch {
+		case i == 1 && string(value) != "one",
+			i > 1 && i%2 == 0 && string(value) != "even",
+			i%2 == 1 && i > 1 && string(value) != key:
+			t.Fatalf("unexpected '%v' for '%v'", string(value), key)
+		}
+		n++
+		return true
+	})
+	if n != 1000 || m.Len() != 1000 {
+		t.Fatalf("expected '%v', got '%v'", 1000, n)
+	}
+	m.SetWithTTL("ttl", []byte("v"), time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, ok := m.Get("ttl"); ok {
+		t.Fatalf("expected '%v', got '%v'", false, ok)
+	}
+	m.Clear()
+	if _, ok := m.Get("1"); ok || m.Len() != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, m.Len())
+	}
+}
+
+func TestOffHeapMapConcurrent(t *testing.T) {
+	m := NewOffHeapMap(0)
+	defer m.Close()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := strconv.Itoa(i % 50)
+				value := []byte(key + "/" + strconv.Itoa(g))
+				m.Set(key, value)
+				if v, ok := m.Get(key); ok && !bytes.HasPrefix(v, []byte(key+"/")) {
+					t.Errorf("unexpected '%s' for '%v'", v, key)
+				}
+				if i%3 == 0 {
+					m.Delete(key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,132 @@
+package shardmap
+
+import "strconv"
+
+// Option configures a Map created by New.
+type Option[K comparable, V any] func(*Map[K, V])
+
+// WithReadOnlyPanic makes mutating operations panic with ErrReadOnly while the
+// map is read-only, instead of silently leaving it untouched.
+func WithReadOnlyPanic[K comparable, V any]() Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.roPanic = true
+	}
+}
+
+// WithShards sets the number of shards of the map, rounded up to a power of
+// two. By default there are 16 shards per CPU, fewer shards save memory for
+// small maps while more shards reduce lock contention.
+func WithShards[K comparable, V any](n int) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.nshards = n
+	}
+}
+
+// WithLockStripes splits every shard into n lock stripes, rounded up to a power
+// of two, which are picked by the high bits of the hashes while shards are
+// picked by their low bits. Keys whose hashes share their low bits, as with a
+// skewed WithHasher, are then spread over n locks instead of queuing on one.
+// NumShards and Stats count every stripe as a shard.
+func WithLockStripes[K comparable, V any](n int) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.stripes = n
+	}
+}
+
+// WithLoadFactor sets the fraction of the buckets of a shard in use at which
+// it doubles, 0.85 by default. Lower load factors trade memory for shorter
+// probe chains. Values outside of (0, 1) are ignored.
+func WithLoadFactor[K comparable, V any](f float64) Option[K, V] {
+	return func(m *Map[K, V]) {
+		if f > 0 && f < 1 {
+			m.grow = f
+		}
+	}
+}
+
+// WithShrinkFactor sets the fraction of the buckets of a shard in use at or
+// below which it shrinks to fit, 0.15 by default. It should be well below half
+// the load factor to avoid resizing back and forth, and 0 disables shrinking.
+// Values outside of [0, 1) are ignored.
+func WithShrinkFactor[K comparable, V any](f float64) Option[K, V] {
+	return func(m *Map[K, V]) {
+		if f >= 0 && f < 1 {
+			m.shrink = f
+		}
+	}
+}
+
+// WithHasher makes the map hash keys with hasher instead of wyhash. The
+// hasher must return equal hashes for equal keys, and its low bits pick the
+// shard of a key so they should be well distributed.
+func WithHasher[K comparable, V any](hasher func(key K) uint64) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.hasher = hasher
+	}
+}
+
+// WithSeed makes the map hash keys with a fixed seed, for reproducible
+// hashes across maps and runs. By default every map uses a random seed, so
+// that colliding keys can't be crafted to slow it down.
+func WithSeed[K comparable, V any](seed uint64) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.seed = seed
+	}
+}
+
+// WithLRU bounds the map to about maxEntries values, evicting the least
+// recently used value of a shard once it holds more than its share of
+// maxEntries. Recency is tracked per value by Get and writes, and evictions
+// pick the oldest of a few sampled values, so the order is approximate.
+func WithLRU[K comparable, V any](maxEntries int) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.lru = maxEntries
+	}
+}
+
+// WithMaxCost bounds the total cost of the map to about maxCost, where the
+// cost of each value is given by cost, e.g. its size in bytes. Once a shard
+// holds more than its share of maxCost, values are evicted like with WithLRU
+// until it fits again, so a value costing more than that share is evicted
+// right away. A nil cost counts each value as 1.
+func WithMaxCost[K comparable, V any](maxCost int64, cost func(key K, value V) int64) Option[K, V] {
+	if cost == nil {
+		cost = func(K, V) int64 { return 1 }
+	}
+	return func(m *Map[K, V]) {
+		m.maxCost, m.costFn = maxCost, cost
+	}
+}
+
+// EvictReason tells why a value was removed from the map.
+type EvictReason uint8
+
+const (
+	// ReasonExpired means the value outlived its ttl.
+	ReasonExpired EvictReason = iota + 1
+	// ReasonEvicted means the value was evicted to bound the map.
+	ReasonEvicted
+	// ReasonDeleted means the value was deleted or cleared.
+	ReasonDeleted
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case ReasonExpired:
+		return "expired"
+	case ReasonEvicted:
+		return "evicted"
+	case ReasonDeleted:
+		return "deleted"
+	}
+	return "EvictReason(" + strconv.Itoa(int(r)) + ")"
+}
+
+// WithOnEvict registers fn to be called with every key/value removed from
+// the map, along with the reason of the removal. Replaced values are not
+// reported. The fn is called outside of the shard lock.
+func WithOnEvict[K comparable, V any](fn func(key K, value V, reason EvictReason)) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.onEvict = fn
+	}
+}
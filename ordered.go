@@ -0,0 +1,165 @@
+package shardmap
+
+import (
+	"container/heap"
+	"hash/maphash"
+	"runtime"
+)
+
+// OrderedMap is a sharded hashmap whose shards are B-trees, which supports
+// ordered iteration and range queries over its keys, at the cost of slower
+// lookups than Map.
+//
+// The zero value is not safe for use; use NewOrderedMap.
+type OrderedMap[K Ordered, V any] struct {
+	mus   []syncRWMutex
+	trees []btree[K, V]
+	keys  keyHash[K]
+	seed  uint64
+}
+
+// NewOrderedMap returns a new OrderedMap with 16 shards per CPU.
+func NewOrderedMap[K Ordered, V any]() *OrderedMap[K, V] {
+	n := 1
+	for n < runtime.NumCPU()*16 {
+		n *= 2
+	}
+	m := &OrderedMap[K, V]{
+		mus:   make([]syncRWMutex, n),
+		trees: make([]btree[K, V], n),
+		seed:  new(maphash.Hash).Sum64(),
+	}
+	m.keys.init()
+	return m
+}
+
+func (m *OrderedMap[K, V]) shard(key K) int {
+	return int(m.keys.hash(key, m.seed) & uint64(len(m.mus)-1))
+}
+
+// Set assigns a value to a key.
+// Returns the previous value, or false when no value was assigned.
+func (m *OrderedMap[K, V]) Set(key K, value V) (prev V, replaced bool) {
+	shard := m.shard(key)
+	m.mus[shard].Lock()
+	prev, replaced = m.trees[shard].Set(key, value)
+	m.mus[shard].Unlock()
+	return prev, replaced
+}
+
+// Get returns a value for a key.
+// Returns false when no value has been assign for key.
+func (m *OrderedMap[K, V]) Get(key K) (value V, ok bool) {
+	shard := m.shard(key)
+	m.mus[shard].RLock()
+	value, ok = m.trees[shard].Get(key)
+	m.mus[shard].RUnlock()
+	return value, ok
+}
+
+// Delete deletes a value for a key.
+// Returns the deleted value, or false when no value was assigned.
+func (m *OrderedMap[K, V]) Delete(key K) (prev V, deleted bool) {
+	shard := m.shard(key)
+	m.mus[shard].Lock()
+	prev, deleted = m.trees[shard].Delete(key)
+	m.mus[shard].Unlock()
+	return prev, deleted
+}
+
+// Len returns the number of values in map.
+func (m *OrderedMap[K, V]) Len() int {
+	var n int
+	for i := 0; i < len(m.mus); i++ {
+		m.mus[i].RLock()
+		n += m.trees[i].length
+		m.mus[i].RUnlock()
+	}
+	return n
+}
+
+// Range iterates over all key/values in ascending key order.
+// The entries are copied from the shards in small batches, so it's safe to
+// Set or Delete while ranging, and keys set meanwhile may be missed.
+func (m *OrderedMap[K, V]) Range(iter func(key K, value V) bool) {
+	var zero K
+	m.ascend(zero, zero, false, false, iter)
+}
+
+// RangeBetween iterates over the key/values with keys in [lo, hi) in
+// ascending key order, like Range.
+func (m *OrderedMap[K, V]) RangeBetween(lo, hi K, iter func(key K, value V) bool) {
+	m.ascend(lo, hi, true, true, iter)
+}
+
+// orderedBatch is the max number of entries copied from a shard at once.
+const orderedBatch = 64
+
+// cursor walks the matching entries of a shard in ascending order, a batch
+// at a time.
+type cursor[K Ordered, V any] struct {
+	shard int
+	batch []Entry[K, V]
+	next  int  // index of the next entry in the batch
+	more  bool // the shard may have entries after the batch
+}
+
+// ascend merges the matching entries of every shard, with a cursor per shard.
+func (m *OrderedMap[K, V]) ascend(lo, hi K, hasLo, hasHi bool, iter func(key K, value V) bool) {
+	h := make(cursorHeap[K, V], 0, len(m.mus))
+	for i := 0; i < len(m.mus); i++ {
+		c := &cursor[K, V]{shard: i}
+		if m.fill(c, lo, hi, hasLo, hasHi, false); len(c.batch) > 0 {
+			h = append(h, c)
+		}
+	}
+	heap.Init(&h)
+	for len(h) > 0 {
+		c := h[0]
+		e := c.batch[c.next]
+		if c.next++; c.next == len(c.batch) && c.more {
+			// resume after e, before any other key is merged
+			m.fill(c, e.Key, hi, true, hasHi, true)
+		}
+		if c.next == len(c.batch) {
+			heap.Pop(&h)
+		} else {
+			heap.Fix(&h, 0)
+		}
+		if !iter(e.Key, e.Value) {
+			return
+		}
+	}
+}
+
+// fill copies the next batch of the cursor from its shard, starting at lo, or
+// after lo when after is set.
+func (m *OrderedMap[K, V]) fill(c *cursor[K, V], lo, hi K, hasLo, hasHi, after bool) {
+	batch := c.batch[:0]
+	m.mus[c.shard].RLock()
+	m.trees[c.shard].Ascend(lo, hi, hasLo, hasHi, func(key K, value V) bool {
+		if after && key == lo {
+			return true
+		}
+		batch = append(batch, Entry[K, V]{key, value})
+		return len(batch) < orderedBatch
+	})
+	m.mus[c.shard].RUnlock()
+	c.batch, c.next, c.more = batch, 0, len(batch) == orderedBatch
+}
+
+// cursorHeap is a min-heap of cursors, by their next key.
+type cursorHeap[K Ordered, V any] []*cursor[K, V]
+
+func (h cursorHeap[K, V]) Len() int { return len(h) }
+func (h cursorHeap[K, V]) Less(i, j int) bool {
+	return h[i].batch[h[i].next].Key < h[j].batch[h[j].next].Key
+}
+func (h cursorHeap[K, V]) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *cursorHeap[K, V]) Push(x any)   { *h = append(*h, x.(*cursor[K, V])) }
+func (h *cursorHeap[K, V]) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
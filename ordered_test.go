@@ -0,0 +1,73 @@
+package shardmap
+
+import (
+	"testing"
+)
+
+func TestOrderedMap(t *testing.T) {
+	m := NewOrderedMap[int, int]()
+	for i := 999; i >= 0; i-- {
+		m.Set(i*2, i)
+	}
+	if v, ok := m.Get(42); !ok || v != 21 {
+		t.Fatalf("expected '%v', got '%v'", 21, v)
+	}
+	if _, ok := m.Get(43); ok {
+		t.Fatalf("expected no value")
+	}
+	last, n := -1, 0
+	m.Range(func(key, value int) bool {
+		if key <= last {
+			t.Fatalf("unexpected key '%v' after '%v'", key, last)
+		}
+		last = key
+		n++
+		return true
+	})
+	if n != 1000 || m.Len() != 1000 {
+		t.Fatalf("expected '%v', got '%v'", 1000, n)
+	}
+	var keys []int
+	m.RangeBetween(99, 110, func(key, value int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if len(keys) != 5 || keys[0] != 100 || keys[4] != 108 {
+		t.Fatalf("expected '%v', got '%v'", []int{100, 102, 104, 106, 108}, keys)
+	}
+	if v, ok := m.Delete(100); !ok || v != 50 || m.Len() != 999 {
+		t.Fatalf("expected '%v', got '%v'", 50, v)
+	}
+}
+
+func TestOrderedMapBatches(t *testing.T) {
+	m := NewOrderedMap[int, int]()
+	n := len(m.mus) * orderedBatch * 3
+	for i := 0; i < n; i++ {
+		m.Set(i, i)
+	}
+	next := 0
+	m.Range(func(key, value int) bool {
+		if key != next {
+			t.Fatalf("expected '%v', got '%v'", next, key)
+		}
+		// setting while ranging is safe, keys before the cursor are missed
+		m.Set(-key-1, 0)
+		next++
+		return true
+	})
+	if next != n {
+		t.Fatalf("expected '%v', got '%v'", n, next)
+	}
+	next = n / 3
+	m.RangeBetween(n/3, n/2, func(key, value int) bool {
+		if key != next {
+			t.Fatalf("expected '%v', got '%v'", next, key)
+		}
+		next++
+		return true
+	})
+	if next != n/2 {
+		t.Fatalf("expected '%v', got '%v'", n/2, next)
+	}
+}
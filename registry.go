@@ -0,0 +1,55 @@
+package shardmap
+
+import (
+	"net/http"
+	"sync"
+)
+
+// Registered is the part of the Map API not depending on its key and value
+// types, through which the maps of the registry are enumerated.
+type Registered interface {
+	Len() int
+	NumShards() int
+	Stats() Stats
+	Handler(sampleKeys bool) http.Handler
+}
+
+var registry struct {
+	sync.RWMutex
+	maps map[string]Registered
+}
+
+// Register adds a map to the process-global registry under name, so that
+// debug handlers, metrics collectors and admin tools can enumerate the maps
+// of the process with Registry. Like expvar.Publish, it panics if name is
+// already registered.
+func Register(name string, m Registered) {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.maps[name]; ok {
+		panic("shardmap: Register called twice for " + name)
+	}
+	if registry.maps == nil {
+		registry.maps = make(map[string]Registered)
+	}
+	registry.maps[name] = m
+}
+
+// Unregister removes the map registered under name from the registry, when
+// it's closed for instance.
+func Unregister(name string) {
+	registry.Lock()
+	delete(registry.maps, name)
+	registry.Unlock()
+}
+
+// Registry returns a copy of the registry, the maps by their names.
+func Registry() map[string]Registered {
+	registry.RLock()
+	defer registry.RUnlock()
+	maps := make(map[string]Registered, len(registry.maps))
+	for name, m := range registry.maps {
+		maps[name] = m
+	}
+	return maps
+}
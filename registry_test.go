@@ -0,0 +1,33 @@
+package shardmap
+
+import (
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	a := New[int, int](0)
+	b := New[string, []byte](0)
+	a.Set(1, 1)
+	Register("test.a", a)
+	Register("test.b", b)
+	defer Unregister("test.b")
+	maps := Registry()
+	if maps["test.a"] != Registered(a) || maps["test.b"] != Registered(b) {
+		t.Fatalf("expected the maps to be registered, got '%v'", maps)
+	}
+	if n := maps["test.a"].Len(); n != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, n)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expected registering a name twice to panic")
+			}
+		}()
+		Register("test.a", b)
+	}()
+	Unregister("test.a")
+	if _, ok := Registry()["test.a"]; ok {
+		t.Fatalf("expected '%v', got '%v'", false, ok)
+	}
+}
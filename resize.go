@@ -0,0 +1,153 @@
+package shardmap
+
+import (
+	"sync/atomic"
+)
+
+// resizeStep is the number of buckets migrated by every mutation of a shard
+// resizing incrementally. It's large enough for migrations to complete long
+// before the new buckets fill up at the usual load factors.
+const resizeStep = 16
+
+// WithIncrementalResize makes shards resize incrementally when they grow or
+// shrink: the entries stay in the previous buckets, and are migrated to the new
+// ones a few at a time by the mutations which follow, so that no single Set
+// pays for rehashing a whole shard. Lookups probe both tables meanwhile.
+// Grow and Compact still resize at once.
+func WithIncrementalResize[K comparable, V any]() Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.lazy = true
+	}
+}
+
+// WithBackgroundResize makes shards resize incrementally like
+// WithIncrementalResize, but hands the migrations over to a background
+// goroutine which moves the entries a slice at a time under the shard lock,
+// until the map is closed. Writers only pay for migrating the keys they
+// access, or for the rest of a migration which lags behind a second resize.
+func WithBackgroundResize[K comparable, V any]() Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.lazy = true
+		m.kick = make(chan struct{}, 1)
+	}
+}
+
+// rehash resizes the shard to newCap like resize, but incrementally when
+// conf.lazy is set: the current buckets become the old table, which is
+// migrated by step.
+func (m *shard[K, V]) rehash(newCap int) {
+	if !m.conf.lazy {
+		m.resize(newCap)
+		return
+	}
+	m.settle()
+	old := &shard[K, V]{
+		buckets:  m.buckets,
+		metas:    m.metas,
+		bloom:    m.bloom,
+		cap:      len(m.buckets),
+		length:   m.length,
+		cost:     m.cost,
+		mask:     m.mask,
+		shrinkAt: -1,
+	}
+	var nmap shard[K, V]
+	nmap.conf = m.conf
+	nmap.init(newCap)
+	if m.metas != nil && nmap.metas == nil {
+		nmap.metas = make([]meta, len(nmap.buckets))
+	}
+	// the indexes are by key, so they hold for both tables
+	nmap.indexes = m.indexes
+	nmap.length, nmap.cost = m.length, m.cost
+	nmap.cap, nmap.dropped, nmap.resizes, nmap.ops = m.cap, m.dropped, m.resizes+1, m.ops
+	// readers keep using the old bloom until the migration completes
+	nmap.filter = m.filter
+	nmap.old = old
+	*m = nmap
+	if m.conf.kick != nil {
+		select {
+		case m.conf.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// step migrates up to n buckets of the old table, in order, then drops the old
+// table once it's empty. The buckets before the migrated ones stay empty, as
+// removals from the old table only shift entries backward down to the removed
+// one.
+func (m *shard[K, V]) step(n int) {
+	old := m.old
+	for ; n > 0 && old.length > 0; n-- {
+		if int(old.buckets[m.migrated].hdib&maxDIB) == 0 {
+			m.migrated++
+		} else {
+			m.migrate(m.migrated)
+		}
+	}
+	if old.length == 0 {
+		m.old, m.migrated = nil, 0
+		if m.filter != nil {
+			m.filter.store(m.bloom)
+		}
+	}
+}
+
+// settle completes the migration of the old table, if any.
+func (m *shard[K, V]) settle() {
+	if m.old != nil {
+		m.step(len(m.old.buckets) + m.old.length)
+	}
+}
+
+// migrate moves the entry at bucket j of the old table to the buckets, or
+// drops it when it has expired.
+func (m *shard[K, V]) migrate(j int) {
+	old := m.old
+	e, md := old.buckets[j], meta{}
+	if old.metas != nil {
+		md = old.metas[j]
+	}
+	old.remove(j)
+	m.length--
+	m.cost -= md.cost
+	if md.expired(new(int64)) {
+		m.dropEntry(e.key, e.value, ReasonExpired)
+		if m.indexes != nil {
+			m.indexDel(e.key, e.value)
+		}
+		return
+	}
+	m.set(int(e.hdib>>dibBitSize), e.key, e.value, md, true)
+}
+
+// backgroundStep is the number of buckets migrated by the background resizer
+// per shard lock.
+const backgroundStep = 256
+
+func (m *Map[K, V]) runResizer(done <-chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-m.kick:
+		}
+		for busy := true; busy; {
+			busy = false
+			for i := 0; i < len(m.mus); i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				m.mus[i].Lock()
+				if s := &m.shards[i]; s.old != nil && atomic.LoadUint32(&m.state) != stateClosed {
+					s.step(backgroundStep)
+					busy = busy || s.old != nil
+				}
+				m.unlock(i, 0)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package shardmap
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestIncrementalResize(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](2), WithIncrementalResize[int, int](),
+		WithBloomFilter[int, int](), WithIndex[int, int]("mod", func(v int) string { return k(v % 3) }))
+	m.SetDebugLevel(DebugVerify)
+	ref := make(map[int]int)
+	var migrating bool
+	for i := 0; i < 20000; i++ {
+		key := rand.Intn(5000)
+		switch rand.Intn(4) {
+		case 0, 1:
+			m.Set(key, i)
+			ref[key] = i
+		case 2:
+			m.SetWithTTL(key, i, time.Hour)
+			ref[key] = i
+		case 3:
+			m.Delete(key)
+			delete(ref, key)
+		}
+		if m.shards[0].old != nil {
+			migrating = true
+		}
+		if i%1000 == 0 {
+			for key, want := range ref {
+				if v, ok := m.Get(key); !ok || v != want {
+					t.Fatalf("expected '%v', got '%v'", want, v)
+				}
+			}
+		}
+	}
+	if !migrating {
+		t.Fatalf("expected shards to resize incrementally")
+	}
+	if n := m.Len(); n != len(ref) {
+		t.Fatalf("expected '%v', got '%v'", len(ref), n)
+	}
+	var n int
+	m.Range(func(key, value int) bool {
+		if ref[key] != value {
+			t.Fatalf("expected '%v', got '%v'", ref[key], value)
+		}
+		n++
+		return true
+	})
+	if n != len(ref) {
+		t.Fatalf("expected '%v', got '%v'", len(ref), n)
+	}
+	var indexed int
+	for _, ik := range []string{k(0), k(1), k(2)} {
+		indexed += len(m.GetByIndex("mod", ik))
+	}
+	if indexed != len(ref) {
+		t.Fatalf("expected '%v', got '%v'", len(ref), indexed)
+	}
+	if c := m.Clone(); c.Len() != len(ref) || c.shards[0].old != nil {
+		t.Fatalf("expected '%v', got '%v'", len(ref), c.Len())
+	}
+	m.DeleteFunc(func(key, value int) bool { return true })
+	if n := m.Len(); n != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, n)
+	}
+}
+
+func TestIncrementalResizeStep(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](1), WithIncrementalResize[int, int]())
+	s := &m.shards[0]
+	for i := 0; s.old == nil; i++ {
+		m.Set(i, i)
+	}
+	if len(s.buckets) != 2*len(s.old.buckets) || s.old.length == 0 {
+		t.Fatalf("expected a pending migration")
+	}
+	for i := 0; s.old != nil; i++ {
+		m.Delete(-1)
+	}
+	for i := 0; i < s.length; i++ {
+		if v, ok := m.Get(i); !ok || v != i {
+			t.Fatalf("expected '%v', got '%v'", i, v)
+		}
+	}
+}
+
+func BenchmarkIncrementalResizeSet(b *testing.B) {
+	m := New[int, int](0, WithIncrementalResize[int, int]())
+	for i := 0; i < b.N; i++ {
+		m.Set(i, i)
+	}
+}
+
+func TestBackgroundResize(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](4), WithBackgroundResize[int, int]())
+	defer m.Close()
+	deleted := make(map[int]bool)
+	for i := 0; i < 100000; i++ {
+		m.Set(i, i)
+		if i%3 == 0 {
+			m.Delete(i / 2)
+			deleted[i/2] = true
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for i := 0; i < len(m.mus); i++ {
+		m.mus[i].Lock()
+		old := m.shards[i].old
+		m.mus[i].Unlock()
+		if old != nil {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected shard %d to be migrated", i)
+			}
+			time.Sleep(time.Millisecond)
+			i--
+		}
+	}
+	m.SetDebugLevel(DebugVerify)
+	for i := 0; i < 100000; i++ {
+		_, ok := m.Get(i)
+		if want := !deleted[i]; ok != want {
+			t.Fatalf("expected '%v', got '%v' for %d", want, ok, i)
+		}
+	}
+	m.Set(-1, -1)
+}
@@ -0,0 +1,100 @@
+package shardmap
+
+import (
+	"reflect"
+	"sync/atomic"
+)
+
+// WithOptimisticReads makes Get and Peek read shards optimistically, without
+// taking the shard lock: every write lock bumps a sequence counter of the shard
+// and readers retry under the read lock when it changed while they were
+// probing. Racy reads of an entry can only be told apart from torn ones after
+// the fact, so the option is ignored unless K and V hold no pointers, for maps
+// bounded by WithLRU or WithMaxCost, and under the race detector.
+func WithOptimisticReads[K comparable, V any]() Option[K, V] {
+	return func(m *Map[K, V]) {
+		var key K
+		var value V
+		m.seqlock = !raceEnabled &&
+			!hasPointers(reflect.TypeOf(&key).Elem()) && !hasPointers(reflect.TypeOf(&value).Elem())
+	}
+}
+
+// hasPointers reports whether values of type t hold pointers.
+func hasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Array:
+		return t.Len() > 0 && hasPointers(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasPointers(t.Field(i).Type) {
+				return true
+			}
+		}
+		return false
+	case reflect.Ptr, reflect.UnsafePointer, reflect.String, reflect.Slice,
+		reflect.Map, reflect.Chan, reflect.Func, reflect.Interface:
+		return true
+	}
+	return false
+}
+
+// Lock write locks the shard, and makes the sequence odd for optimistic
+// readers.
+func (mu *syncRWMutex) Lock() {
+	if mu.spin {
+		mu.spinLock()
+	} else {
+		mu.RWMutex.Lock()
+	}
+	if mu.optimistic {
+		atomic.AddUint32(&mu.seq, 1)
+	}
+}
+
+// Unlock makes the sequence even again, and write unlocks the shard.
+func (mu *syncRWMutex) Unlock() {
+	if mu.optimistic {
+		atomic.AddUint32(&mu.seq, 1)
+	}
+	if mu.spin {
+		mu.spinUnlock()
+	} else {
+		mu.RWMutex.Unlock()
+	}
+}
+
+// getOptimistic looks up a key in shard i without locking it. The result is
+// only valid when the shard was not written meanwhile, otherwise the caller
+// must look it up again under the read lock.
+func (m *Map[K, V]) getOptimistic(i int, hash uint64, key K) (value V, ok, valid bool) {
+	mu := &m.mus[i]
+	seq := atomic.LoadUint32(&mu.seq)
+	if seq&1 != 0 {
+		return
+	}
+	// the slices are checked before use, lest a resize tears them
+	s := &m.shards[i]
+	buckets, metas, migrating := s.buckets, s.metas, s.old != nil
+	if atomic.LoadUint32(&mu.seq) != seq || migrating || len(buckets) == 0 {
+		return
+	}
+	h := int(hash >> dibBitSize)
+	mask := len(buckets) - 1
+	var now int64
+	for j, n := h&mask, 0; n < len(buckets); j, n = (j+1)&mask, n+1 {
+		e := buckets[j]
+		if int(e.hdib&maxDIB) == 0 {
+			break
+		}
+		if int(e.hdib>>dibBitSize) == h && e.key == key {
+			if metas != nil && metas[j].expired(&now) {
+				// leave the removal to the locked path
+				return value, false, false
+			}
+			value, ok = e.value, true
+			break
+		}
+	}
+	return value, ok, atomic.LoadUint32(&mu.seq) == seq
+}
@@ -0,0 +1,72 @@
+package shardmap
+
+import (
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestOptimisticReads(t *testing.T) {
+	if unsafe.Sizeof(syncRWMutex{}) != 64 {
+		t.Fatalf("expected '%v', got '%v'", 64, unsafe.Sizeof(syncRWMutex{}))
+	}
+	type pair struct{ a, b int }
+	m := New[int, pair](0, WithShards[int, pair](2), WithOptimisticReads[int, pair]())
+	if !raceEnabled && !m.mus[0].optimistic {
+		t.Fatalf("expected optimistic reads")
+	}
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if v, ok := m.Get(i % 5000); ok && v.a != v.b {
+					t.Errorf("torn read %v", v)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 50000; i++ {
+		m.Set(i%5000, pair{i, i})
+		if i%7 == 0 {
+			m.Delete(i % 5000)
+		}
+	}
+	close(done)
+	wg.Wait()
+	m.SetWithTTL(-1, pair{}, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, ok := m.Peek(-1); ok {
+		t.Fatalf("expected '%v' to be expired", -1)
+	}
+	if v, ok := m.Get(4999); !ok || v.a != 49999 {
+		t.Fatalf("expected '%v', got '%v'", 49999, v.a)
+	}
+	if s := New[string, int](0, WithOptimisticReads[string, int]()); s.mus[0].optimistic {
+		t.Fatalf("expected no optimistic reads of string keys")
+	}
+}
+
+func BenchmarkOptimisticGet(b *testing.B) {
+	m := New[int, int](0, WithOptimisticReads[int, int]())
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			m.Get(i % 1000)
+			i++
+		}
+	})
+}
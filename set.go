@@ -0,0 +1,71 @@
+package shardmap
+
+// Set is a set of keys, backed by a Map without values.
+//
+// The zero value is not safe for use; use NewSet.
+type Set[K comparable] struct {
+	m *Map[K, struct{}]
+}
+
+// NewSet returns a new Set with the specified capacity.
+func NewSet[K comparable](cap int, opts ...Option[K, struct{}]) *Set[K] {
+	return &Set[K]{m: New[K, struct{}](cap, opts...)}
+}
+
+// Map returns the underlying Map.
+func (s *Set[K]) Map() *Map[K, struct{}] {
+	return s.m
+}
+
+// Add adds a key to the set.
+// Returns false when the key was already present.
+func (s *Set[K]) Add(key K) bool {
+	return s.m.SetIfAbsent(key, struct{}{})
+}
+
+// Contains reports whether a key is in the set.
+func (s *Set[K]) Contains(key K) bool {
+	_, ok := s.m.Get(key)
+	return ok
+}
+
+// Remove removes a key from the set.
+// Returns false when the key was absent.
+func (s *Set[K]) Remove(key K) bool {
+	_, ok := s.m.Delete(key)
+	return ok
+}
+
+// Len returns the number of keys in the set.
+func (s *Set[K]) Len() int {
+	return s.m.Len()
+}
+
+// Range iterates over all keys.
+// It's not safe to call Add or Remove while ranging.
+func (s *Set[K]) Range(iter func(key K) bool) {
+	s.m.Range(func(key K, _ struct{}) bool {
+		return iter(key)
+	})
+}
+
+// Clear removes all keys from the set.
+func (s *Set[K]) Clear() {
+	s.m.Clear()
+}
+
+// Union returns a new set holding the keys of both sets.
+func (s *Set[K]) Union(other *Set[K]) *Set[K] {
+	u := &Set[K]{m: s.m.Clone()}
+	u.m.Merge(other.m, nil)
+	return u
+}
+
+// Intersect returns a new set holding the keys present in both sets.
+func (s *Set[K]) Intersect(other *Set[K]) *Set[K] {
+	i := &Set[K]{m: s.m.Clone()}
+	i.m.DeleteFunc(func(key K, _ struct{}) bool {
+		return !other.Contains(key)
+	})
+	return i
+}
@@ -0,0 +1,38 @@
+package shardmap
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestSet(t *testing.T) {
+	a, b := NewSet[int](0), NewSet[int](0)
+	for i := 0; i < 100; i++ {
+		if !a.Add(i) {
+			t.Fatalf("expected '%v' to be added", i)
+		}
+		b.Add(i + 50)
+	}
+	if a.Add(0) || !a.Contains(0) || a.Contains(100) {
+		t.Fatalf("unexpected membership")
+	}
+	if n := a.Union(b).Len(); n != 150 {
+		t.Fatalf("expected '%v', got '%v'", 150, n)
+	}
+	i := a.Intersect(b)
+	if n := i.Len(); n != 50 {
+		t.Fatalf("expected '%v', got '%v'", 50, n)
+	}
+	i.Range(func(key int) bool {
+		if key < 50 || key >= 100 {
+			t.Fatalf("unexpected key '%v'", key)
+		}
+		return true
+	})
+	if !a.Remove(0) || a.Remove(0) || a.Len() != 99 {
+		t.Fatalf("expected '%v', got '%v'", 99, a.Len())
+	}
+	if size := unsafe.Sizeof(entry[int, struct{}]{}); size != 16 {
+		t.Fatalf("expected '%v', got '%v'", 16, size)
+	}
+}
@@ -4,33 +4,116 @@
 
 package shardmap
 
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
 const (
-	loadFactor  = 0.85                      // must be above 50%
+	loadFactor  = 0.85                      // default, must be above 50%
 	dibBitSize  = 16                        // 0xFFFF
 	hashBitSize = 64 - dibBitSize           // 0xFFFFFFFFFFFF
 	maxHash     = ^uint64(0) >> dibBitSize  // max 28,147,497,671,0655
 	maxDIB      = ^uint64(0) >> hashBitSize // max 65,535
+	largeEntry  = 128                       // bytes, above which runs are moved with one copy
 )
 
+// entry keeps the value before the key, so that a zero size value as in Set
+// does not pad the entry.
 type entry[K comparable, V any] struct {
 	hdib  uint64 // bitfield { hash:48 dib:16 }
-	key   K      // user key
 	value V      // user value
+	key   K      // user key
+}
+
+// meta is the metadata of an entry, kept in a slice parallel to the buckets
+// which is only allocated once an entry of the shard needs it.
+type meta struct {
+	expire int64 // deadline in clock nanoseconds, 0 means never
+	access int64 // last access in clock nanoseconds, when evicting
+	cost   int64 // cost of the entry, when bounded by cost
+	stamp  int64 // last write in unix nanoseconds, when stamping versions
+}
+
+// eviction is an entry removed from a shard, or set when reason is 0,
+// reported once it's unlocked.
+type eviction[K comparable, V any] struct {
+	key      K
+	value    V
+	reason   EvictReason
+	replaced bool // a value was replaced, when set
+}
+
+// expired reports whether the entry expired at now, which is read lazily.
+func (md *meta) expired(now *int64) bool {
+	if md.expire == 0 {
+		return false
+	}
+	if *now == 0 {
+		*now = clock()
+	}
+	return md.expire <= *now
 }
 
 // Map is a hashmap. Like map[comparable]any
 type shard[K comparable, V any] struct {
 	buckets  []entry[K, V]
+	metas    []meta
+	dropped  []eviction[K, V] // entries removed when conf.notify is set, or set when conf.watch is
+	conf     shardConf[K, V]
+	cost     int64                       // total cost of the entries, when bounded by cost
+	indexes  []map[string]map[K]struct{} // keys by index key, for conf.index
+	bloom    *bloom                      // filter of the hashes, when conf.bloom
+	filter   *filter                     // where bloom is published to readers
+	old      *shard[K, V]                // table being migrated, when resizing incrementally
+	migrated int                         // buckets of old already migrated
 	cap      int
 	length   int
 	mask     int
 	growAt   int
 	shrinkAt int
+	resizes  int
+	ops      shardOps
+}
+
+// shardOps counts the mutations of a shard.
+type shardOps struct {
+	sets        uint64
+	deletes     uint64
+	evictions   uint64
+	expirations uint64
+	touches     uint64 // deadlines changed in place, not in Stats
+}
+
+// shardConf holds the settings of a shard which are inherited on resize.
+type shardConf[K comparable, V any] struct {
+	notify  bool                       // record removed entries
+	watch   bool                       // record set entries too
+	stamp   bool                       // stamp entries with their last write
+	limit   int                        // max number of entries, 0 means unbounded
+	maxCost int64                      // max total cost of entries, 0 means unbounded
+	grow    float64                    // load factor at which the shard grows
+	shrink  float64                    // load factor at which the shard shrinks, 0 means never
+	cost    func(key K, value V) int64 // cost of an entry, when maxCost is set
+	index   []func(value V) string     // secondary indexes
+	bloom   bool
+	rng     wyhash_RNG
+	lazy    bool          // resize incrementally
+	kick    chan struct{} // wakes up the background resizer, when set
+	intern  func(key K) K // interns the new keys, when set
+}
+
+// evicts reports whether the shard evicts entries, which needs their metas.
+func (c *shardConf[K, V]) evicts() bool {
+	return c.limit > 0 || c.maxCost > 0
 }
 
 func (m *shard[K, V]) init(cap int) {
 	m.cap = cap
 	m.length = 0
+	m.cost = 0
 	sz := 8
 	for sz < m.cap {
 		sz *= 2
@@ -39,22 +122,144 @@ func (m *shard[K, V]) init(cap int) {
 		m.cap = sz
 	}
 	m.buckets = make([]entry[K, V], sz)
+	m.indexes = nil
+	if len(m.conf.index) > 0 {
+		m.indexes = make([]map[string]map[K]struct{}, len(m.conf.index))
+		for j := range m.indexes {
+			m.indexes[j] = make(map[string]map[K]struct{})
+		}
+	}
+	m.bloom = nil
+	if m.conf.bloom {
+		m.bloom = newBloom(sz)
+	}
+	if m.filter != nil {
+		m.filter.store(m.bloom)
+	}
+	m.old, m.migrated = nil, 0
+	m.metas = nil
+	if m.conf.evicts() || m.conf.stamp {
+		m.metas = make([]meta, sz)
+	}
 	m.mask = len(m.buckets) - 1
-	m.growAt = int(float64(len(m.buckets)) * loadFactor)
-	m.shrinkAt = int(float64(len(m.buckets)) * (1 - loadFactor))
+	m.growAt = int(float64(len(m.buckets)) * m.conf.grow)
+	if m.growAt < 1 {
+		m.growAt = 1
+	}
+	m.shrinkAt = int(float64(len(m.buckets)) * m.conf.shrink)
+	if m.conf.shrink == 0 {
+		m.shrinkAt = -1
+	}
+}
+
+// reset removes all entries like init, but zeroes the buckets in place
+// instead of allocating new ones. The entries of a resize in progress are
+// dropped along with the previous buckets.
+func (m *shard[K, V]) reset() {
+	for i := range m.buckets {
+		m.buckets[i] = entry[K, V]{}
+	}
+	for i := range m.metas {
+		m.metas[i] = meta{}
+	}
+	m.length = 0
+	m.cost = 0
+	m.old, m.migrated = nil, 0
+	for _, index := range m.indexes {
+		for ik := range index {
+			delete(index, ik)
+		}
+	}
+	if m.bloom != nil {
+		for i := range m.bloom.words {
+			atomic.StoreUint64(&m.bloom.words[i], 0)
+		}
+	}
+	if m.filter != nil {
+		m.filter.store(m.bloom)
+	}
+}
+
+// sizeFor returns the capacity which holds n entries without growing.
+func (m *shard[K, V]) sizeFor(n int) int {
+	return int(float64(n)/m.conf.grow) + 1
 }
 
 func (m *shard[K, V]) resize(newCap int) {
+	m.settle()
 	var nmap shard[K, V]
+	nmap.conf = m.conf
 	nmap.init(newCap)
-	for i := 0; i < len(m.buckets); i++ {
-		if int(m.buckets[i].hdib&maxDIB) > 0 {
-			nmap.set(int(m.buckets[i].hdib>>dibBitSize), m.buckets[i].key, m.buckets[i].value)
+	if m.metas == nil {
+		for i := 0; i < len(m.buckets); i++ {
+			if int(m.buckets[i].hdib&maxDIB) > 0 {
+				nmap.set(int(m.buckets[i].hdib>>dibBitSize), m.buckets[i].key, m.buckets[i].value, meta{}, true)
+			}
+		}
+	} else {
+		// expired entries are dropped along the way
+		var now int64
+		if nmap.metas == nil {
+			nmap.metas = make([]meta, len(nmap.buckets))
 		}
+		for i := 0; i < len(m.buckets); i++ {
+			if int(m.buckets[i].hdib&maxDIB) == 0 {
+				continue
+			}
+			if m.metas[i].expired(&now) {
+				m.drop(i, ReasonExpired)
+				continue
+			}
+			nmap.set(int(m.buckets[i].hdib>>dibBitSize), m.buckets[i].key, m.buckets[i].value, m.metas[i], true)
+		}
+	}
+	nmap.cap, nmap.dropped, nmap.resizes, nmap.ops = m.cap, m.dropped, m.resizes+1, m.ops
+	// the new bloom is published once complete, lest readers miss keys
+	nmap.filter = m.filter
+	if nmap.filter != nil {
+		nmap.filter.store(nmap.bloom)
 	}
-	cap := m.cap
 	*m = nmap
-	m.cap = cap
+}
+
+// Clone returns a copy of the shard sharing no memory with it.
+func (m *shard[K, V]) Clone() shard[K, V] {
+	c := *m
+	c.buckets = make([]entry[K, V], len(m.buckets))
+	copy(c.buckets, m.buckets)
+	if m.metas != nil {
+		c.metas = make([]meta, len(m.metas))
+		for i := range m.metas {
+			c.metas[i] = m.metas[i]
+			c.metas[i].access = atomic.LoadInt64(&m.metas[i].access)
+		}
+	}
+	if m.indexes != nil {
+		c.indexes = make([]map[string]map[K]struct{}, len(m.indexes))
+		for j := range m.indexes {
+			c.indexes[j] = make(map[string]map[K]struct{}, len(m.indexes[j]))
+			for ik, keys := range m.indexes[j] {
+				c.indexes[j][ik] = make(map[K]struct{}, len(keys))
+				for key := range keys {
+					c.indexes[j][ik][key] = struct{}{}
+				}
+			}
+		}
+	}
+	if m.bloom != nil {
+		c.bloom = &bloom{words: make([]uint64, len(m.bloom.words)), mask: m.bloom.mask}
+		for i := range m.bloom.words {
+			c.bloom.words[i] = atomic.LoadUint64(&m.bloom.words[i])
+		}
+	}
+	c.filter = nil
+	c.dropped = nil
+	if m.old != nil {
+		old := m.old.Clone()
+		c.old = &old
+		c.settle()
+	}
+	return c
 }
 
 // Set assigns a value to a key.
@@ -64,50 +269,276 @@ func (m *shard[K, V]) Set(xxh uint64, key K, value V) (V, bool) {
 		m.init(0)
 	}
 	if m.length >= m.growAt {
-		m.resize(len(m.buckets) * 2)
+		m.rehash(len(m.buckets) * 2)
+	}
+	return m.insert(int(xxh>>dibBitSize), key, value, meta{}, true)
+}
+
+// SetMeta assigns a value and its metadata to a key.
+// Returns the previous value, or false when no value was assigned.
+func (m *shard[K, V]) SetMeta(xxh uint64, key K, value V, md meta) (V, bool) {
+	if len(m.buckets) == 0 {
+		m.init(0)
+	}
+	if m.length >= m.growAt {
+		m.rehash(len(m.buckets) * 2)
+	}
+	if m.metas == nil {
+		m.metas = make([]meta, len(m.buckets))
+	}
+	return m.insert(int(xxh>>dibBitSize), key, value, md, true)
+}
+
+// GetOrSet returns the existing value for a key, or assigns the value when
+// the key is absent. Returns true when the value was loaded.
+func (m *shard[K, V]) GetOrSet(xxh uint64, key K, value V) (V, bool) {
+	if len(m.buckets) == 0 {
+		m.init(0)
+	}
+	if m.length >= m.growAt {
+		m.rehash(len(m.buckets) * 2)
+	}
+	return m.insert(int(xxh>>dibBitSize), key, value, meta{}, false)
+}
+
+// insert sets a key like set, then evicts entries while the shard is over
+// its limits.
+func (m *shard[K, V]) insert(hash int, key K, value V, md meta, replace bool) (prev V, ok bool) {
+	if m.old != nil && m.conf.kick == nil {
+		m.step(resizeStep)
+	}
+	if m.old != nil {
+		if j := m.old.lookup(uint64(hash)<<dibBitSize, key); j >= 0 {
+			m.migrate(j)
+		}
+	}
+	if m.conf.evicts() && md.access == 0 {
+		md.access = clock()
+	}
+	if m.conf.stamp && md.stamp == 0 {
+		md.stamp = time.Now().UnixNano()
 	}
-	return m.set(int(xxh>>dibBitSize), key, value)
+	if m.conf.cost != nil {
+		md.cost = m.conf.cost(key, value)
+	}
+	if m.conf.intern != nil && m.lookup(uint64(hash)<<dibBitSize, key) < 0 {
+		key = m.conf.intern(key)
+	}
+	prev, ok = m.set(hash, key, value, md, replace)
+	if replace || !ok {
+		m.changed(key, value, ok)
+	}
+	m.shed()
+	return prev, ok
 }
 
-func (m *shard[K, V]) set(hash int, key K, value V) (prev V, ok bool) {
-	e := entry[K, V]{uint64(hash)<<dibBitSize | uint64(1)&maxDIB, key, value}
+// replace assigns a value to the live entry at bucket i, then evicts entries
+// while the shard is over its cost budget.
+func (m *shard[K, V]) replace(i int, value V) {
+	if m.indexes != nil {
+		m.indexDel(m.buckets[i].key, m.buckets[i].value)
+		m.indexAdd(m.buckets[i].key, value)
+	}
+	m.buckets[i].value = value
+	if m.conf.stamp {
+		m.metas[i].stamp = time.Now().UnixNano()
+	}
+	m.changed(m.buckets[i].key, value, true)
+	if m.conf.cost != nil {
+		cost := m.conf.cost(m.buckets[i].key, value)
+		m.cost += cost - m.metas[i].cost
+		m.metas[i].cost = cost
+		m.shed()
+	}
+}
+
+// update calls fn with the value of the live entry at bucket i to modify it in
+// place.
+func (m *shard[K, V]) update(i int, fn func(value *V)) {
+	if m.indexes != nil {
+		m.indexDel(m.buckets[i].key, m.buckets[i].value)
+	}
+	fn(&m.buckets[i].value)
+	m.updated(i)
+}
+
+// updated accounts for the value of the live entry at bucket i modified in
+// place, whose index keys were removed beforehand, then evicts entries while
+// the shard is over its cost budget.
+func (m *shard[K, V]) updated(i int) {
+	e := &m.buckets[i]
+	if m.indexes != nil {
+		m.indexAdd(e.key, e.value)
+	}
+	if m.conf.stamp {
+		m.metas[i].stamp = time.Now().UnixNano()
+	}
+	m.changed(e.key, e.value, true)
+	if m.conf.cost != nil {
+		cost := m.conf.cost(e.key, e.value)
+		m.cost += cost - m.metas[i].cost
+		m.metas[i].cost = cost
+		m.shed()
+	}
+}
+
+// touch sets the deadline of the live entry at bucket i in place.
+func (m *shard[K, V]) touch(i int, expire int64) {
+	m.metas[i].expire = expire
+	m.ops.touches++
+}
+
+// changed records a value set to key, replacing a value or not.
+func (m *shard[K, V]) changed(key K, value V, replaced bool) {
+	m.ops.sets++
+	if m.conf.watch {
+		m.dropped = append(m.dropped, eviction[K, V]{key: key, value: value, replaced: replaced})
+	}
+}
+
+// shed evicts entries while the shard is over its limits.
+func (m *shard[K, V]) shed() {
+	for m.length > 0 && (m.conf.limit > 0 && m.length > m.conf.limit ||
+		m.conf.maxCost > 0 && m.cost > m.conf.maxCost) {
+		m.evict()
+	}
+}
+
+func (m *shard[K, V]) set(hash int, key K, value V, md meta, replace bool) (prev V, ok bool) {
+	e := entry[K, V]{hdib: uint64(hash)<<dibBitSize | uint64(1)&maxDIB, key: key, value: value}
 	i := int(e.hdib>>dibBitSize) & m.mask
+	cost := md.cost
+	large := unsafe.Sizeof(e) > largeEntry
+	var now int64
 	for {
-		if int(m.buckets[i].hdib&maxDIB) == 0 {
+		if int(m.buckets[i].hdib&maxDIB) == 0 || large && int(m.buckets[i].hdib&maxDIB) < int(e.hdib&maxDIB) {
+			if int(m.buckets[i].hdib&maxDIB) != 0 {
+				// rather than swapping a large entry through every bucket
+				// of the run, the run moves one bucket forward at once
+				m.shift(i)
+			}
 			m.buckets[i] = e
+			if m.metas != nil {
+				m.metas[i] = md
+			}
 			m.length++
+			m.cost += cost
+			if m.indexes != nil {
+				m.indexAdd(key, value)
+			}
+			if m.bloom != nil {
+				m.bloom.add(hash)
+				if m.old != nil {
+					m.old.bloom.add(hash) // still published
+				}
+			}
 			return
 		}
 		if int(e.hdib>>dibBitSize) == int(m.buckets[i].hdib>>dibBitSize) && e.key == m.buckets[i].key {
+			if m.metas != nil && m.metas[i].expired(&now) {
+				// an expired entry is overwritten as if it was absent
+				m.drop(i, ReasonExpired)
+				if m.indexes != nil {
+					m.indexDel(key, m.buckets[i].value)
+					m.indexAdd(key, value)
+				}
+				m.buckets[i].value = e.value
+				m.cost += cost - m.metas[i].cost
+				m.metas[i] = md
+				return
+			}
 			old := m.buckets[i].value
-			m.buckets[i].value = e.value
+			if replace {
+				if m.indexes != nil {
+					m.indexDel(key, old)
+					m.indexAdd(key, value)
+				}
+				m.buckets[i].value = e.value
+				if m.metas != nil {
+					m.cost += cost - m.metas[i].cost
+					m.metas[i] = md
+				}
+			}
 			return old, true
 		}
 		if int(m.buckets[i].hdib&maxDIB) < int(e.hdib&maxDIB) {
 			e, m.buckets[i] = m.buckets[i], e
+			if m.metas != nil {
+				md, m.metas[i] = m.metas[i], md
+			}
 		}
 		i = (i + 1) & m.mask
 		e.hdib = e.hdib>>dibBitSize<<dibBitSize | uint64(int(e.hdib&maxDIB)+1)&maxDIB
 	}
 }
 
-// Get returns a value for a key.
+// Get returns a value for a key, touch records the access for eviction.
 // Returns false when no value has been assign for key.
-func (m *shard[K, V]) Get(xxh uint64, key K) (prev V, ok bool) {
-	if len(m.buckets) == 0 {
-		return
+func (m *shard[K, V]) Get(xxh uint64, key K, touch bool) (prev V, ok bool) {
+	prev, ok, _ = m.fetch(xxh, key, touch)
+	return prev, ok
+}
+
+// fetch returns the value of a key like Get, also reporting whether the key
+// is present but expired, so that it can be removed.
+func (m *shard[K, V]) fetch(xxh uint64, key K, touch bool) (value V, ok, expired bool) {
+	p, expired := m.ref(xxh, key, touch)
+	if p != nil {
+		return *p, true, false
 	}
-	hash := int(xxh >> dibBitSize)
-	i := hash & m.mask
-	for {
-		if int(m.buckets[i].hdib&maxDIB) == 0 {
-			return
+	return value, false, expired
+}
+
+// ref returns a pointer to the value of a key in the buckets, or nil when
+// the key is absent, touch records the access for eviction. Expired is true
+// when the key is present but expired.
+func (m *shard[K, V]) ref(xxh uint64, key K, touch bool) (p *V, expired bool) {
+	t, i := m.where(xxh, key)
+	if i < 0 {
+		return nil, false
+	}
+	if t.metas != nil {
+		var now int64
+		if t.metas[i].expired(&now) {
+			return nil, true
 		}
-		if int(m.buckets[i].hdib>>dibBitSize) == hash && m.buckets[i].key == key {
-			return m.buckets[i].value, true
+		if touch && m.conf.evicts() {
+			if now == 0 {
+				now = clock()
+			}
+			// readers only hold the read lock
+			atomic.StoreInt64(&t.metas[i].access, now)
 		}
-		i = (i + 1) & m.mask
 	}
+	return &t.buckets[i].value, false
+}
+
+// where returns the table holding a key, the buckets or the old buckets being
+// migrated, and its bucket index, or -1 when the key is absent. Unlike index
+// it doesn't migrate the key, for readers.
+func (m *shard[K, V]) where(xxh uint64, key K) (*shard[K, V], int) {
+	t, i := m, m.lookup(xxh, key)
+	if i < 0 && m.old != nil {
+		t, i = m.old, m.old.lookup(xxh, key)
+	}
+	return t, i
+}
+
+// expireOf returns the expiry of a live key for readers, 0 when it never
+// expires.
+// Returns false when the key is absent.
+func (m *shard[K, V]) expireOf(xxh uint64, key K) (expire int64, ok bool) {
+	t, i := m.where(xxh, key)
+	if i < 0 {
+		return 0, false
+	}
+	if t.metas != nil {
+		if t.metas[i].expired(new(int64)) {
+			return 0, false
+		}
+		expire = t.metas[i].expire
+	}
+	return expire, true
 }
 
 // Len returns the number of values in map.
@@ -118,52 +549,407 @@ func (m *shard[K, V]) Len() int {
 // Delete deletes a value for a key.
 // Returns the deleted value, or false when no value was assigned.
 func (m *shard[K, V]) Delete(xxh uint64, key K) (v V, ok bool) {
-	if len(m.buckets) == 0 {
+	if m.old != nil && m.conf.kick == nil {
+		m.step(resizeStep)
+	}
+	i := m.index(xxh, key)
+	if i < 0 {
+		return
+	}
+	old := m.buckets[i].value
+	if m.metas != nil && m.metas[i].expired(new(int64)) {
+		m.drop(i, ReasonExpired)
+		m.remove(i)
+		return v, false
+	}
+	m.drop(i, ReasonDeleted)
+	m.remove(i)
+	return old, true
+}
+
+// merge assigns a value to a key, resolving a conflict with an existing value.
+func (m *shard[K, V]) merge(xxh uint64, key K, value V, resolve func(key K, a, b V) V) {
+	if i := m.find(xxh, key); i >= 0 {
+		if resolve != nil {
+			value = resolve(key, m.buckets[i].value, value)
+		}
+		m.replace(i, value)
 		return
 	}
+	m.Set(xxh, key, value)
+}
+
+// DeleteFunc deletes all key/values for which pred returns true, buf is used
+// as scratch space for the matching entries.
+// Returns the number of deleted values and buf.
+func (m *shard[K, V]) DeleteFunc(pred func(key K, value V) bool, buf []entry[K, V]) (int, []entry[K, V]) {
+	buf = m.appendMatches(pred, buf[:0])
+	for _, e := range buf {
+		if i := m.index(e.hdib>>dibBitSize<<dibBitSize, e.key); i >= 0 {
+			m.drop(i, ReasonDeleted)
+			m.remove(i)
+		}
+	}
+	return len(buf), buf
+}
+
+// UpdateWhere replaces the values for which pred returns true by the result
+// of fn, buf is used as scratch space.
+// Returns the number of updated values and buf.
+func (m *shard[K, V]) UpdateWhere(pred func(key K, value V) bool, fn func(key K, value V) V, buf []entry[K, V]) (int, []entry[K, V]) {
+	buf = m.appendMatches(pred, buf[:0])
+	n := 0
+	for _, e := range buf {
+		// entries may have been evicted by a previous update
+		if i := m.find(e.hdib>>dibBitSize<<dibBitSize, e.key); i >= 0 {
+			m.update(i, func(value *V) { *value = fn(e.key, *value) })
+			n++
+		}
+	}
+	return n, buf
+}
+
+// appendMatches appends the hashes and keys of the entries for which pred
+// returns true to buf.
+func (m *shard[K, V]) appendMatches(pred func(key K, value V) bool, buf []entry[K, V]) []entry[K, V] {
+	var now int64
+	for t := m; t != nil; t = t.old {
+		for i := 0; i < len(t.buckets); i++ {
+			if t.live(i, &now) && pred(t.buckets[i].key, t.buckets[i].value) {
+				buf = append(buf, entry[K, V]{hdib: t.buckets[i].hdib, key: t.buckets[i].key})
+			}
+		}
+	}
+	return buf
+}
+
+// find returns the bucket index of a key, or -1 when the key is absent or
+// expired.
+func (m *shard[K, V]) find(xxh uint64, key K) int {
+	i := m.index(xxh, key)
+	if i >= 0 && m.metas != nil && m.metas[i].expired(new(int64)) {
+		return -1
+	}
+	return i
+}
+
+// index returns the bucket index of a key, or -1 when the key is absent. A key
+// of the table being migrated is migrated first.
+func (m *shard[K, V]) index(xxh uint64, key K) int {
+	if m.old != nil {
+		if j := m.old.lookup(xxh, key); j >= 0 {
+			m.migrate(j)
+		}
+	}
+	return m.lookup(xxh, key)
+}
+
+// lookup returns the bucket index of a key in the buckets only, or -1 when the
+// key is absent.
+func (m *shard[K, V]) lookup(xxh uint64, key K) int {
+	if len(m.buckets) == 0 {
+		return -1
+	}
 	hash := int(xxh >> dibBitSize)
 	i := hash & m.mask
 	for {
 		if int(m.buckets[i].hdib&maxDIB) == 0 {
-			return
+			return -1
 		}
 		if int(m.buckets[i].hdib>>dibBitSize) == hash && m.buckets[i].key == key {
-			old := m.buckets[i].value
-			m.remove(i)
-			return old, true
+			return i
 		}
 		i = (i + 1) & m.mask
 	}
 }
 
+// Expire deletes all expired key/values, buf is used as scratch space.
+// Returns the number of deleted values and buf.
+func (m *shard[K, V]) Expire(buf []entry[K, V]) (int, []entry[K, V]) {
+	buf = buf[:0]
+	if m.metas == nil {
+		return 0, buf
+	}
+	now := clock()
+	for t := m; t != nil; t = t.old {
+		for i := 0; i < len(t.buckets); i++ {
+			if int(t.buckets[i].hdib&maxDIB) > 0 && t.metas[i].expired(&now) {
+				buf = append(buf, t.buckets[i])
+			}
+		}
+	}
+	for _, e := range buf {
+		if i := m.index(e.hdib>>dibBitSize<<dibBitSize, e.key); i >= 0 {
+			m.drop(i, ReasonExpired)
+			m.remove(i)
+		}
+	}
+	return len(buf), buf
+}
+
+// evict removes the least recently used entry among a few sampled ones,
+// preferring an expired one.
+func (m *shard[K, V]) evict() {
+	const samples = 8
+	m.settle()
+	start := int(m.conf.rng.Uint64())
+	victim, reason, now := -1, ReasonEvicted, clock()
+	for i, n := 0, 0; i < len(m.buckets) && n < samples; i++ {
+		j := (start + i) & m.mask
+		if int(m.buckets[j].hdib&maxDIB) == 0 {
+			continue
+		}
+		if m.metas[j].expired(&now) {
+			victim, reason = j, ReasonExpired
+			break
+		}
+		if victim < 0 || m.metas[j].access < m.metas[victim].access {
+			victim = j
+		}
+		n++
+	}
+	if victim >= 0 {
+		m.drop(victim, reason)
+		m.remove(victim)
+	}
+}
+
+// drop records the entry at bucket i before it's removed for reason.
+func (m *shard[K, V]) drop(i int, reason EvictReason) {
+	m.dropEntry(m.buckets[i].key, m.buckets[i].value, reason)
+}
+
+// dropEntry records an entry before it's removed for reason.
+func (m *shard[K, V]) dropEntry(key K, value V, reason EvictReason) {
+	switch reason {
+	case ReasonDeleted:
+		m.ops.deletes++
+	case ReasonEvicted:
+		m.ops.evictions++
+	case ReasonExpired:
+		m.ops.expirations++
+	}
+	if m.conf.notify {
+		m.dropped = append(m.dropped, eviction[K, V]{key: key, value: value, reason: reason})
+	}
+}
+
+// dropAll records all entries before the shard is cleared.
+func (m *shard[K, V]) dropAll() {
+	if !m.conf.notify {
+		m.ops.deletes += uint64(m.length)
+		return
+	}
+	var now int64
+	for t := m; t != nil; t = t.old {
+		for i := 0; i < len(t.buckets); i++ {
+			switch {
+			case int(t.buckets[i].hdib&maxDIB) == 0:
+			case t.metas != nil && t.metas[i].expired(&now):
+				m.dropEntry(t.buckets[i].key, t.buckets[i].value, ReasonExpired)
+			default:
+				m.dropEntry(t.buckets[i].key, t.buckets[i].value, ReasonDeleted)
+			}
+		}
+	}
+}
+
 func (m *shard[K, V]) remove(i int) {
+	if m.metas != nil {
+		m.cost -= m.metas[i].cost
+	}
+	if m.indexes != nil {
+		m.indexDel(m.buckets[i].key, m.buckets[i].value)
+	}
 	m.buckets[i].hdib = m.buckets[i].hdib>>dibBitSize<<dibBitSize | uint64(0)&maxDIB
-	for {
-		pi := i
-		i = (i + 1) & m.mask
-		if int(m.buckets[i].hdib&maxDIB) <= 1 {
-			m.buckets[pi] = entry[K, V]{}
-			break
+	if unsafe.Sizeof(m.buckets[i]) > largeEntry {
+		m.unshift(i)
+	} else {
+		for {
+			pi := i
+			i = (i + 1) & m.mask
+			if int(m.buckets[i].hdib&maxDIB) <= 1 {
+				m.buckets[pi] = entry[K, V]{}
+				if m.metas != nil {
+					m.metas[pi] = meta{}
+				}
+				break
+			}
+			m.buckets[pi] = m.buckets[i]
+			if m.metas != nil {
+				m.metas[pi] = m.metas[i]
+			}
+			m.buckets[pi].hdib = m.buckets[pi].hdib>>dibBitSize<<dibBitSize | uint64(int(m.buckets[pi].hdib&maxDIB)-1)&maxDIB
 		}
-		m.buckets[pi] = m.buckets[i]
-		m.buckets[pi].hdib = m.buckets[pi].hdib>>dibBitSize<<dibBitSize | uint64(int(m.buckets[pi].hdib&maxDIB)-1)&maxDIB
 	}
 	m.length--
 	if len(m.buckets) > m.cap && m.length <= m.shrinkAt {
-		m.resize(m.length)
+		m.rehash(m.sizeFor(m.length))
+	}
+}
+
+// shift moves the run of entries starting at bucket i one bucket forward,
+// up to the next empty bucket, leaving bucket i free.
+func (m *shard[K, V]) shift(i int) {
+	j := i
+	for int(m.buckets[j].hdib&maxDIB) != 0 {
+		j = (j + 1) & m.mask
+	}
+	if j < i {
+		copy(m.buckets[1:j+1], m.buckets[:j])
+		m.buckets[0] = m.buckets[m.mask]
+		copy(m.buckets[i+1:], m.buckets[i:m.mask])
+		if m.metas != nil {
+			copy(m.metas[1:j+1], m.metas[:j])
+			m.metas[0] = m.metas[m.mask]
+			copy(m.metas[i+1:], m.metas[i:m.mask])
+		}
+	} else {
+		copy(m.buckets[i+1:j+1], m.buckets[i:j])
+		if m.metas != nil {
+			copy(m.metas[i+1:j+1], m.metas[i:j])
+		}
+	}
+	for k := (i + 1) & m.mask; ; k = (k + 1) & m.mask {
+		m.buckets[k].hdib = m.buckets[k].hdib>>dibBitSize<<dibBitSize | uint64(int(m.buckets[k].hdib&maxDIB)+1)&maxDIB
+		if k == j {
+			break
+		}
 	}
 }
 
+// unshift moves the run of entries following the removed bucket i one
+// bucket backward at once, leaving the end of the run empty.
+func (m *shard[K, V]) unshift(i int) {
+	j := (i + 1) & m.mask
+	for int(m.buckets[j].hdib&maxDIB) > 1 {
+		m.buckets[j].hdib = m.buckets[j].hdib>>dibBitSize<<dibBitSize | uint64(int(m.buckets[j].hdib&maxDIB)-1)&maxDIB
+		j = (j + 1) & m.mask
+	}
+	j = (j - 1) & m.mask // last bucket of the run
+	if j < i {
+		copy(m.buckets[i:m.mask], m.buckets[i+1:])
+		m.buckets[m.mask] = m.buckets[0]
+		copy(m.buckets[:j], m.buckets[1:j+1])
+		if m.metas != nil {
+			copy(m.metas[i:m.mask], m.metas[i+1:])
+			m.metas[m.mask] = m.metas[0]
+			copy(m.metas[:j], m.metas[1:j+1])
+		}
+	} else {
+		copy(m.buckets[i:j], m.buckets[i+1:j+1])
+		if m.metas != nil {
+			copy(m.metas[i:j], m.metas[i+1:j+1])
+		}
+	}
+	m.buckets[j] = entry[K, V]{}
+	if m.metas != nil {
+		m.metas[j] = meta{}
+	}
+}
+
+// indexAdd adds key to the secondary indexes under the index keys of value.
+func (m *shard[K, V]) indexAdd(key K, value V) {
+	for j, fn := range m.conf.index {
+		ik := fn(value)
+		keys := m.indexes[j][ik]
+		if keys == nil {
+			keys = make(map[K]struct{})
+			m.indexes[j][ik] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+// indexDel removes key from the secondary indexes under the index keys of
+// value.
+func (m *shard[K, V]) indexDel(key K, value V) {
+	for j, fn := range m.conf.index {
+		ik := fn(value)
+		if keys := m.indexes[j][ik]; keys != nil {
+			delete(keys, key)
+			if len(keys) == 0 {
+				delete(m.indexes[j], ik)
+			}
+		}
+	}
+}
+
+// live reports whether bucket i holds an unexpired entry.
+func (m *shard[K, V]) live(i int, now *int64) bool {
+	return int(m.buckets[i].hdib&maxDIB) > 0 && (m.metas == nil || !m.metas[i].expired(now))
+}
+
 // Range iterates over all key/values.
 // It's not safe to call or Set or Delete while ranging.
 func (m *shard[K, V]) Range(iter func(key K, value V) bool) {
-	for i := 0; i < len(m.buckets); i++ {
-		if int(m.buckets[i].hdib&maxDIB) > 0 {
-			if !iter(m.buckets[i].key, m.buckets[i].value) {
-				return
+	var now int64
+	for t := m; t != nil; t = t.old {
+		for i := 0; i < len(t.buckets); i++ {
+			if t.live(i, &now) {
+				if !iter(t.buckets[i].key, t.buckets[i].value) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// AppendEntries appends all entries to buf.
+func (m *shard[K, V]) AppendEntries(buf []entry[K, V]) []entry[K, V] {
+	var now int64
+	for t := m; t != nil; t = t.old {
+		for i := 0; i < len(t.buckets); i++ {
+			if t.live(i, &now) {
+				buf = append(buf, t.buckets[i])
+			}
+		}
+	}
+	return buf
+}
+
+// AppendDeadlines appends all entries to buf like AppendEntries, and their
+// deadlines in clock nanoseconds to expires, 0 meaning never.
+func (m *shard[K, V]) AppendDeadlines(buf []entry[K, V], expires []int64) ([]entry[K, V], []int64) {
+	var now int64
+	for t := m; t != nil; t = t.old {
+		for i := 0; i < len(t.buckets); i++ {
+			if t.live(i, &now) {
+				var expire int64
+				if t.metas != nil {
+					expire = t.metas[i].expire
+				}
+				buf, expires = append(buf, t.buckets[i]), append(expires, expire)
+			}
+		}
+	}
+	return buf, expires
+}
+
+// AppendKeys appends all keys to buf.
+func (m *shard[K, V]) AppendKeys(buf []K) []K {
+	var now int64
+	for t := m; t != nil; t = t.old {
+		for i := 0; i < len(t.buckets); i++ {
+			if t.live(i, &now) {
+				buf = append(buf, t.buckets[i].key)
+			}
+		}
+	}
+	return buf
+}
+
+// AppendValues appends all values to buf.
+func (m *shard[K, V]) AppendValues(buf []V) []V {
+	var now int64
+	for t := m; t != nil; t = t.old {
+		for i := 0; i < len(t.buckets); i++ {
+			if t.live(i, &now) {
+				buf = append(buf, t.buckets[i].value)
 			}
 		}
 	}
+	return buf
 }
 
 // GetPos gets a single keys/value nearby a position
@@ -171,11 +957,113 @@ func (m *shard[K, V]) Range(iter func(key K, value V) bool) {
 // from the map.
 // It's not safe to call or Set or Delete while ranging.
 func (m *shard[K, V]) GetPos(pos uint64) (key K, value V, ok bool) {
-	for i := 0; i < len(m.buckets); i++ {
-		index := (pos + uint64(i)) & uint64(m.mask)
-		if int(m.buckets[index].hdib&maxDIB) > 0 {
-			return m.buckets[index].key, m.buckets[index].value, true
+	var now int64
+	for t := m; t != nil; t = t.old {
+		for i := 0; i < len(t.buckets); i++ {
+			index := (pos + uint64(i)) & uint64(t.mask)
+			if t.live(int(index), &now) {
+				return t.buckets[index].key, t.buckets[index].value, true
+			}
 		}
 	}
 	return
 }
+
+// probes returns the histogram of the probe distances of the entries, and
+// the number of entries whose hash equals the one of an entry before them.
+func (m *shard[K, V]) probes() (hist []int, collisions int) {
+	for i := 0; i < len(m.buckets); i++ {
+		dib := int(m.buckets[i].hdib & maxDIB)
+		if dib == 0 {
+			continue
+		}
+		for len(hist) < dib {
+			hist = append(hist, 0)
+		}
+		hist[dib-1]++
+		// entries of the same home bucket are next to each other
+		hash := m.buckets[i].hdib >> dibBitSize
+		for j, d := (i-1)&m.mask, dib-1; d > 0; j, d = (j-1)&m.mask, d-1 {
+			if int(m.buckets[j].hdib&maxDIB) != d {
+				break
+			}
+			if m.buckets[j].hdib>>dibBitSize == hash {
+				collisions++
+				break
+			}
+		}
+	}
+	return hist, collisions
+}
+
+// Random returns an entry picked uniformly at random. Random buckets are
+// tried until a live one is found, and sparse shards fall back to picking the
+// nth live bucket.
+func (m *shard[K, V]) Random(rng *wyhash_RNG) (key K, value V, ok bool) {
+	if m.length == 0 {
+		return
+	}
+	// a table being migrated is picked in proportion to its length
+	t := m
+	if m.old != nil && rng.Intn(m.length) < m.old.length {
+		t = m.old
+	}
+	var now int64
+	for try := 0; try < 64; try++ {
+		if i := int(rng.Uint64() & uint64(t.mask)); t.live(i, &now) {
+			return t.buckets[i].key, t.buckets[i].value, true
+		}
+	}
+	// length counts expired entries too, which may leave n unreached
+	n := rng.Intn(m.length)
+	for t := m; t != nil && n >= 0; t = t.old {
+		for i := 0; i < len(t.buckets); i++ {
+			if t.live(i, &now) {
+				key, value, ok = t.buckets[i].key, t.buckets[i].value, true
+				if n--; n < 0 {
+					break
+				}
+			}
+		}
+	}
+	return key, value, ok
+}
+
+// verify checks the robinhood invariants of the shard.
+func (m *shard[K, V]) verify() error {
+	var n int
+	var cost int64
+	for i := 0; i < len(m.buckets); i++ {
+		dib := int(m.buckets[i].hdib & maxDIB)
+		if dib == 0 {
+			continue
+		}
+		n++
+		if m.metas != nil {
+			cost += m.metas[i].cost
+		}
+		home := int(m.buckets[i].hdib>>dibBitSize) & m.mask
+		if want := (i-home)&m.mask + 1; dib != want {
+			return fmt.Errorf("bucket %d has dib %d, want %d", i, dib, want)
+		}
+		if j := (i - 1) & m.mask; dib > 1 && int(m.buckets[j].hdib&maxDIB) < dib-1 {
+			return fmt.Errorf("bucket %d has dib %d after dib %d", i, dib, m.buckets[j].hdib&maxDIB)
+		}
+		if m.bloom != nil && !m.bloom.has(int(m.buckets[i].hdib>>dibBitSize)) {
+			return fmt.Errorf("bucket %d is missing from the bloom filter", i)
+		}
+	}
+	if m.old != nil {
+		if err := m.old.verify(); err != nil {
+			return fmt.Errorf("migrating table: %w", err)
+		}
+		n, cost = n+m.old.length, cost+m.old.cost
+	}
+	if n != m.length {
+		return fmt.Errorf("length %d, but %d buckets in use", m.length, n)
+	}
+	if cost != m.cost {
+		return fmt.Errorf("cost %d, but %d in buckets", m.cost, cost)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package shardmap
+
+// ShardData returns the user data attached to shard i, a zero T allocated on
+// first use, so that state built on top of the map, such as counters or free
+// lists, shares the shard lock instead of adding its own. It must only be
+// called with the shard locked, from DoShard or the mutator of Mutate for a
+// key of the shard, and always with the same T for a map. The data stays with
+// its shard on Clear and Rehash, and is not copied by Clone.
+func ShardData[T any, K comparable, V any](m *Map[K, V], i int) *T {
+	if m.data[i] == nil {
+		m.data[i] = new(T)
+	}
+	return m.data[i].(*T)
+}
+
+// DoShard calls fn with shard i write locked, which must be in
+// [0, NumShards()). The fn function must not access the map.
+func (m *Map[K, V]) DoShard(i int, fn func()) {
+	m.lazyInit()
+	m.writeShard(i, func(*shard[K, V]) { fn() })
+}
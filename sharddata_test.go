@@ -0,0 +1,35 @@
+package shardmap
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestShardData(t *testing.T) {
+	type stats struct{ sets int }
+	m := New[int, int](0, WithShards[int, int](4))
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				shard := m.ShardIndex(i)
+				m.Mutate(i, func(old int, ok bool) (int, bool) {
+					ShardData[stats](m, shard).sets++
+					return old + 1, true
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	var sets int
+	for i := 0; i < m.NumShards(); i++ {
+		m.DoShard(i, func() {
+			sets += ShardData[stats](m, i).sets
+		})
+	}
+	if sets != 4000 {
+		t.Fatalf("expected '%v', got '%v'", 4000, sets)
+	}
+}
@@ -0,0 +1,114 @@
+package shardmapgrpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Client calls the Map service of a server.
+type Client struct {
+	url string
+	hc  *http.Client
+}
+
+// NewHTTPClient returns a client of the server at url, e.g.
+// "http://127.0.0.1:8080", calling it with hc, which must speak HTTP/2.
+func NewHTTPClient(url string, hc *http.Client) *Client {
+	return &Client{url: url, hc: hc}
+}
+
+// Get returns the value of a key.
+// Returns false when the key has no value.
+func (c *Client) Get(ctx context.Context, key string) (value []byte, ok bool, err error) {
+	req := getRequest{key: key}
+	var resp getResponse
+	if err := c.call(ctx, "Get", req.marshal(), resp.unmarshal); err != nil {
+		return nil, false, err
+	}
+	return resp.value, resp.found, nil
+}
+
+// Set assigns a value to a key which expires after ttl, a ttl <= 0 means the
+// value never expires.
+// Returns true when a value was replaced.
+func (c *Client) Set(ctx context.Context, key string, value []byte, ttl time.Duration) (replaced bool, err error) {
+	req := setRequest{key: key, value: value, ttlMillis: int64(ttl / time.Millisecond)}
+	if ttl > 0 && req.ttlMillis == 0 {
+		req.ttlMillis = 1
+	}
+	var resp setResponse
+	if err := c.call(ctx, "Set", req.marshal(), resp.unmarshal); err != nil {
+		return false, err
+	}
+	return resp.replaced, nil
+}
+
+// Delete deletes the value of a key.
+// Returns true when a value was deleted.
+func (c *Client) Delete(ctx context.Context, key string) (deleted bool, err error) {
+	req := deleteRequest{key: key}
+	var resp deleteResponse
+	if err := c.call(ctx, "Delete", req.marshal(), resp.unmarshal); err != nil {
+		return false, err
+	}
+	return resp.deleted, nil
+}
+
+// Scan returns the entries whose keys have prefix of the shards from cursor
+// on, until about count entries were scanned, and the next cursor, 0 when the
+// scan is complete. A scan starts with a cursor of 0.
+func (c *Client) Scan(ctx context.Context, cursor int, count int, prefix string) (entries []Entry, next int, err error) {
+	req := scanRequest{cursor: uint32(cursor), count: uint32(count), prefix: prefix}
+	var resp scanResponse
+	if err := c.call(ctx, "Scan", req.marshal(), resp.unmarshal); err != nil {
+		return nil, 0, err
+	}
+	return resp.entries, int(resp.cursor), nil
+}
+
+// call calls a method with a request, and decodes its response with
+// unmarshal.
+func (c *Client) call(ctx context.Context, method string, req []byte, unmarshal func([]byte) error) error {
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+servicePath+method, bytes.NewReader(frame(req)))
+	if err != nil {
+		return err
+	}
+	r.Header.Set("Content-Type", "application/grpc")
+	r.Header.Set("TE", "trailers")
+	resp, err := c.hc.Do(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return &Error{codeInternal, "http status " + resp.Status}
+	}
+	msg, err := readMessage(resp.Body)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	// the trailers are read with the end of the body
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return err
+	}
+	status := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if status == "" {
+		// a trailers-only response
+		status, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if code, err := strconv.Atoi(status); err != nil || code != codeOK {
+		if err != nil {
+			code = codeInternal
+		}
+		return &Error{code, message}
+	}
+	if msg == nil {
+		return &Error{codeInternal, "missing response"}
+	}
+	return unmarshal(msg)
+}
@@ -0,0 +1,26 @@
+//go:build go1.24
+
+package shardmapgrpc
+
+import (
+	"net/http"
+
+	"github.com/phuslu/shardmap"
+)
+
+// NewServer returns an http.Server serving the Map service of m over
+// cleartext HTTP/2, to be started with Serve or ListenAndServe.
+func NewServer(addr string, m *shardmap.Map[string, []byte]) *http.Server {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Server{Addr: addr, Handler: NewHandler(m), Protocols: &protocols}
+}
+
+// NewClient returns a client of the server of NewServer at addr, e.g.
+// "127.0.0.1:8080".
+func NewClient(addr string) *Client {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	hc := &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+	return NewHTTPClient("http://"+addr, hc)
+}
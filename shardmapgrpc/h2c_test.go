@@ -0,0 +1,27 @@
+//go:build go1.24
+
+package shardmapgrpc
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/phuslu/shardmap"
+)
+
+func TestServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := shardmap.New[string, []byte](0, shardmap.WithShards[string, []byte](4))
+	s := NewServer("", m)
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+	testClient(t, m, NewClient(l.Addr().String()))
+	s.Close()
+	if err := <-served; err != http.ErrServerClosed {
+		t.Fatalf("expected '%v', got '%v'", http.ErrServerClosed, err)
+	}
+}
@@ -0,0 +1,223 @@
+// Package shardmapgrpc serves a shardmap.Map over gRPC, as the Map service of
+// shardmap.proto, so that other processes can read and write it with any
+// gRPC client, or with the Client of this package.
+//
+// It implements the gRPC protocol over net/http without dependencies: the
+// handler of NewHandler must be served over HTTP/2, either with TLS by a
+// net/http server, or in cleartext by NewServer.
+package shardmapgrpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/phuslu/shardmap"
+)
+
+// maxMessage is the max size of a message.
+const maxMessage = 64 << 20
+
+// The gRPC status codes used.
+const (
+	codeOK                 = 0
+	codeInvalidArgument    = 3
+	codeFailedPrecondition = 9
+	codeResourceExhausted  = 8
+	codeUnimplemented      = 12
+	codeInternal           = 13
+)
+
+// servicePath is the path prefix of the methods of the Map service.
+const servicePath = "/shardmap.Map/"
+
+// Error is a gRPC status other than OK, returned by the Client.
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return "shardmapgrpc: code " + strconv.Itoa(e.Code) + ": " + e.Message
+}
+
+type handler struct {
+	m *shardmap.Map[string, []byte]
+}
+
+// NewHandler returns an http.Handler serving the Map service of m.
+func NewHandler(m *shardmap.Map[string, []byte]) http.Handler {
+	return &handler{m: m}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "shardmapgrpc: gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	req, err := readMessage(r.Body)
+	if err != nil {
+		writeStatus(w, statusOf(err))
+		return
+	}
+	defer func() {
+		// a closed map panics on writes
+		if p := recover(); p != nil {
+			if p != shardmap.ErrClosed && p != shardmap.ErrReadOnly {
+				panic(p)
+			}
+			writeStatus(w, statusOf(p.(error)))
+		}
+	}()
+	var resp []byte
+	switch strings.TrimPrefix(r.URL.Path, servicePath) {
+	case "Get":
+		resp, err = h.get(req)
+	case "Set":
+		resp, err = h.set(req)
+	case "Delete":
+		resp, err = h.delete(req)
+	case "Scan":
+		resp, err = h.scan(req)
+	default:
+		err = &Error{codeUnimplemented, "unknown method " + r.URL.Path}
+	}
+	if err != nil {
+		writeStatus(w, statusOf(err))
+		return
+	}
+	w.Write(frame(resp))
+	writeStatus(w, nil)
+}
+
+func (h *handler) get(b []byte) ([]byte, error) {
+	var req getRequest
+	if err := req.unmarshal(b); err != nil {
+		return nil, err
+	}
+	var resp getResponse
+	resp.value, resp.found = h.m.Get(req.key)
+	return resp.marshal(), nil
+}
+
+func (h *handler) set(b []byte) ([]byte, error) {
+	var req setRequest
+	if err := req.unmarshal(b); err != nil {
+		return nil, err
+	}
+	if h.m.ReadOnly() {
+		return nil, shardmap.ErrReadOnly
+	}
+	var resp setResponse
+	_, resp.replaced = h.m.SetWithTTL(req.key, req.value, time.Duration(req.ttlMillis)*time.Millisecond)
+	return resp.marshal(), nil
+}
+
+func (h *handler) delete(b []byte) ([]byte, error) {
+	var req deleteRequest
+	if err := req.unmarshal(b); err != nil {
+		return nil, err
+	}
+	if h.m.ReadOnly() {
+		return nil, shardmap.ErrReadOnly
+	}
+	var resp deleteResponse
+	_, resp.deleted = h.m.Delete(req.key)
+	return resp.marshal(), nil
+}
+
+// scan returns the entries of the shards from the cursor on, whole shards at
+// a time, so that the keys present during the whole scan are all returned.
+func (h *handler) scan(b []byte) ([]byte, error) {
+	var req scanRequest
+	if err := req.unmarshal(b); err != nil {
+		return nil, err
+	}
+	if int(req.cursor) >= h.m.NumShards() {
+		return nil, &Error{codeInvalidArgument, "invalid cursor"}
+	}
+	count := int(req.count)
+	if count == 0 {
+		count = 100
+	}
+	var resp scanResponse
+	cursor, scanned := int(req.cursor), 0
+	for cursor < h.m.NumShards() && scanned < count {
+		h.m.RangeShard(cursor, func(key string, value []byte) bool {
+			scanned++
+			if strings.HasPrefix(key, req.prefix) {
+				resp.entries = append(resp.entries, Entry{key, value})
+			}
+			return true
+		})
+		cursor++
+	}
+	if cursor < h.m.NumShards() {
+		resp.cursor = uint32(cursor)
+	}
+	return resp.marshal(), nil
+}
+
+// statusOf returns the gRPC status of an error.
+func statusOf(err error) *Error {
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+		return e
+	case err == errProto:
+		return &Error{codeInvalidArgument, err.Error()}
+	case err == shardmap.ErrClosed || err == shardmap.ErrReadOnly:
+		return &Error{codeFailedPrecondition, err.Error()}
+	}
+	return &Error{codeInternal, err.Error()}
+}
+
+// writeStatus writes the grpc-status trailers, OK when e is nil, or headers
+// when nothing was written.
+func writeStatus(w http.ResponseWriter, e *Error) {
+	if e == nil {
+		e = &Error{Code: codeOK}
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(e.Code))
+	if e.Message != "" {
+		w.Header().Set("Grpc-Message", e.Message)
+	}
+}
+
+// frame returns a message prefixed like gRPC by an uncompressed flag and its
+// length.
+func frame(msg []byte) []byte {
+	b := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(b[1:], uint32(len(msg)))
+	return append(b, msg...)
+}
+
+// readMessage reads a message framed by frame.
+// Returns io.EOF when there is none.
+func readMessage(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, errProto
+	}
+	if header[0] != 0 {
+		return nil, &Error{codeUnimplemented, "compressed messages are not supported"}
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxMessage {
+		return nil, &Error{codeResourceExhausted, "message too large"}
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, errProto
+	}
+	return msg, nil
+}
@@ -0,0 +1,117 @@
+package shardmapgrpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/phuslu/shardmap"
+)
+
+func testClient(t *testing.T, m *shardmap.Map[string, []byte], c *Client) {
+	ctx := context.Background()
+	if _, ok, err := c.Get(ctx, "a"); err != nil || ok {
+		t.Fatalf("expected '%v', got '%v' '%v'", false, ok, err)
+	}
+	if replaced, err := c.Set(ctx, "a", []byte("1"), 0); err != nil || replaced {
+		t.Fatalf("expected '%v', got '%v' '%v'", false, replaced, err)
+	}
+	if replaced, err := c.Set(ctx, "a", []byte("2"), time.Hour); err != nil || !replaced {
+		t.Fatalf("expected '%v', got '%v' '%v'", true, replaced, err)
+	}
+	if value, ok, err := c.Get(ctx, "a"); err != nil || !ok || string(value) != "2" {
+		t.Fatalf("expected '%v', got '%s' '%v'", "2", value, err)
+	}
+	if ttl, _ := m.TTL("a"); ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("expected about '%v', got '%v'", time.Hour, ttl)
+	}
+	if deleted, err := c.Delete(ctx, "a"); err != nil || !deleted {
+		t.Fatalf("expected '%v', got '%v' '%v'", true, deleted, err)
+	}
+	if deleted, err := c.Delete(ctx, "a"); err != nil || deleted {
+		t.Fatalf("expected '%v', got '%v' '%v'", false, deleted, err)
+	}
+
+	for i := 0; i < 100; i++ {
+		m.Set("key:"+strconv.Itoa(i), []byte(strconv.Itoa(i)))
+	}
+	m.Set("other", nil)
+	seen := make(map[string]bool)
+	cursor := 0
+	for {
+		entries, next, err := c.Scan(ctx, cursor, 10, "key:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			if "key:"+string(e.Value) != e.Key {
+				t.Fatalf("expected '%v', got '%v'", e.Key, "key:"+string(e.Value))
+			}
+			seen[e.Key] = true
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	if len(seen) != 100 {
+		t.Fatalf("expected '%v', got '%v'", 100, len(seen))
+	}
+
+	var e *Error
+	if _, _, err := c.Scan(ctx, 1000, 10, ""); !errors.As(err, &e) || e.Code != codeInvalidArgument {
+		t.Fatalf("expected code '%v', got '%v'", codeInvalidArgument, err)
+	}
+	m.SetReadOnly(true)
+	if _, err := c.Set(ctx, "a", nil, 0); !errors.As(err, &e) || e.Code != codeFailedPrecondition {
+		t.Fatalf("expected code '%v', got '%v'", codeFailedPrecondition, err)
+	}
+	m.SetReadOnly(false)
+	m.Close()
+	if _, err := c.Delete(ctx, "a"); !errors.As(err, &e) || e.Code != codeFailedPrecondition {
+		t.Fatalf("expected code '%v', got '%v'", codeFailedPrecondition, err)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	m := shardmap.New[string, []byte](0, shardmap.WithShards[string, []byte](4))
+	s := httptest.NewServer(NewHandler(m))
+	defer s.Close()
+	testClient(t, m, NewHTTPClient(s.URL, s.Client()))
+
+	resp, err := http.Post(s.URL+servicePath+"Get", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected '%v', got '%v'", http.StatusUnsupportedMediaType, resp.StatusCode)
+	}
+}
+
+func TestProto(t *testing.T) {
+	// as encoded by protoc generated code
+	if b := (&setRequest{key: "a", value: []byte("b"), ttlMillis: 300}).marshal(); !bytes.Equal(b, []byte{0x0a, 1, 'a', 0x12, 1, 'b', 0x18, 0xac, 0x02}) {
+		t.Fatalf("unexpected encoding '%x'", b)
+	}
+	in := scanResponse{cursor: 3, entries: []Entry{{"a", []byte("1")}, {"", nil}}}
+	var out scanResponse
+	if err := out.unmarshal(in.marshal()); err != nil {
+		t.Fatal(err)
+	}
+	if out.cursor != 3 || len(out.entries) != 2 || out.entries[0].Key != "a" || string(out.entries[0].Value) != "1" {
+		t.Fatalf("expected '%v', got '%v'", in, out)
+	}
+	// unknown fields are skipped
+	var req getRequest
+	if err := req.unmarshal([]byte{0x0a, 1, 'k', 0x25, 0, 0, 0, 0, 0x30, 1}); err != nil || req.key != "k" {
+		t.Fatalf("expected '%v', got '%v' '%v'", "k", req.key, err)
+	}
+	if err := req.unmarshal([]byte{0x0a, 5, 'k'}); err != errProto {
+		t.Fatalf("expected '%v', got '%v'", errProto, err)
+	}
+}
@@ -0,0 +1,289 @@
+package shardmapgrpc
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// errProto is returned when decoding a malformed message.
+var errProto = errors.New("shardmapgrpc: malformed message")
+
+// The messages of shardmap.proto, encoded by hand as they only have a few
+// scalar fields.
+
+type getRequest struct {
+	key string
+}
+
+type getResponse struct {
+	value []byte
+	found bool
+}
+
+type setRequest struct {
+	key       string
+	value     []byte
+	ttlMillis int64
+}
+
+type setResponse struct {
+	replaced bool
+}
+
+type deleteRequest struct {
+	key string
+}
+
+type deleteResponse struct {
+	deleted bool
+}
+
+type scanRequest struct {
+	cursor uint32
+	count  uint32
+	prefix string
+}
+
+type scanResponse struct {
+	cursor  uint32
+	entries []Entry
+}
+
+// Entry is a key/value returned by Scan.
+type Entry struct {
+	Key   string
+	Value []byte
+}
+
+const (
+	wireVarint = 0
+	wireI64    = 1
+	wireBytes  = 2
+	wireI32    = 5
+)
+
+func appendUvarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func appendVarint(b []byte, field int, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = appendUvarint(b, uint64(field)<<3|wireVarint)
+	return appendUvarint(b, v)
+}
+
+func appendBool(b []byte, field int, v bool) []byte {
+	if v {
+		return appendVarint(b, field, 1)
+	}
+	return b
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = appendUvarint(b, uint64(field)<<3|wireBytes)
+	b = appendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendString(b []byte, field int, v string) []byte {
+	return appendBytes(b, field, []byte(v))
+}
+
+// decode calls fn with the fields of a message, v being the value of varint
+// fields and data the content of length-delimited ones. Fixed size fields
+// are skipped.
+func decode(b []byte, fn func(field int, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errProto
+		}
+		b = b[n:]
+		field := int(tag >> 3)
+		var v uint64
+		var data []byte
+		switch tag & 7 {
+		case wireVarint:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return errProto
+			}
+			b = b[n:]
+		case wireI64, wireI32:
+			size := 8
+			if tag&7 == wireI32 {
+				size = 4
+			}
+			if len(b) < size {
+				return errProto
+			}
+			b = b[size:]
+			continue
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || size > uint64(len(b)-n) {
+				return errProto
+			}
+			data, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			return errProto
+		}
+		if err := fn(field, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *getRequest) marshal() []byte {
+	return appendString(nil, 1, m.key)
+}
+
+func (m *getRequest) unmarshal(b []byte) error {
+	return decode(b, func(field int, v uint64, data []byte) error {
+		if field == 1 {
+			m.key = string(data)
+		}
+		return nil
+	})
+}
+
+func (m *getResponse) marshal() []byte {
+	return appendBool(appendBytes(nil, 1, m.value), 2, m.found)
+}
+
+func (m *getResponse) unmarshal(b []byte) error {
+	return decode(b, func(field int, v uint64, data []byte) error {
+		switch field {
+		case 1:
+			m.value = append([]byte(nil), data...)
+		case 2:
+			m.found = v != 0
+		}
+		return nil
+	})
+}
+
+func (m *setRequest) marshal() []byte {
+	b := appendString(nil, 1, m.key)
+	b = appendBytes(b, 2, m.value)
+	return appendVarint(b, 3, uint64(m.ttlMillis))
+}
+
+func (m *setRequest) unmarshal(b []byte) error {
+	return decode(b, func(field int, v uint64, data []byte) error {
+		switch field {
+		case 1:
+			m.key = string(data)
+		case 2:
+			m.value = append([]byte(nil), data...)
+		case 3:
+			m.ttlMillis = int64(v)
+		}
+		return nil
+	})
+}
+
+func (m *setResponse) marshal() []byte {
+	return appendBool(nil, 1, m.replaced)
+}
+
+func (m *setResponse) unmarshal(b []byte) error {
+	return decode(b, func(field int, v uint64, data []byte) error {
+		if field == 1 {
+			m.replaced = v != 0
+		}
+		return nil
+	})
+}
+
+func (m *deleteRequest) marshal() []byte {
+	return appendString(nil, 1, m.key)
+}
+
+func (m *deleteRequest) unmarshal(b []byte) error {
+	return decode(b, func(field int, v uint64, data []byte) error {
+		if field == 1 {
+			m.key = string(data)
+		}
+		return nil
+	})
+}
+
+func (m *deleteResponse) marshal() []byte {
+	return appendBool(nil, 1, m.deleted)
+}
+
+func (m *deleteResponse) unmarshal(b []byte) error {
+	return decode(b, func(field int, v uint64, data []byte) error {
+		if field == 1 {
+			m.deleted = v != 0
+		}
+		return nil
+	})
+}
+
+func (m *scanRequest) marshal() []byte {
+	b := appendVarint(nil, 1, uint64(m.cursor))
+	b = appendVarint(b, 2, uint64(m.count))
+	return appendString(b, 3, m.prefix)
+}
+
+func (m *scanRequest) unmarshal(b []byte) error {
+	return decode(b, func(field int, v uint64, data []byte) error {
+		switch field {
+		case 1:
+			m.cursor = uint32(v)
+		case 2:
+			m.count = uint32(v)
+		case 3:
+			m.prefix = string(data)
+		}
+		return nil
+	})
+}
+
+func (m *scanResponse) marshal() []byte {
+	b := appendVarint(nil, 1, uint64(m.cursor))
+	for _, e := range m.entries {
+		entry := appendBytes(appendString(nil, 1, e.Key), 2, e.Value)
+		// empty entries are still present
+		b = appendUvarint(b, 2<<3|wireBytes)
+		b = appendUvarint(b, uint64(len(entry)))
+		b = append(b, entry...)
+	}
+	return b
+}
+
+func (m *scanResponse) unmarshal(b []byte) error {
+	return decode(b, func(field int, v uint64, data []byte) error {
+		switch field {
+		case 1:
+			m.cursor = uint32(v)
+		case 2:
+			var e Entry
+			err := decode(data, func(field int, v uint64, data []byte) error {
+				switch field {
+				case 1:
+					e.Key = string(data)
+				case 2:
+					e.Value = append([]byte(nil), data...)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			m.entries = append(m.entries, e)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,242 @@
+package shardmapserver
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// maxKey is the max size of a memcached key.
+const maxKey = 250
+
+// maxRelative is the largest memcached exptime in seconds relative to now,
+// larger ones are unix times.
+const maxRelative = 30 * 24 * 60 * 60
+
+// ListenAndServeMemcached listens on the TCP address addr and serves its
+// connections over the memcached text protocol.
+func (s *Server) ListenAndServeMemcached(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.ServeMemcached(l)
+}
+
+// ServeMemcached accepts connections on l like Serve, and serves them over the
+// memcached text protocol. It supports get, gets, set, add, replace, append,
+// prepend, delete, touch, incr, decr, flush_all, version and quit, with
+// noreply. The flags are not stored, and are always returned as 0, gets
+// returns a cas of 0, and flush_all ignores its delay.
+func (s *Server) ServeMemcached(l net.Listener) error {
+	return s.accept(l, s.serveMemcached)
+}
+
+func (s *Server) serveMemcached(c net.Conn) {
+	r := bufio.NewReader(c)
+	w := bufio.NewWriter(c)
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			if err != io.EOF {
+				w.WriteString("CLIENT_ERROR " + err.Error() + "\r\n")
+				w.Flush()
+			}
+			return
+		}
+		args := bytes.Fields(line)
+		if len(args) == 0 {
+			w.WriteString("ERROR\r\n")
+		} else if quit := s.execMemcached(r, w, args); quit {
+			w.Flush()
+			return
+		}
+		if r.Buffered() == 0 && w.Flush() != nil {
+			return
+		}
+	}
+}
+
+// execMemcached runs a command and writes its reply, reading its data from r.
+// Returns true when the connection must be closed.
+func (s *Server) execMemcached(r *bufio.Reader, w *bufio.Writer, args [][]byte) (quit bool) {
+	name := string(args[0])
+	args = args[1:]
+	noreply := len(args) > 0 && string(args[len(args)-1]) == "noreply"
+	if noreply {
+		args = args[:len(args)-1]
+		w = bufio.NewWriter(io.Discard)
+	}
+	for _, key := range args {
+		if len(key) > maxKey {
+			w.WriteString("CLIENT_ERROR bad command line format\r\n")
+			return name == "set" || name == "add" || name == "replace" || name == "append" || name == "prepend"
+		}
+	}
+	switch name {
+	case "get", "gets":
+		for _, key := range args {
+			if value, ok := s.m.Get(string(key)); ok {
+				w.WriteString("VALUE " + string(key) + " 0 " + strconv.Itoa(len(value)))
+				if name == "gets" {
+					w.WriteString(" 0")
+				}
+				w.WriteString("\r\n")
+				w.Write(value)
+				w.WriteString("\r\n")
+			}
+		}
+		w.WriteString("END\r\n")
+	case "set", "add", "replace", "append", "prepend":
+		return s.store(r, w, name, args)
+	case "delete":
+		if len(args) != 1 {
+			w.WriteString("ERROR\r\n")
+		} else if _, ok := s.m.Delete(string(args[0])); ok {
+			w.WriteString("DELETED\r\n")
+		} else {
+			w.WriteString("NOT_FOUND\r\n")
+		}
+	case "touch":
+		var ttl time.Duration
+		ok := len(args) == 2
+		if ok {
+			ttl, ok = exptime(args[1])
+		}
+		switch {
+		case !ok:
+			w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		case s.m.Expire(string(args[0]), ttl):
+			w.WriteString("TOUCHED\r\n")
+		default:
+			w.WriteString("NOT_FOUND\r\n")
+		}
+	case "incr", "decr":
+		var delta uint64
+		var err error
+		if len(args) != 2 {
+			w.WriteString("ERROR\r\n")
+			break
+		}
+		if delta, err = strconv.ParseUint(string(args[1]), 10, 64); err != nil {
+			w.WriteString("CLIENT_ERROR invalid numeric delta argument\r\n")
+			break
+		}
+		var n uint64
+		numeric := true
+		found := s.m.Update(string(args[0]), func(value *[]byte) {
+			if n, err = strconv.ParseUint(string(*value), 10, 64); err != nil {
+				numeric = false
+				return
+			}
+			switch {
+			case name == "incr":
+				n += delta
+			case n < delta:
+				n = 0
+			default:
+				n -= delta
+			}
+			*value = strconv.AppendUint(nil, n, 10)
+		})
+		switch {
+		case !found:
+			w.WriteString("NOT_FOUND\r\n")
+		case !numeric:
+			w.WriteString("CLIENT_ERROR cannot increment or decrement non-numeric value\r\n")
+		default:
+			w.WriteString(strconv.FormatUint(n, 10) + "\r\n")
+		}
+	case "flush_all":
+		s.m.Clear()
+		w.WriteString("OK\r\n")
+	case "version":
+		w.WriteString("VERSION shardmap\r\n")
+	case "quit":
+		return true
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+	return false
+}
+
+// store runs a storage command <name> <key> <flags> <exptime> <bytes>, whose
+// data block follows.
+// Returns true when the connection must be closed, as the data can't be
+// skipped.
+func (s *Server) store(r *bufio.Reader, w *bufio.Writer, name string, args [][]byte) (quit bool) {
+	if len(args) != 4 {
+		w.WriteString("ERROR\r\n")
+		return false
+	}
+	_, err := strconv.ParseUint(string(args[1]), 10, 32)
+	ttl, ok := exptime(args[2])
+	size, err2 := strconv.Atoi(string(args[3]))
+	if err != nil || !ok || err2 != nil || size < 0 || size > maxBulk {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return true
+	}
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return true
+	}
+	if data[size] != '\r' || data[size+1] != '\n' {
+		w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		return false
+	}
+	key, value := string(args[0]), data[:size:size]
+	var stored bool
+	switch name {
+	case "set":
+		s.m.SetWithTTL(key, value, ttl)
+		stored = true
+	case "add":
+		if stored = s.m.SetIfAbsent(key, value); stored && ttl != 0 {
+			// the ttl is set apart from the value
+			s.m.Expire(key, ttl)
+		}
+	case "replace":
+		if _, stored = s.m.Replace(key, value); stored {
+			s.m.Expire(key, ttl)
+		}
+	case "append", "prepend":
+		stored = s.m.Update(key, func(old *[]byte) {
+			if name == "append" {
+				*old = append((*old)[:len(*old):len(*old)], value...)
+			} else {
+				*old = append(value, *old...)
+			}
+		})
+	}
+	if stored {
+		w.WriteString("STORED\r\n")
+	} else {
+		w.WriteString("NOT_STORED\r\n")
+	}
+	return false
+}
+
+// exptime parses a memcached exptime: 0 never expires, negative values are
+// expired, values up to 30 days are relative to now, and larger ones are unix
+// times.
+// Returns false when it's malformed.
+func exptime(b []byte) (time.Duration, bool) {
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	switch {
+	case err != nil:
+		return 0, false
+	case n == 0:
+		return 0, true
+	case n > maxRelative:
+		if ttl := time.Until(time.Unix(n, 0)); ttl > 0 {
+			return ttl, true
+		}
+		return time.Nanosecond, true // expired
+	case n < 0:
+		return time.Nanosecond, true // expired
+	}
+	return time.Duration(n) * time.Second, true
+}
@@ -0,0 +1,105 @@
+package shardmapserver
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/phuslu/shardmap"
+)
+
+func TestMemcached(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := shardmap.New[string, []byte](0)
+	s := New(m)
+	served := make(chan error, 1)
+	go func() { served <- s.ServeMemcached(l) }()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	r := bufio.NewReader(c)
+	// do sends a request and reads the lines of its reply up to its last one
+	do := func(req, last string) string {
+		if _, err := c.Write([]byte(req)); err != nil {
+			t.Fatal(err)
+		}
+		var reply []string
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatal(err)
+			}
+			line = strings.TrimSuffix(line, "\r\n")
+			reply = append(reply, line)
+			if last == "" || line == last || strings.HasPrefix(line, "CLIENT_ERROR") {
+				return strings.Join(reply, "|")
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		req, last, reply string
+	}{
+		{"get a\r\n", "END", "END"},
+		{"set a 0 0 1\r\n1\r\n", "", "STORED"},
+		{"add a 0 0 1\r\n2\r\n", "", "NOT_STORED"},
+		{"replace b 0 0 1\r\n2\r\n", "", "NOT_STORED"},
+		{"add b 5 100 2\r\nbb\r\n", "", "STORED"},
+		{"get a b c\r\n", "END", "VALUE a 0 1|1|VALUE b 0 2|bb|END"},
+		{"gets a\r\n", "END", "VALUE a 0 1 0|1|END"},
+		{"append b 0 0 1\r\nc\r\n", "", "STORED"},
+		{"prepend b 0 0 1\r\na\r\n", "", "STORED"},
+		{"append c 0 0 1\r\nc\r\n", "", "NOT_STORED"},
+		{"get b\r\n", "END", "VALUE b 0 4|abbc|END"},
+		{"incr a 41\r\n", "", "42"},
+		{"decr a 100\r\n", "", "0"},
+		{"incr b 1\r\n", "", "CLIENT_ERROR cannot increment or decrement non-numeric value"},
+		{"incr c 1\r\n", "", "NOT_FOUND"},
+		{"touch a 100\r\n", "", "TOUCHED"},
+		{"touch c 100\r\n", "", "NOT_FOUND"},
+		{"delete a noreply\r\ndelete a\r\n", "", "NOT_FOUND"},
+		{"set c 0 -1 1\r\nc\r\n", "", "STORED"},
+		{"get c\r\n", "END", "END"},
+		{"version\r\n", "", "VERSION shardmap"},
+		{"foo\r\n", "", "ERROR"},
+		{"flush_all\r\n", "", "OK"},
+		{"get b\r\n", "END", "END"},
+	} {
+		if reply := do(tc.req, tc.last); reply != tc.reply {
+			t.Fatalf("%q: expected '%v', got '%v'", tc.req, tc.reply, reply)
+		}
+	}
+	if ttl, ok := m.TTL("b"); ok {
+		t.Fatalf("expected no value, got a ttl of '%v'", ttl)
+	}
+
+	s.Close()
+	if err := <-served; err != ErrServerClosed {
+		t.Fatalf("expected '%v', got '%v'", ErrServerClosed, err)
+	}
+}
+
+func TestExptime(t *testing.T) {
+	if ttl, ok := exptime([]byte("0")); !ok || ttl != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, ttl)
+	}
+	if ttl, ok := exptime([]byte("10")); !ok || ttl != 10*time.Second {
+		t.Fatalf("expected '%v', got '%v'", 10*time.Second, ttl)
+	}
+	unix := time.Now().Add(time.Hour).Unix()
+	if ttl, ok := exptime([]byte(strconv.FormatInt(unix, 10))); !ok || ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("expected about '%v', got '%v'", time.Hour, ttl)
+	}
+	if _, ok := exptime([]byte("x")); ok {
+		t.Fatalf("expected '%v', got '%v'", false, ok)
+	}
+}
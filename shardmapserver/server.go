@@ -0,0 +1,530 @@
+// Package shardmapserver serves a shardmap.Map over the Redis protocol, so
+// that a process-local cache can be inspected and modified with redis-cli,
+// or over the memcached text protocol, for legacy clients.
+//
+// The Redis protocol supports PING, ECHO, GET, SET with EX, PX, NX and XX,
+// DEL, EXISTS, EXPIRE, PEXPIRE, TTL, PTTL, SCAN with MATCH and COUNT, DBSIZE
+// and QUIT. The memcached protocol is described by ServeMemcached.
+package shardmapserver
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phuslu/shardmap"
+)
+
+// ErrServerClosed is returned by Serve after Close.
+var ErrServerClosed = errors.New("shardmapserver: server closed")
+
+// maxBulk is the max size of a bulk string of a request.
+const maxBulk = 512 << 20
+
+// Server serves a map over the Redis protocol.
+type Server struct {
+	m *shardmap.Map[string, []byte]
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// New returns a server of m.
+func New(m *shardmap.Map[string, []byte]) *Server {
+	return &Server{
+		m:         m,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and serves its connections.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l and serves each of them in a goroutine,
+// until Close. It closes l when it returns.
+// Returns ErrServerClosed after Close, or the error of accepting.
+func (s *Server) Serve(l net.Listener) error {
+	return s.accept(l, s.serve)
+}
+
+// accept accepts connections on l and serves each of them with serve in a
+// goroutine, until Close.
+func (s *Server) accept(l net.Listener, serve func(c net.Conn)) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.listeners, l)
+		s.mu.Unlock()
+		l.Close()
+	}()
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return ErrServerClosed
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go func() {
+			defer s.done(c)
+			defer func() {
+				// a bad connection is closed, without taking the process down
+				recover()
+			}()
+			serve(c)
+		}()
+	}
+}
+
+// Close closes the listeners and the connections, and waits for the
+// connections being served.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+// done closes a connection which was served.
+func (s *Server) done(c net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, c)
+	s.mu.Unlock()
+	c.Close()
+	s.wg.Done()
+}
+
+func (s *Server) serve(c net.Conn) {
+	r := bufio.NewReader(c)
+	w := bufio.NewWriter(c)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if err != io.EOF {
+				writeError(w, "ERR Protocol error: "+err.Error())
+				w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := s.exec(w, args)
+		// replies of pipelined commands are flushed together
+		if r.Buffered() == 0 || quit {
+			if w.Flush() != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+// arity is the number of arguments of the commands, or minus one plus the
+// minimum number.
+var arity = map[string]int{
+	"PING": -1, "ECHO": 1, "GET": 1, "SET": -3, "DEL": -2, "EXISTS": -2,
+	"EXPIRE": 2, "PEXPIRE": 2, "TTL": 1, "PTTL": 1, "SCAN": -2,
+	"DBSIZE": 0, "QUIT": 0, "COMMAND": -1,
+}
+
+// exec runs a command and writes its reply.
+// Returns true when the connection must be closed.
+func (s *Server) exec(w *bufio.Writer, args [][]byte) (quit bool) {
+	name := strings.ToUpper(string(args[0]))
+	args = args[1:]
+	n, ok := arity[name]
+	switch {
+	case !ok:
+		writeError(w, "ERR unknown command '"+name+"'")
+		return false
+	case n >= 0 && len(args) != n || n < 0 && len(args) < -n-1:
+		writeError(w, "ERR wrong number of arguments for '"+strings.ToLower(name)+"' command")
+		return false
+	}
+	switch name {
+	case "PING":
+		if len(args) > 0 {
+			writeBulk(w, args[0])
+		} else {
+			w.WriteString("+PONG\r\n")
+		}
+	case "ECHO":
+		writeBulk(w, args[0])
+	case "GET":
+		if value, ok := s.m.Get(string(args[0])); ok {
+			writeBulk(w, value)
+		} else {
+			w.WriteString("$-1\r\n")
+		}
+	case "SET":
+		s.set(w, args)
+	case "DEL", "EXISTS":
+		var count int
+		for _, key := range args {
+			if name == "DEL" {
+				_, ok = s.m.Delete(string(key))
+			} else {
+				ok = s.m.Has(string(key))
+			}
+			if ok {
+				count++
+			}
+		}
+		writeInt(w, int64(count))
+	case "EXPIRE", "PEXPIRE":
+		ttl, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil {
+			writeError(w, "ERR value is not an integer or out of range")
+			break
+		}
+		unit := time.Second
+		if name == "PEXPIRE" {
+			unit = time.Millisecond
+		}
+		key := string(args[0])
+		if ttl <= 0 {
+			_, ok = s.m.Delete(key)
+		} else {
+			ok = s.m.Expire(key, time.Duration(ttl)*unit)
+		}
+		writeBool(w, ok)
+	case "TTL", "PTTL":
+		ttl, ok := s.m.TTL(string(args[0]))
+		switch {
+		case !ok:
+			writeInt(w, -2)
+		case ttl == 0:
+			writeInt(w, -1)
+		case name == "TTL":
+			writeInt(w, int64((ttl+time.Second-1)/time.Second))
+		default:
+			writeInt(w, int64((ttl+time.Millisecond-1)/time.Millisecond))
+		}
+	case "SCAN":
+		s.scan(w, args)
+	case "DBSIZE":
+		writeInt(w, int64(s.m.Len()))
+	case "QUIT":
+		w.WriteString("+OK\r\n")
+		return true
+	case "COMMAND":
+		// redis-cli asks for the command docs on startup
+		w.WriteString("*0\r\n")
+	}
+	return false
+}
+
+// set runs SET key value [EX seconds|PX milliseconds] [NX|XX].
+func (s *Server) set(w *bufio.Writer, args [][]byte) {
+	key, value := string(args[0]), append([]byte(nil), args[1]...)
+	var ttl time.Duration
+	var nx, xx bool
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 == len(args) {
+				writeError(w, "ERR syntax error")
+				return
+			}
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil || n <= 0 {
+				writeError(w, "ERR invalid expire time in 'set' command")
+				return
+			}
+			ttl = time.Duration(n) * time.Millisecond
+			if opt == "EX" {
+				ttl = time.Duration(n) * time.Second
+			}
+		default:
+			writeError(w, "ERR syntax error")
+			return
+		}
+	}
+	if nx && xx {
+		writeError(w, "ERR syntax error")
+		return
+	}
+	switch {
+	case nx || xx:
+		var done bool
+		if nx {
+			done = s.m.SetIfAbsent(key, value)
+		} else {
+			_, done = s.m.Replace(key, value)
+		}
+		if !done {
+			w.WriteString("$-1\r\n")
+			return
+		}
+		// the ttl is set apart from the value, which SET NX or XX may
+		// expose briefly
+		if ttl > 0 || xx {
+			s.m.Expire(key, ttl)
+		}
+	default:
+		s.m.SetWithTTL(key, value, ttl)
+	}
+	w.WriteString("+OK\r\n")
+}
+
+// scan runs SCAN cursor [MATCH pattern] [COUNT count], whose cursor is the
+// next shard to scan, so that the keys present during the whole scan are all
+// returned.
+func (s *Server) scan(w *bufio.Writer, args [][]byte) {
+	cursor, err := strconv.Atoi(string(args[0]))
+	if err != nil || cursor < 0 {
+		writeError(w, "ERR invalid cursor")
+		return
+	}
+	var pattern string
+	count := 10
+	for i := 1; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			writeError(w, "ERR syntax error")
+			return
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = string(args[i+1])
+		case "COUNT":
+			if count, err = strconv.Atoi(string(args[i+1])); err != nil || count < 1 {
+				writeError(w, "ERR syntax error")
+				return
+			}
+		default:
+			writeError(w, "ERR syntax error")
+			return
+		}
+	}
+	var keys []string
+	scanned := 0
+	for cursor < s.m.NumShards() && scanned < count {
+		s.m.RangeShard(cursor, func(key string, _ []byte) bool {
+			scanned++
+			if pattern == "" || match(pattern, key) {
+				keys = append(keys, key)
+			}
+			return true
+		})
+		cursor++
+	}
+	if cursor >= s.m.NumShards() {
+		cursor = 0
+	}
+	w.WriteString("*2\r\n")
+	writeBulk(w, []byte(strconv.Itoa(cursor)))
+	w.WriteString("*" + strconv.Itoa(len(keys)) + "\r\n")
+	for _, key := range keys {
+		writeBulk(w, []byte(key))
+	}
+}
+
+// readCommand reads a command, either an array of bulk strings or an inline
+// command of words separated by spaces.
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		var args [][]byte
+		for _, f := range strings.Fields(string(line)) {
+			args = append(args, []byte(f))
+		}
+		return args, nil
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n < -1 || n > 1024*1024 {
+		return nil, errors.New("invalid multibulk length")
+	}
+	if n <= 0 {
+		return nil, nil // an empty command, as *-1 and *0 are to Redis
+	}
+	// the length is the client's word, so args only grow as they are read
+	size := n
+	if size > 16 {
+		size = 16
+	}
+	args := make([][]byte, 0, size)
+	for i := 0; i < n; i++ {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, errors.New("expected '$'")
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > maxBulk {
+			return nil, errors.New("invalid bulk length")
+		}
+		arg := make([]byte, size+2)
+		if _, err := io.ReadFull(r, arg); err != nil {
+			return nil, err
+		}
+		if arg[size] != '\r' || arg[size+1] != '\n' {
+			return nil, errors.New("expected CRLF")
+		}
+		args = append(args, arg[:size])
+	}
+	return args, nil
+}
+
+// readLine reads a line, without its CRLF or LF.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, errors.New("too big inline request")
+	}
+	if err != nil {
+		if err == io.EOF && len(line) > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	line = line[:len(line)-1]
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return line, nil
+}
+
+func writeError(w *bufio.Writer, msg string) {
+	w.WriteString("-" + msg + "\r\n")
+}
+
+func writeInt(w *bufio.Writer, n int64) {
+	w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func writeBool(w *bufio.Writer, b bool) {
+	if b {
+		writeInt(w, 1)
+	} else {
+		writeInt(w, 0)
+	}
+}
+
+func writeBulk(w *bufio.Writer, b []byte) {
+	w.WriteString("$" + strconv.Itoa(len(b)) + "\r\n")
+	w.Write(b)
+	w.WriteString("\r\n")
+}
+
+// match reports whether s matches the glob-style pattern of Redis: * matches
+// any string, ? any byte, [abc] [^a] [a-z] a set of bytes, and \ escapes.
+func match(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if match(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			p := pattern[1:]
+			not := len(p) > 0 && p[0] == '^'
+			if not {
+				p = p[1:]
+			}
+			found := false
+			for len(p) > 0 && p[0] != ']' {
+				switch {
+				case p[0] == '\\' && len(p) > 1:
+					found = found || p[1] == s[0]
+					p = p[2:]
+				case len(p) > 2 && p[1] == '-' && p[2] != ']':
+					lo, hi := p[0], p[2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					found = found || lo <= s[0] && s[0] <= hi
+					p = p[3:]
+				default:
+					found = found || p[0] == s[0]
+					p = p[1:]
+				}
+			}
+			if found == not {
+				return false
+			}
+			if len(p) > 0 {
+				p = p[1:] // ]
+			}
+			pattern, s = p, s[1:]
+			continue
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
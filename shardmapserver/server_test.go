@@ -0,0 +1,185 @@
+package shardmapserver
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/phuslu/shardmap"
+)
+
+func TestServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := shardmap.New[string, []byte](0, shardmap.WithShards[string, []byte](4))
+	s := New(m)
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(l) }()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	r := bufio.NewReader(c)
+	do := func(args ...string) string {
+		req := "*" + strconv.Itoa(len(args)) + "\r\n"
+		for _, arg := range args {
+			req += "$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n"
+		}
+		if _, err := c.Write([]byte(req)); err != nil {
+			t.Fatal(err)
+		}
+		return readReply(t, r)
+	}
+
+	for _, tc := range []struct {
+		args  []string
+		reply string
+	}{
+		{[]string{"PING"}, "PONG"},
+		{[]string{"GET", "a"}, "(nil)"},
+		{[]string{"SET", "a", "1"}, "OK"},
+		{[]string{"SET", "a", "2", "NX"}, "(nil)"},
+		{[]string{"SET", "b", "2", "XX"}, "(nil)"},
+		{[]string{"SET", "b", "2", "EX", "100"}, "OK"},
+		{[]string{"GET", "a"}, "1"},
+		{[]string{"TTL", "a"}, "-1"},
+		{[]string{"TTL", "b"}, "100"},
+		{[]string{"TTL", "c"}, "-2"},
+		{[]string{"EXPIRE", "a", "10"}, "1"},
+		{[]string{"EXPIRE", "c", "10"}, "0"},
+		{[]string{"PTTL", "a"}, "10000"},
+		{[]string{"EXISTS", "a", "b", "c"}, "2"},
+		{[]string{"DBSIZE"}, "2"},
+		{[]string{"DEL", "a", "c"}, "1"},
+		{[]string{"GET", "a"}, "(nil)"},
+		{[]string{"SET", "a"}, "ERR wrong number of arguments for 'set' command"},
+		{[]string{"FOO"}, "ERR unknown command 'FOO'"},
+	} {
+		if reply := do(tc.args...); reply != tc.reply {
+			t.Fatalf("%v: expected '%v', got '%v'", tc.args, tc.reply, reply)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		m.Set("key:"+strconv.Itoa(i), nil)
+	}
+	seen := make(map[string]bool)
+	cursor := "0"
+	for {
+		reply := do("SCAN", cursor, "MATCH", "key:[1-2]?", "COUNT", "5")
+		fields := strings.Fields(reply)
+		for _, key := range fields[1:] {
+			seen[key] = true
+		}
+		if cursor = fields[0]; cursor == "0" {
+			break
+		}
+	}
+	if len(seen) != 20 {
+		t.Fatalf("expected '%v', got '%v'", 20, len(seen))
+	}
+
+	// inline commands
+	c.Write([]byte("ECHO hello\r\n"))
+	if reply := readReply(t, r); reply != "hello" {
+		t.Fatalf("expected '%v', got '%v'", "hello", reply)
+	}
+
+	s.Close()
+	if err := <-served; err != ErrServerClosed {
+		t.Fatalf("expected '%v', got '%v'", ErrServerClosed, err)
+	}
+}
+
+// readReply reads a reply, arrays being rendered as their elements separated
+// by spaces.
+func readReply(t *testing.T, r *bufio.Reader) string {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return "(nil)"
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			t.Fatal(err)
+		}
+		return string(b[:n])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		var elems []string
+		for i := 0; i < n; i++ {
+			elems = append(elems, readReply(t, r))
+		}
+		return strings.Join(elems, " ")
+	}
+	return line[1:]
+}
+
+func TestMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"*", "", true},
+		{"a*c", "abbc", true},
+		{"a*c", "abb", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"[a-c]x", "bx", true},
+		{"[^a-c]x", "bx", false},
+		{"[xyz]", "y", true},
+		{`a\*`, "a*", true},
+		{`a\*`, "ab", false},
+	} {
+		if got := match(tc.pattern, tc.s); got != tc.match {
+			t.Fatalf("%q %q: expected '%v', got '%v'", tc.pattern, tc.s, tc.match, got)
+		}
+	}
+}
+
+func TestServerBadMultibulk(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(shardmap.New[string, []byte](0))
+	defer s.Close()
+	go s.Serve(l)
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	r := bufio.NewReader(c)
+	// empty commands are skipped, like Redis does
+	c.Write([]byte("*-1\r\n*0\r\n*1\r\n$4\r\nPING\r\n"))
+	if reply := readReply(t, r); reply != "PONG" {
+		t.Fatalf("expected '%v', got '%v'", "PONG", reply)
+	}
+	c.Write([]byte("*-2\r\n"))
+	if reply := readReply(t, r); reply != "ERR Protocol error: invalid multibulk length" {
+		t.Fatalf("expected '%v', got '%v'", "ERR Protocol error: invalid multibulk length", reply)
+	}
+	// a huge length costs nothing until its arguments are sent
+	c2, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	c2.Write([]byte("*1048576\r\n$4\r\nPING\r\n"))
+	c2.Close()
+}
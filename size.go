@@ -0,0 +1,64 @@
+package shardmap
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// WithSizer makes SizeBytes add the size of the memory referenced by every
+// key/value, as returned by fn, e.g. the bytes of a string or of a slice,
+// which the map can't tell by itself.
+func WithSizer[K comparable, V any](fn func(key K, value V) uint64) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.sizeFn = fn
+	}
+}
+
+// SizeBytes estimates the memory used by the map: its shards and locks,
+// their buckets holding the keys and values inline, their metadata, Bloom
+// filters, read-only copies and change logs, plus the sizes returned by the
+// function of WithSizer for every key/value. The secondary indexes and the
+// memory referenced by keys and values are not counted otherwise. Shards are
+// read one at a time.
+func (m *Map[K, V]) SizeBytes() uint64 {
+	m.lazyInit()
+	size := uint64(unsafe.Sizeof(*m)) +
+		uint64(len(m.mus))*uint64(unsafe.Sizeof(syncRWMutex{})+unsafe.Sizeof(shard[K, V]{}))
+	for i := 0; i < len(m.mus); i++ {
+		if atomic.LoadUint32(&m.debug) != 0 {
+			m.debugLock(i, false)
+		}
+		m.mus[i].RLock()
+		s := &m.shards[i]
+		for t := s; t != nil; t = t.old {
+			size += t.tableBytes()
+		}
+		if m.tables != nil {
+			if t := m.table(i); t != nil && t != s {
+				size += t.tableBytes()
+			}
+		}
+		if m.logs != nil {
+			size += uint64(cap(m.logs[i].changes)) * uint64(unsafe.Sizeof(Change[K, V]{}))
+		}
+		if m.sizeFn != nil {
+			s.Range(func(key K, value V) bool {
+				size += m.sizeFn(key, value)
+				return true
+			})
+		}
+		m.mus[i].RUnlock()
+	}
+	return size
+}
+
+// tableBytes returns the size of the buckets of a shard, with their metadata
+// and Bloom filter.
+func (m *shard[K, V]) tableBytes() uint64 {
+	size := uint64(len(m.buckets))*uint64(unsafe.Sizeof(entry[K, V]{})) +
+		uint64(len(m.metas))*uint64(unsafe.Sizeof(meta{}))
+	if m.bloom != nil {
+		size += uint64(len(m.bloom.words)) * 8
+	}
+	return size
+}
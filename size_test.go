@@ -0,0 +1,34 @@
+package shardmap
+
+import (
+	"testing"
+	"unsafe"
+)
+
+func TestSizeBytes(t *testing.T) {
+	m := New[int, string](0, WithShards[int, string](4), WithSeed[int, string](1))
+	empty := m.SizeBytes()
+	if min := uint64(4 * 8 * unsafe.Sizeof(entry[int, string]{})); empty < min {
+		t.Fatalf("expected at least '%v', got '%v'", min, empty)
+	}
+	for i := 0; i < 1000; i++ {
+		m.Set(i, "0123456789")
+	}
+	var buckets int
+	for _, s := range m.Stats().Shards {
+		buckets += s.Buckets
+	}
+	if want := empty + uint64(buckets-4*8)*uint64(unsafe.Sizeof(entry[int, string]{})); m.SizeBytes() != want {
+		t.Fatalf("expected '%v', got '%v'", want, m.SizeBytes())
+	}
+
+	sized := New[int, string](0, WithShards[int, string](4), WithSeed[int, string](1), WithSizer(func(key int, value string) uint64 {
+		return uint64(len(value))
+	}))
+	for i := 0; i < 1000; i++ {
+		sized.Set(i, "0123456789")
+	}
+	if want := m.SizeBytes() + 1000*10; sized.SizeBytes() != want {
+		t.Fatalf("expected '%v', got '%v'", want, sized.SizeBytes())
+	}
+}
@@ -0,0 +1,116 @@
+package shardmap
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrRehash is returned by Rehash for the underlying map of a Map2, whose
+// shards are picked by its outer keys.
+var ErrRehash = errors.New("shardmap: map can't be rehashed")
+
+// Skew returns the ratio of the length of the longest shard to the mean length
+// of the shards as of LenApprox, 1 meaning that the values are spread evenly.
+// Returns 0 when the map is empty.
+func (m *Map[K, V]) Skew() float64 {
+	m.lazyInit()
+	var max, total int64
+	for i := 0; i < len(m.mus); i++ {
+		n := atomic.LoadInt64(&m.mus[i].length)
+		if n > max {
+			max = n
+		}
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(max) * float64(len(m.mus)) / float64(total)
+}
+
+// Rehash re-seeds the hash which picks the shards of the keys, then moves all
+// values to their new shards, to spread them again when Skew shows that a poor
+// hasher or adversarial keys crowd a few shards. A zero seed restores the
+// default layout, which picks shards by the low bits of the key hashes.
+//
+// The whole map is write locked meanwhile.
+// Returns ErrRehash for the underlying map of a Map2, whose pairs of an outer
+// key would be scattered, and ErrReadOnly when the map is read-only.
+func (m *Map[K, V]) Rehash(seed uint64) error {
+	m.lazyInit()
+	if m.pinned {
+		return ErrRehash
+	}
+	var debug uint32
+	for i := 0; i < len(m.mus); i++ {
+		var ok bool
+		if debug, ok = m.lock(i); !ok {
+			for j := 0; j < i; j++ {
+				m.unlock(j, debug)
+			}
+			return ErrReadOnly
+		}
+	}
+	atomic.AddUint32(&m.gen, 1)
+
+	var entries []entry[K, V]
+	var metas []meta
+	var now int64
+	for i := range m.shards {
+		s := &m.shards[i]
+		for t := s; t != nil; t = t.old {
+			for j := 0; j < len(t.buckets); j++ {
+				switch {
+				case int(t.buckets[j].hdib&maxDIB) == 0:
+				case t.metas != nil && t.metas[j].expired(&now):
+					s.dropEntry(t.buckets[j].key, t.buckets[j].value, ReasonExpired)
+				default:
+					md := meta{}
+					if t.metas != nil {
+						md = t.metas[j]
+					}
+					entries, metas = append(entries, t.buckets[j]), append(metas, md)
+				}
+			}
+		}
+		s.init(m.cap / len(m.mus))
+	}
+
+	atomic.StoreUint64(&m.reseed, seed)
+	for j, e := range entries {
+		hash := m.hash(e.key)
+		m.shards[m.shardOf(hash)].add(hash, e.key, e.value, metas[j])
+	}
+	// in-flight GetOrCompute calls follow their keys
+	for i := range m.calls {
+		for key, c := range m.calls[i] {
+			if j := m.shardOf(m.hash(key)); j != i {
+				if m.calls[j] == nil {
+					m.calls[j] = make(map[K]*call[V])
+				}
+				m.calls[j][key] = c
+				delete(m.calls[i], key)
+			}
+		}
+	}
+	for i := range m.tables {
+		atomic.StorePointer(&m.tables[i], nil) // republished by unlock
+	}
+
+	for i := 0; i < len(m.mus); i++ {
+		m.unlock(i, debug)
+	}
+	atomic.AddUint32(&m.gen, 1)
+	return nil
+}
+
+// add inserts an entry moved from another shard along with its metadata.
+func (m *shard[K, V]) add(xxh uint64, key K, value V, md meta) {
+	if m.length >= m.growAt {
+		m.resize(len(m.buckets) * 2)
+	}
+	if md != (meta{}) && m.metas == nil {
+		m.metas = make([]meta, len(m.buckets))
+	}
+	m.set(int(xxh>>dibBitSize), key, value, md, true)
+}
@@ -0,0 +1,99 @@
+package shardmap
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRehash(t *testing.T) {
+	// the low bits of all hashes are the same
+	hasher := func(key int) uint64 { return uint64(key) * 0x9E3779B97F4A7C15 &^ 0xFF }
+	m := New[int, int](0, WithShards[int, int](16), WithHasher[int, int](hasher), WithBloomFilter[int, int]())
+	if s := m.Skew(); s != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, s)
+	}
+	for i := 0; i < 10000; i++ {
+		m.Set(i, i)
+	}
+	m.SetWithTTL(-1, -1, time.Hour)
+	if s := m.Skew(); s != 16 {
+		t.Fatalf("expected '%v', got '%v'", 16, s)
+	}
+	m.Rehash(42)
+	m.SetDebugLevel(DebugVerify)
+	if s := m.Skew(); s > 1.5 {
+		t.Fatalf("expected a skew below 1.5, got '%v'", s)
+	}
+	if n := m.Len(); n != 10001 {
+		t.Fatalf("expected '%v', got '%v'", 10001, n)
+	}
+	for i := -1; i < 10000; i++ {
+		if v, ok := m.Get(i); !ok || v != i {
+			t.Fatalf("expected '%v', got '%v'", i, v)
+		}
+	}
+	m.Delete(5)
+	if _, ok := m.Get(5); ok {
+		t.Fatalf("expected '%v', got '%v'", false, ok)
+	}
+
+	var buf bytes.Buffer
+	if _, err := m.Clone().WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	c := New[int, int](0, WithShards[int, int](16))
+	if _, err := c.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if n := c.Len(); n != 10000 {
+		t.Fatalf("expected '%v', got '%v'", 10000, n)
+	}
+}
+
+func TestRehashConcurrent(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](8), WithCopyOnWrite[int, int]())
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if v, ok := m.Get(i); !ok || v != i {
+					t.Errorf("expected '%v', got '%v'", i, v)
+					return
+				}
+				m.Set(i, i)
+			}
+		}()
+	}
+	for seed := uint64(1); seed <= 20; seed++ {
+		m.Rehash(seed)
+	}
+	wg.Wait()
+	m.Rehash(0)
+	if n := m.Len(); n != 1000 {
+		t.Fatalf("expected '%v', got '%v'", 1000, n)
+	}
+}
+
+func TestRehashRefused(t *testing.T) {
+	m2 := NewMap2[int, int, int](0)
+	m2.Set(1, 1, 1)
+	if err := m2.Map().Rehash(42); err != ErrRehash {
+		t.Fatalf("expected '%v', got '%v'", ErrRehash, err)
+	}
+	m := New[int, int](0)
+	m.SetReadOnly(true)
+	if err := m.Rehash(42); err != ErrReadOnly {
+		t.Fatalf("expected '%v', got '%v'", ErrReadOnly, err)
+	}
+	m.SetReadOnly(false)
+	if err := m.Rehash(42); err != nil {
+		t.Fatalf("expected '%v', got '%v'", nil, err)
+	}
+}
@@ -0,0 +1,284 @@
+package shardmap
+
+import (
+	"encoding/binary"
+	"hash/maphash"
+	"reflect"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// SlabMap is a hashmap of string keys to values without pointers, which are
+// copied into large byte slabs of the shards, indexed by tables of hashes and
+// offsets. Having no pointers, the map costs the garbage collector nothing to
+// scan however large it grows, unlike a Map of strings whose every key is a
+// pointer to mark.
+//
+// Values are copied in and out of the slabs, and replaced in place. Deleted
+// key/values leave holes, which are compacted once they take half a slab.
+//
+// The zero value is not safe for use; use NewSlabMap.
+type SlabMap[V any] struct {
+	mus    []slabMutex
+	shards []slabShard
+	seed   uint64
+	vsize  int
+}
+
+type slabMutex struct {
+	sync.RWMutex
+	_ [64 - unsafe.Sizeof(sync.RWMutex{})]byte // avoid false sharing
+}
+
+// slabShard is an open addressing table of the records of its slab, with
+// linear probing.
+type slabShard struct {
+	slots   []slabSlot
+	mask    int
+	length  int
+	slab    []byte // records of a key length, the key and the value
+	garbage int    // bytes of the deleted records
+}
+
+// slabSlot locates a record, off is 0 when the slot is empty.
+type slabSlot struct {
+	hash uint64
+	off  uint64 // offset of the record in the slab plus one
+}
+
+// slabHeader is the size of the key length of a record.
+const slabHeader = 4
+
+// NewSlabMap returns a new SlabMap with the specified capacity.
+// It panics if V contains pointers, including strings and slices.
+func NewSlabMap[V any](cap int) *SlabMap[V] {
+	var zero V
+	if hasPointers(reflect.TypeOf(&zero).Elem()) {
+		panic("shardmap: SlabMap values must not contain pointers")
+	}
+	n := 1
+	for n < runtime.NumCPU()*16 {
+		n *= 2
+	}
+	m := &SlabMap[V]{
+		mus:    make([]slabMutex, n),
+		shards: make([]slabShard, n),
+		seed:   new(maphash.Hash).Sum64(),
+		vsize:  int(unsafe.Sizeof(zero)),
+	}
+	for i := range m.shards {
+		m.shards[i].init(cap / n)
+	}
+	return m
+}
+
+func (s *slabShard) init(cap int) {
+	n := 8
+	for n*3 < cap*4 {
+		n *= 2
+	}
+	s.slots = make([]slabSlot, n)
+	s.mask = n - 1
+	s.length = 0
+	s.slab, s.garbage = nil, 0
+}
+
+// find returns the slot of a key, or -1 when the key is absent.
+func (s *slabShard) find(hash uint64, key string) int {
+	for i := int(hash) & s.mask; ; i = (i + 1) & s.mask {
+		slot := s.slots[i]
+		if slot.off == 0 {
+			return -1
+		}
+		if slot.hash == hash && s.key(slot.off-1) == key {
+			return i
+		}
+	}
+}
+
+// key returns the key of the record at off, which must not outlive the slab.
+func (s *slabShard) key(off uint64) string {
+	n := binary.LittleEndian.Uint32(s.slab[off:])
+	return b2s(s.slab[off+slabHeader : off+slabHeader+uint64(n)])
+}
+
+// value returns the bytes of the value of the record at off.
+func (s *slabShard) value(off uint64, vsize int) []byte {
+	n := binary.LittleEndian.Uint32(s.slab[off:])
+	start := off + slabHeader + uint64(n)
+	return s.slab[start : start+uint64(vsize)]
+}
+
+// append adds a record to the slab, and returns its offset.
+func (s *slabShard) append(key string, value []byte) uint64 {
+	off := uint64(len(s.slab))
+	var header [slabHeader]byte
+	binary.LittleEndian.PutUint32(header[:], uint32(len(key)))
+	s.slab = append(s.slab, header[:]...)
+	s.slab = append(s.slab, key...)
+	s.slab = append(s.slab, value...)
+	return off
+}
+
+// insert puts a slot in the table, whose key must be absent.
+func (s *slabShard) insert(slot slabSlot) {
+	i := int(slot.hash) & s.mask
+	for s.slots[i].off != 0 {
+		i = (i + 1) & s.mask
+	}
+	s.slots[i] = slot
+}
+
+func (s *slabShard) grow() {
+	slots := s.slots
+	s.slots = make([]slabSlot, len(slots)*2)
+	s.mask = len(s.slots) - 1
+	for _, slot := range slots {
+		if slot.off != 0 {
+			s.insert(slot)
+		}
+	}
+}
+
+// remove empties slot i, shifting back the slots following it which would no
+// longer be found.
+func (s *slabShard) remove(i int) {
+	for j := i; ; {
+		j = (j + 1) & s.mask
+		if s.slots[j].off == 0 {
+			break
+		}
+		// the slot j stays unless its home is cyclically outside of (i, j]
+		home := int(s.slots[j].hash) & s.mask
+		if i <= j && (home <= i || home > j) || i > j && home <= i && home > j {
+			s.slots[i] = s.slots[j]
+			i = j
+		}
+	}
+	s.slots[i] = slabSlot{}
+}
+
+// compact copies the live records to a new slab, without holes.
+func (s *slabShard) compact(vsize int) {
+	slab := make([]byte, 0, len(s.slab)-s.garbage)
+	for i, slot := range s.slots {
+		if slot.off == 0 {
+			continue
+		}
+		off := slot.off - 1
+		n := uint64(binary.LittleEndian.Uint32(s.slab[off:]))
+		s.slots[i].off = uint64(len(slab)) + 1
+		slab = append(slab, s.slab[off:off+slabHeader+n+uint64(vsize)]...)
+	}
+	s.slab, s.garbage = slab, 0
+}
+
+// bytesOf returns the bytes of a value.
+func bytesOf[V any](value *V, size int) []byte {
+	return unsafe.Slice((*byte)(unsafe.Pointer(value)), size)
+}
+
+func (m *SlabMap[V]) shard(key string) (uint64, int) {
+	hash := wyhash_HashString(key, m.seed)
+	return hash, int(hash>>32) & (len(m.shards) - 1)
+}
+
+// Set assigns a value to a key, copying both into the slab.
+// Returns the previous value, or false when no value was assigned.
+func (m *SlabMap[V]) Set(key string, value V) (prev V, replaced bool) {
+	hash, i := m.shard(key)
+	m.mus[i].Lock()
+	s := &m.shards[i]
+	if j := s.find(hash, key); j >= 0 {
+		v := s.value(s.slots[j].off-1, m.vsize)
+		copy(bytesOf(&prev, m.vsize), v)
+		copy(v, bytesOf(&value, m.vsize))
+		m.mus[i].Unlock()
+		return prev, true
+	}
+	if (s.length+1)*4 > len(s.slots)*3 {
+		s.grow()
+	}
+	s.insert(slabSlot{hash: hash, off: s.append(key, bytesOf(&value, m.vsize)) + 1})
+	s.length++
+	m.mus[i].Unlock()
+	return prev, false
+}
+
+// Get returns a value for a key.
+// Returns false when no value has been assign for key.
+func (m *SlabMap[V]) Get(key string) (value V, ok bool) {
+	hash, i := m.shard(key)
+	m.mus[i].RLock()
+	s := &m.shards[i]
+	if j := s.find(hash, key); j >= 0 {
+		copy(bytesOf(&value, m.vsize), s.value(s.slots[j].off-1, m.vsize))
+		ok = true
+	}
+	m.mus[i].RUnlock()
+	return value, ok
+}
+
+// Delete deletes a value for a key.
+// Returns the deleted value, or false when no value was assigned.
+func (m *SlabMap[V]) Delete(key string) (prev V, deleted bool) {
+	hash, i := m.shard(key)
+	m.mus[i].Lock()
+	s := &m.shards[i]
+	if j := s.find(hash, key); j >= 0 {
+		copy(bytesOf(&prev, m.vsize), s.value(s.slots[j].off-1, m.vsize))
+		s.garbage += slabHeader + len(key) + m.vsize
+		s.remove(j)
+		s.length--
+		if s.length == 0 {
+			s.slab, s.garbage = s.slab[:0], 0
+		} else if s.garbage > len(s.slab)/2 {
+			s.compact(m.vsize)
+		}
+		deleted = true
+	}
+	m.mus[i].Unlock()
+	return prev, deleted
+}
+
+// Len returns the number of values in map.
+func (m *SlabMap[V]) Len() (n int) {
+	for i := range m.shards {
+		m.mus[i].RLock()
+		n += m.shards[i].length
+		m.mus[i].RUnlock()
+	}
+	return n
+}
+
+// Range iterates over all key/values, shard by shard under their read lock.
+// The key shares the memory of the slab and must not be retained, and the fn
+// function must not access the map.
+func (m *SlabMap[V]) Range(iter func(key string, value V) bool) {
+	for i := range m.shards {
+		m.mus[i].RLock()
+		s := &m.shards[i]
+		for _, slot := range s.slots {
+			if slot.off == 0 {
+				continue
+			}
+			var value V
+			copy(bytesOf(&value, m.vsize), s.value(slot.off-1, m.vsize))
+			if !iter(s.key(slot.off-1), value) {
+				m.mus[i].RUnlock()
+				return
+			}
+		}
+		m.mus[i].RUnlock()
+	}
+}
+
+// Clear out all values from map
+func (m *SlabMap[V]) Clear() {
+	for i := range m.shards {
+		m.mus[i].Lock()
+		m.shards[i].init(0)
+		m.mus[i].Unlock()
+	}
+}
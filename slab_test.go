@@ -0,0 +1,105 @@
+package shardmap
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSlabMap(t *testing.T) {
+	type point struct {
+		X, Y int32
+		Z    [3]byte
+	}
+	m := NewSlabMap[point](0)
+	want := make(map[string]point)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		key := strconv.Itoa(r.Intn(5000))
+		switch r.Intn(3) {
+		case 0, 1:
+			p := point{X: int32(i), Y: -int32(i), Z: [3]byte{byte(i)}}
+			prev, replaced := m.Set(key, p)
+			if old, ok := want[key]; ok != replaced || prev != old {
+				t.Fatalf("expected '%v', got '%v'", old, prev)
+			}
+			want[key] = p
+		case 2:
+			prev, deleted := m.Delete(key)
+			if old, ok := want[key]; ok != deleted || prev != old {
+				t.Fatalf("expected '%v', got '%v'", old, prev)
+			}
+			delete(want, key)
+		}
+	}
+	if m.Len() != len(want) {
+		t.Fatalf("expected '%v', got '%v'", len(want), m.Len())
+	}
+	for key, p := range want {
+		if v, ok := m.Get(key); !ok || v != p {
+			t.Fatalf("expected '%v', got '%v'", p, v)
+		}
+	}
+	n := 0
+	m.Range(func(key string, value point) bool {
+		if want[key] != value {
+			t.Fatalf("expected '%v', got '%v'", want[key], value)
+		}
+		n++
+		return true
+	})
+	if n != len(want) {
+		t.Fatalf("expected '%v', got '%v'", len(want), n)
+	}
+	m.Clear()
+	if _, ok := m.Get("1"); ok || m.Len() != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, m.Len())
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expected values with pointers to panic")
+			}
+		}()
+		NewSlabMap[string](0)
+	}()
+}
+
+func TestSlabMapConcurrent(t *testing.T) {
+	m := NewSlabMap[int64](1000)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := strconv.Itoa(g*1000 + i)
+				m.Set(key, int64(i))
+				if v, ok := m.Get(key); !ok || v != int64(i) {
+					t.Errorf("expected '%v', got '%v'", i, v)
+				}
+				if i%2 == 0 {
+					m.Delete(key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if m.Len() != 4000 {
+		t.Fatalf("expected '%v', got '%v'", 4000, m.Len())
+	}
+}
+
+func BenchmarkSlabMapSet(b *testing.B) {
+	m := NewSlabMap[int64](b.N)
+	keys := make([]string, 1<<16)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Set(keys[i&(len(keys)-1)], int64(i))
+	}
+}
@@ -0,0 +1,429 @@
+package shardmap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// snapshot format, all integers are uvarints unless noted:
+//
+//	magic "shardmap", version, byte order (1 little, 2 big), shards,
+//	hasher (0 wyhash, 1 custom, 2 wyhash with lock stripes or a Rehash seed),
+//	seed (8 bytes, little endian)
+//	for each shard: count, then count times: size, payload
+//	payload: hash (8 bytes, little endian), ttl, key, value
+//
+// The ttl is the time left before the value expires in nanoseconds, 0 meaning
+// never. Version 3 snapshots have no ttl and are still read.
+//
+// Strings and byte slices are stored as size + bytes, encoding.BinaryMarshaler
+// types as size + data, and pointer-free fixed size types as raw memory.
+const (
+	snapshotMagic   = "shardmap"
+	snapshotVersion = 4
+)
+
+// ErrSnapshot is returned by ReadFrom when reading a malformed snapshot.
+var ErrSnapshot = errors.New("shardmap: malformed snapshot")
+
+// maxPresize is the max number of entries a shard is grown to upfront by
+// ReadFrom, past which it grows as the entries are read.
+const maxPresize = 1 << 20
+
+// WriteTo implements io.WriterTo, it writes a binary snapshot of the map to w,
+// shard by shard, including the stored hashes so that ReadFrom can load it
+// shard by shard too. Keys and values must be strings, byte slices, implement
+// encoding.BinaryMarshaler or be pointer-free fixed size types. Expired
+// values are skipped, and the others are written with the time they have
+// left, which ReadFrom gives them again.
+func (m *Map[K, V]) WriteTo(w io.Writer) (n int64, err error) {
+	m.lazyInit()
+	kc, err := newCodec[K]()
+	if err != nil {
+		return 0, err
+	}
+	vc, err := newCodec[V]()
+	if err != nil {
+		return 0, err
+	}
+
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	buf := append([]byte(nil), snapshotMagic...)
+	buf = appendUvarint(buf, snapshotVersion)
+	buf = appendUvarint(buf, uint64(nativeOrder()))
+	buf = appendUvarint(buf, uint64(len(m.mus)))
+	buf = appendUvarint(buf, m.hasherID())
+	buf = appendUint64(buf, m.seed)
+	if _, err = bw.Write(buf); err != nil {
+		return cw.n, err
+	}
+
+	var entries []entry[K, V]
+	var expires []int64
+	var payload []byte
+	for i := 0; i < len(m.mus); i++ {
+		m.mus[i].RLock()
+		entries, expires = m.shards[i].AppendDeadlines(entries[:0], expires[:0])
+		now := clock()
+		m.mus[i].RUnlock()
+		buf = appendUvarint(buf[:0], uint64(len(entries)))
+		for j := range entries {
+			payload = appendUint64(payload[:0], entries[j].hdib>>dibBitSize<<dibBitSize)
+			var ttl int64
+			if expires[j] != 0 {
+				ttl = expires[j] - now
+				if ttl < 1 {
+					ttl = 1 // expires by the time it's read
+				}
+			}
+			payload = appendUvarint(payload, uint64(ttl))
+			if payload, err = kc.encode(payload, &entries[j].key); err != nil {
+				return cw.n, err
+			}
+			if payload, err = vc.encode(payload, &entries[j].value); err != nil {
+				return cw.n, err
+			}
+			buf = appendUvarint(buf, uint64(len(payload)))
+			buf = append(buf, payload...)
+			if len(buf) >= 64*1024 {
+				if _, err = bw.Write(buf); err != nil {
+					return cw.n, err
+				}
+				buf = buf[:0]
+			}
+		}
+		if _, err = bw.Write(buf); err != nil {
+			return cw.n, err
+		}
+	}
+	err = bw.Flush()
+	return cw.n, err
+}
+
+// ReadFrom implements io.ReaderFrom, it adds the key/values of a snapshot
+// written by WriteTo to the map. Entries are loaded shard by shard, checking
+// their stored hash, when the map has the same shard layout and seed as the
+// snapshot, and both hash keys with wyhash.
+// Returns ErrReadOnly when the map is read-only.
+func (m *Map[K, V]) ReadFrom(r io.Reader) (n int64, err error) {
+	m.lazyInit()
+	kc, err := newCodec[K]()
+	if err != nil {
+		return 0, err
+	}
+	vc, err := newCodec[V]()
+	if err != nil {
+		return 0, err
+	}
+
+	cr := &countReader{r: r}
+	var br interface {
+		io.Reader
+		io.ByteReader
+	} = cr
+	if _, ok := r.(io.ByteReader); !ok {
+		b := bufio.NewReader(cr)
+		defer func() { n -= int64(b.Buffered()) }()
+		br = b
+	}
+	defer func() {
+		n += cr.n
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	magic := make([]byte, len(snapshotMagic))
+	if _, err = io.ReadFull(br, magic); err != nil {
+		return
+	}
+	if string(magic) != snapshotMagic {
+		return n, ErrSnapshot
+	}
+	version, err := binary.ReadUvarint(br)
+	if err != nil {
+		return
+	}
+	if version != snapshotVersion && version != 3 {
+		return n, fmt.Errorf("shardmap: unsupported snapshot version %d", version)
+	}
+	order, err := binary.ReadUvarint(br)
+	if err != nil {
+		return
+	}
+	if order != uint64(nativeOrder()) && (kc.raw || vc.raw) {
+		return n, fmt.Errorf("shardmap: snapshot byte order %d does not match host", order)
+	}
+	shards, err := binary.ReadUvarint(br)
+	if err != nil {
+		return
+	}
+	hasher, err := binary.ReadUvarint(br)
+	if err != nil {
+		return
+	}
+	var seed [8]byte
+	if _, err = io.ReadFull(br, seed[:]); err != nil {
+		return
+	}
+	rehash := shards != uint64(len(m.mus)) || hasher != 0 || m.hasherID() != 0 ||
+		binary.LittleEndian.Uint64(seed[:]) != m.seed
+
+	var buf bytes.Buffer
+	var e entry[K, V]
+	for i := uint64(0); i < shards; i++ {
+		count, err := binary.ReadUvarint(br)
+		if err != nil {
+			return n, err
+		}
+		if !rehash {
+			m.mus[i].Lock()
+			if !m.writable(int(i)) {
+				return n, ErrReadOnly
+			}
+			// the count is only trusted to presize as far as a
+			// shard of maxPresize entries
+			if s, c := &m.shards[i], count; c > 0 {
+				if c > maxPresize {
+					c = maxPresize
+				}
+				if s.length+int(c) > s.growAt {
+					s.resize(s.sizeFor(s.length + int(c)))
+				}
+			}
+			m.mus[i].Unlock()
+		}
+		for j := uint64(0); j < count; j++ {
+			size, err := binary.ReadUvarint(br)
+			if err != nil {
+				return n, err
+			}
+			if size < 8 || size > 1<<40 {
+				return n, ErrSnapshot
+			}
+			// the payload grows as its bytes are read, so that a
+			// forged size can't allocate more than the input holds
+			buf.Reset()
+			if _, err = io.CopyN(&buf, br, int64(size)); err != nil {
+				return n, err
+			}
+			payload := buf.Bytes()
+			hash := binary.LittleEndian.Uint64(payload)
+			b := payload[8:]
+			var ttl uint64
+			if version > 3 {
+				var k int
+				if ttl, k = binary.Uvarint(b); k <= 0 || ttl > math.MaxInt64 {
+					return n, ErrSnapshot
+				}
+				b = b[k:]
+			}
+			if b, err = kc.decode(b, &e.key); err != nil {
+				return n, err
+			}
+			if b, err = vc.decode(b, &e.value); err != nil {
+				return n, err
+			}
+			if len(b) != 0 {
+				return n, ErrSnapshot
+			}
+			if !rehash {
+				// a forged hash would make the key unreachable
+				if full := m.hash(e.key); full>>dibBitSize<<dibBitSize != hash || m.shardOf(full) != int(i) {
+					return n, ErrSnapshot
+				}
+				m.mus[i].Lock()
+				if !m.writable(int(i)) {
+					return n, ErrReadOnly
+				}
+				if atomic.LoadUint64(&m.reseed) != 0 {
+					// rehashed meanwhile
+					m.mus[i].Unlock()
+					rehash = true
+				}
+			}
+			if rehash {
+				if _, _, ok := m.setWithTTL(e.key, e.value, time.Duration(ttl)); !ok {
+					return n, ErrReadOnly
+				}
+				continue
+			}
+			if ttl > 0 {
+				m.shards[i].SetMeta(hash, e.key, e.value, meta{expire: clock() + int64(ttl)})
+			} else {
+				m.shards[i].Set(hash, e.key, e.value)
+			}
+			m.unlock(int(i), 0)
+		}
+	}
+
+	return n, nil
+}
+
+// codec encodes and decodes values of type T for snapshots.
+type codec[T any] struct {
+	raw    bool
+	size   int
+	encode func(buf []byte, v *T) ([]byte, error)
+	decode func(b []byte, v *T) ([]byte, error)
+}
+
+func newCodec[T any]() (*codec[T], error) {
+	var zero T
+	c := &codec[T]{}
+	switch any(zero).(type) {
+	case string:
+		c.encode = func(buf []byte, v *T) ([]byte, error) {
+			s := *(*string)(unsafe.Pointer(v))
+			return append(appendUvarint(buf, uint64(len(s))), s...), nil
+		}
+		c.decode = func(b []byte, v *T) ([]byte, error) {
+			data, b, err := readBytes(b)
+			*(*string)(unsafe.Pointer(v)) = string(data)
+			return b, err
+		}
+		return c, nil
+	case []byte:
+		c.encode = func(buf []byte, v *T) ([]byte, error) {
+			s := *(*[]byte)(unsafe.Pointer(v))
+			return append(appendUvarint(buf, uint64(len(s))), s...), nil
+		}
+		c.decode = func(b []byte, v *T) ([]byte, error) {
+			data, b, err := readBytes(b)
+			*(*[]byte)(unsafe.Pointer(v)) = append([]byte(nil), data...)
+			return b, err
+		}
+		return c, nil
+	}
+	if _, ok := any(&zero).(encoding.BinaryUnmarshaler); ok {
+		if _, ok := any(zero).(encoding.BinaryMarshaler); ok {
+			c.encode = func(buf []byte, v *T) ([]byte, error) {
+				data, err := any(*v).(encoding.BinaryMarshaler).MarshalBinary()
+				return append(appendUvarint(buf, uint64(len(data))), data...), err
+			}
+			c.decode = func(b []byte, v *T) ([]byte, error) {
+				data, b, err := readBytes(b)
+				if err == nil {
+					err = any(v).(encoding.BinaryUnmarshaler).UnmarshalBinary(data)
+				}
+				return b, err
+			}
+			return c, nil
+		}
+	}
+	if t := reflect.TypeOf(&zero).Elem(); pointerFree(t) {
+		c.raw, c.size = true, int(t.Size())
+		c.encode = func(buf []byte, v *T) ([]byte, error) {
+			return append(buf, unsafe.Slice((*byte)(unsafe.Pointer(v)), c.size)...), nil
+		}
+		c.decode = func(b []byte, v *T) ([]byte, error) {
+			if len(b) < c.size {
+				return b, ErrSnapshot
+			}
+			copy(unsafe.Slice((*byte)(unsafe.Pointer(v)), c.size), b)
+			return b[c.size:], nil
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("shardmap: snapshot of type %T is not supported", zero)
+}
+
+// pointerFree reports whether values of type t hold no pointers.
+func pointerFree(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	case reflect.Array:
+		return pointerFree(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !pointerFree(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func readBytes(b []byte) (data, rest []byte, err error) {
+	size, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < size {
+		return nil, b, ErrSnapshot
+	}
+	return b[n : n+int(size)], b[n+int(size):], nil
+}
+
+// hasherID identifies the hash function of the map in a snapshot, along with
+// the way it picks shards.
+func (m *Map[K, V]) hasherID() uint64 {
+	switch {
+	case m.hasher != nil:
+		return 1
+	case m.sbits != 0 || atomic.LoadUint64(&m.reseed) != 0:
+		return 2
+	}
+	return 0
+}
+
+func nativeOrder() int {
+	x := uint16(1)
+	if *(*byte)(unsafe.Pointer(&x)) == 1 {
+		return 1
+	}
+	return 2
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *countReader) ReadByte() (byte, error) {
+	c, err := r.r.(io.ByteReader).ReadByte()
+	if err == nil {
+		r.n++
+	}
+	return c, err
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutUvarint(b[:], x)]...)
+}
+
+func appendUint64(buf []byte, x uint64) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], x)
+	return append(buf, b[:]...)
+}
@@ -0,0 +1,174 @@
+package shardmap
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	type point struct {
+		X, Y int32
+	}
+	m := New[string, point](0)
+	for i := 0; i < 10000; i++ {
+		m.Set(k(i), point{int32(i), int32(-i)})
+	}
+	var buf bytes.Buffer
+	n, err := m.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Fatalf("expected '%v', got '%v'", buf.Len(), n)
+	}
+	data := buf.Bytes()
+
+	m2 := New[string, point](0)
+	if n, err = m2.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) {
+		t.Fatalf("expected '%v', got '%v'", len(data), n)
+	}
+	if m2.Len() != 10000 {
+		t.Fatalf("expected '%v', got '%v'", 10000, m2.Len())
+	}
+	for i := 0; i < 10000; i++ {
+		if v, _ := m2.Get(k(i)); v.X != int32(i) || v.Y != int32(-i) {
+			t.Fatalf("expected '%v', got '%v'", i, v)
+		}
+	}
+
+	// a reader without ReadByte
+	m3 := New[string, point](0)
+	if n, err = m3.ReadFrom(io.MultiReader(bytes.NewReader(data))); err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) || m3.Len() != 10000 {
+		t.Fatalf("expected '%v', got '%v'", 10000, m3.Len())
+	}
+
+	if _, err = New[string, point](0).ReadFrom(bytes.NewReader(data[:len(data)/2])); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected '%v', got '%v'", io.ErrUnexpectedEOF, err)
+	}
+	if _, err = New[string, point](0).ReadFrom(bytes.NewReader([]byte("shardmop"))); err != ErrSnapshot {
+		t.Fatalf("expected '%v', got '%v'", ErrSnapshot, err)
+	}
+	if _, err = New[string, *point](0).WriteTo(&buf); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestSnapshotHasher(t *testing.T) {
+	m := New[int, int](0, WithHasher[int, int](func(key int) uint64 { return uint64(key) * 0x9E3779B97F4A7C15 }))
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	c := New[int, int](0)
+	if _, err := c.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := c.Get(i); !ok || v != i {
+			t.Fatalf("expected '%v', got '%v'", i, v)
+		}
+	}
+}
+
+func TestSnapshotSeed(t *testing.T) {
+	for _, seed := range []uint64{42, 43} {
+		m := New[int, int](0, WithSeed[int, int](42))
+		for i := 0; i < 1000; i++ {
+			m.Set(i, i)
+		}
+		var buf bytes.Buffer
+		if _, err := m.WriteTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		c := New[int, int](0, WithSeed[int, int](seed))
+		c.SetDebugLevel(DebugVerify)
+		if _, err := c.ReadFrom(&buf); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 1000; i++ {
+			if v, ok := c.Get(i); !ok || v != i {
+				t.Fatalf("expected '%v', got '%v'", i, v)
+			}
+		}
+	}
+}
+
+func TestSnapshotForgedSize(t *testing.T) {
+	opts := []Option[string, int]{WithShards[string, int](1), WithSeed[string, int](1)}
+	var buf bytes.Buffer
+	if _, err := New[string, int](0, opts...).WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// one entry of a terabyte, and a count of 2^60 entries
+	data := append(buf.Bytes()[:buf.Len()-1], 1)
+	data = appendUvarint(data, 1<<40)
+	data = append(data, "truncated"...)
+	if _, err := New[string, int](0, opts...).ReadFrom(bytes.NewReader(data)); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected '%v', got '%v'", io.ErrUnexpectedEOF, err)
+	}
+	data = appendUvarint(buf.Bytes()[:buf.Len()-1], 1<<60)
+	if _, err := New[string, int](0, opts...).ReadFrom(bytes.NewReader(data)); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected '%v', got '%v'", io.ErrUnexpectedEOF, err)
+	}
+}
+
+func TestSnapshotVersion3(t *testing.T) {
+	// version 3 snapshots have no ttl in their payloads
+	m := New[int, int](0, WithShards[int, int](1), WithSeed[int, int](1))
+	data := append([]byte(snapshotMagic), 3, byte(nativeOrder()), 1)
+	data = appendUvarint(data, m.hasherID())
+	data = appendUint64(data, m.seed)
+	data = appendUvarint(data, 2)
+	c, _ := newCodec[int]()
+	for key := 1; key <= 2; key++ {
+		value := key * 10
+		payload := appendUint64(nil, m.hash(key)>>dibBitSize<<dibBitSize)
+		payload, _ = c.encode(payload, &key)
+		payload, _ = c.encode(payload, &value)
+		data = append(appendUvarint(data, uint64(len(payload))), payload...)
+	}
+	if _, err := m.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatalf("expected '%v', got '%v'", nil, err)
+	}
+	for key := 1; key <= 2; key++ {
+		if v, ok := m.Get(key); !ok || v != key*10 {
+			t.Fatalf("expected '%v', got '%v'", key*10, v)
+		}
+	}
+}
+
+func TestSnapshotForgedHash(t *testing.T) {
+	opts := []Option[int, int]{WithShards[int, int](1), WithSeed[int, int](1)}
+	m := New[int, int](0, opts...)
+	m.Set(1, 1)
+	var buf bytes.Buffer
+	if _, err := m.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// the payload ends with the hash, a ttl byte, the key and the value
+	data := append([]byte(nil), buf.Bytes()...)
+	data[len(data)-2*8-1-1] ^= 1
+	if _, err := New[int, int](0, opts...).ReadFrom(bytes.NewReader(data)); err != ErrSnapshot {
+		t.Fatalf("expected '%v', got '%v'", ErrSnapshot, err)
+	}
+	ro := New[int, int](0, opts...)
+	ro.SetReadOnly(true)
+	if _, err := ro.ReadFrom(bytes.NewReader(buf.Bytes())); err != ErrReadOnly {
+		t.Fatalf("expected '%v', got '%v'", ErrReadOnly, err)
+	}
+	ro = New[int, int](0, WithShards[int, int](2))
+	ro.SetReadOnly(true)
+	if _, err := ro.ReadFrom(bytes.NewReader(buf.Bytes())); err != ErrReadOnly {
+		t.Fatalf("expected '%v', got '%v'", ErrReadOnly, err)
+	}
+}
@@ -0,0 +1,75 @@
+package shardmap
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// WithSpinLock makes the shards use a reader/writer spin lock instead of a
+// sync.RWMutex. Waiters spin and yield rather than park, which wins when the
+// critical sections are short and there are no more busy goroutines than
+// CPUs, but burns CPU under heavy contention or long Range calls. Writers take
+// precedence over new readers.
+func WithSpinLock[K comparable, V any]() Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.spin = true
+	}
+}
+
+// spinWriter is the bit of spinState held by the writer, the other bits count
+// the readers.
+const spinWriter = 1 << 31
+
+// RLock read locks the shard.
+func (mu *syncRWMutex) RLock() {
+	if !mu.spin {
+		mu.RWMutex.RLock()
+		return
+	}
+	for i := 0; ; i++ {
+		state := atomic.LoadUint32(&mu.spinState)
+		if state&spinWriter == 0 && atomic.CompareAndSwapUint32(&mu.spinState, state, state+1) {
+			return
+		}
+		spinWait(i)
+	}
+}
+
+// RUnlock read unlocks the shard.
+func (mu *syncRWMutex) RUnlock() {
+	if !mu.spin {
+		mu.RWMutex.RUnlock()
+		return
+	}
+	atomic.AddUint32(&mu.spinState, ^uint32(0))
+}
+
+// spinLock takes the writer bit, then waits for the readers to leave.
+func (mu *syncRWMutex) spinLock() {
+	for i := 0; ; i++ {
+		state := atomic.LoadUint32(&mu.spinState)
+		if state&spinWriter == 0 && atomic.CompareAndSwapUint32(&mu.spinState, state, state|spinWriter) {
+			break
+		}
+		spinWait(i)
+	}
+	for i := 0; atomic.LoadUint32(&mu.spinState) != spinWriter; i++ {
+		spinWait(i)
+	}
+}
+
+func (mu *syncRWMutex) spinUnlock() {
+	atomic.StoreUint32(&mu.spinState, 0)
+}
+
+// spinWait backs off the i-th failed attempt to take a spin lock, yielding the
+// processor after a few busy attempts.
+func spinWait(i int) {
+	if i < 16 {
+		for j := 0; j < 1<<i && j < 64; j++ {
+			// busy wait
+		}
+		return
+	}
+	runtime.Gosched()
+}
@@ -0,0 +1,67 @@
+package shardmap
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSpinLock(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](1), WithSpinLock[int, int]())
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				Add(m, i%10, 1)
+				m.Get(i % 10)
+				if i%100 == 0 {
+					m.Range(func(key, value int) bool { return true })
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	if v, _ := m.Get(3); v != 8*200 {
+		t.Fatalf("expected '%v', got '%v'", 8*200, v)
+	}
+	if m.mus[0].spinState != 0 {
+		t.Fatalf("expected an unlocked shard, got '%v'", m.mus[0].spinState)
+	}
+}
+
+func benchmarkLock(b *testing.B, opts ...Option[int, int]) {
+	m := New[int, int](0, opts...)
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			if i%10 == 0 {
+				m.Set(i%1000, i)
+			} else {
+				m.Get(i % 1000)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkRWMutex(b *testing.B) {
+	benchmarkLock(b)
+}
+
+func BenchmarkSpinLock(b *testing.B) {
+	benchmarkLock(b, WithSpinLock[int, int]())
+}
+
+// With few shards the locks are contended.
+func BenchmarkRWMutexContended(b *testing.B) {
+	benchmarkLock(b, WithShards[int, int](2))
+}
+
+func BenchmarkSpinLockContended(b *testing.B) {
+	benchmarkLock(b, WithShards[int, int](2), WithSpinLock[int, int]())
+}
@@ -0,0 +1,62 @@
+package shardmap
+
+import (
+	"sync/atomic"
+)
+
+// Stats describes the layout of a map, see Map.Stats.
+type Stats struct {
+	Len    int          // number of values, including expired ones not removed yet
+	Shards []ShardStats // per shard stats
+}
+
+// ShardStats describes the layout of a shard.
+type ShardStats struct {
+	Len        int     // number of values
+	Buckets    int     // number of buckets
+	LoadFactor float64 // Len / Buckets
+	Resizes    int     // number of times the shard grew or shrank
+
+	// Mutation counters, reads are not counted to keep them lock free.
+	Sets        uint64 // values assigned
+	Deletes     uint64 // values deleted or cleared
+	Evictions   uint64 // values evicted by WithLRU or WithMaxCost
+	Expirations uint64 // expired values removed
+	// Probes is the histogram of the probe distances of the values, Probes[d]
+	// values are d buckets away from their home bucket.
+	Probes []int
+	// Collisions is the number of values sharing their hash with another
+	// value of the shard, which are told apart only by comparing keys.
+	Collisions int
+}
+
+// Stats returns the layout of the map, which helps to detect skewed shards
+// and capacity misconfigurations. Shards are read one at a time.
+func (m *Map[K, V]) Stats() Stats {
+	m.lazyInit()
+	st := Stats{Shards: make([]ShardStats, len(m.mus))}
+	for i := 0; i < len(m.mus); i++ {
+		if atomic.LoadUint32(&m.debug) != 0 {
+			m.debugLock(i, false)
+		}
+		m.mus[i].RLock()
+		s := &m.shards[i]
+		st.Shards[i] = ShardStats{
+			Len:     s.length,
+			Buckets: len(s.buckets),
+			Resizes: s.resizes,
+
+			Sets:        s.ops.sets,
+			Deletes:     s.ops.deletes,
+			Evictions:   s.ops.evictions,
+			Expirations: s.ops.expirations,
+		}
+		st.Shards[i].Probes, st.Shards[i].Collisions = s.probes()
+		m.mus[i].RUnlock()
+		if st.Shards[i].Buckets > 0 {
+			st.Shards[i].LoadFactor = float64(st.Shards[i].Len) / float64(st.Shards[i].Buckets)
+		}
+		st.Len += st.Shards[i].Len
+	}
+	return st
+}
@@ -0,0 +1,68 @@
+package shardmap
+
+import (
+	"encoding/json"
+	"expvar"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](4))
+	for i := 0; i < 1000; i++ {
+		m.Set(i, i)
+	}
+	st := m.Stats()
+	if st.Len != 1000 || len(st.Shards) != 4 {
+		t.Fatalf("expected '%v', got '%v'", 1000, st.Len)
+	}
+	for _, s := range st.Shards {
+		if s.Len == 0 || s.Buckets < s.Len || s.Resizes == 0 {
+			t.Fatalf("unexpected shard stats %+v", s)
+		}
+		if s.LoadFactor <= 0 || s.LoadFactor > loadFactor {
+			t.Fatalf("unexpected load factor %v", s.LoadFactor)
+		}
+	}
+}
+
+func TestStatsProbes(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](1), WithHasher[int, int](func(key int) uint64 {
+		return uint64(key%10) << 20 // 10 distinct hashes
+	}))
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+	}
+	s := m.Stats().Shards[0]
+	if s.Collisions != 90 {
+		t.Fatalf("expected '%v', got '%v'", 90, s.Collisions)
+	}
+	var n int
+	for _, c := range s.Probes {
+		n += c
+	}
+	if n != 100 || len(s.Probes) < 10 {
+		t.Fatalf("expected '%v', got '%v'", 100, s.Probes)
+	}
+}
+
+func TestExpvar(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](2))
+	for i := 0; i < 100; i++ {
+		m.Set(i, i)
+	}
+	m.Set(0, 0)
+	m.Delete(1)
+	m.Expvar("shardmap_test")
+	var v struct {
+		Len     int   `json:"len"`
+		Shards  []int `json:"shards"`
+		Sets    int   `json:"sets"`
+		Deletes int   `json:"deletes"`
+	}
+	if err := json.Unmarshal([]byte(expvar.Get("shardmap_test").String()), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Len != 99 || len(v.Shards) != 2 || v.Sets != 101 || v.Deletes != 1 {
+		t.Fatalf("unexpected expvar %+v", v)
+	}
+}
@@ -0,0 +1,319 @@
+package shardmap
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"reflect"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// SwissMap is a hashmap whose shards are SwissTables: the slots are split in
+// groups of 8, each with a word of control bytes holding 7 bits of the hash
+// of their keys, so that a probe compares a whole group at once and only
+// reads the keys whose control byte matches. It's faster than the Robin Hood
+// shards of Map for Get-heavy workloads, mostly on absent keys and on keys
+// which are expensive to compare, but has none of the features of Map.
+//
+// The backend is picked by calling NewSwiss instead of New rather than by an
+// option of Map, as expiry, eviction, hooks and the other features of Map
+// are built into its Robin Hood shards.
+//
+// Groups are matched with word-wide bit tricks rather than SIMD, portable to
+// any arch.
+//
+// The zero value is not safe for use; use NewSwiss.
+type SwissMap[K comparable, V any] struct {
+	mus    []swissMutex
+	shards []swissShard[K, V]
+	hasher func(key K) uint64
+	keys   keyHash[K]
+	seed   uint64
+	shift  int // bits of the hash picking the shard
+}
+
+type swissMutex struct {
+	sync.RWMutex
+	_ [64 - unsafe.Sizeof(sync.RWMutex{})]byte // avoid false sharing
+}
+
+// control bytes of the slots, full slots hold the top 7 bits of their hash
+const (
+	swissEmpty   = 0x80
+	swissDeleted = 0xFE
+	swissGroup   = 8
+	swissLSB     = 0x0101010101010101
+	swissMSB     = 0x8080808080808080
+)
+
+// swissShard is an open addressing table of groups of slots, with quadratic
+// probing over the groups.
+type swissShard[K comparable, V any] struct {
+	ctrl   []uint64 // control bytes of the groups
+	slots  []swissSlot[K, V]
+	mask   int // of the groups
+	length int
+	left   int // empty slots which can be filled before growing
+	grow   float64
+}
+
+type swissSlot[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// NewSwiss returns a new SwissMap with the specified capacity. Of the
+// options, only WithShards, WithHasher, WithSeed and WithLoadFactor apply,
+// and it panics given any other.
+func NewSwiss[K comparable, V any](cap int, opts ...Option[K, V]) *SwissMap[K, V] {
+	conf := &Map[K, V]{grow: 7.0 / 8, seed: new(maphash.Hash).Sum64()}
+	for _, opt := range opts {
+		// an option setting anything else would be silently ignored
+		probe := &Map[K, V]{}
+		opt(probe)
+		probe.nshards, probe.hasher, probe.seed, probe.grow = 0, nil, 0, 0
+		if !reflect.DeepEqual(probe, &Map[K, V]{}) {
+			panic("shardmap: NewSwiss only supports WithShards, WithHasher, WithSeed and WithLoadFactor")
+		}
+		opt(conf)
+	}
+	n, want := 1, conf.nshards
+	if want <= 0 {
+		want = runtime.NumCPU() * 16
+	}
+	for n < want {
+		n *= 2
+	}
+	m := &SwissMap[K, V]{
+		mus:    make([]swissMutex, n),
+		shards: make([]swissShard[K, V], n),
+		hasher: conf.hasher,
+		seed:   conf.seed,
+		shift:  bits.TrailingZeros(uint(n)),
+	}
+	m.keys.init()
+	for i := range m.shards {
+		m.shards[i].grow = conf.grow
+		m.shards[i].init(cap / n)
+	}
+	return m
+}
+
+func (m *SwissMap[K, V]) hash(key K) uint64 {
+	if m.hasher != nil {
+		return m.hasher(key)
+	}
+	return m.keys.hash(key, m.seed)
+}
+
+func (s *swissShard[K, V]) init(cap int) {
+	s.length = 0
+	s.alloc(cap)
+}
+
+// alloc allocates the groups to hold n keys, with at least one empty slot
+// left over to end the probes of absent keys.
+func (s *swissShard[K, V]) alloc(n int) {
+	groups := 1
+	for int(float64(groups*swissGroup)*s.grow) <= n || groups*swissGroup <= n {
+		groups *= 2
+	}
+	s.ctrl = make([]uint64, groups)
+	for i := range s.ctrl {
+		s.ctrl[i] = swissLSB * swissEmpty
+	}
+	s.slots = make([]swissSlot[K, V], groups*swissGroup)
+	s.mask = groups - 1
+	s.left = int(float64(groups*swissGroup)*s.grow) - s.length
+	if s.left > len(s.slots)-1-s.length {
+		s.left = len(s.slots) - 1 - s.length
+	}
+}
+
+// match returns the bytes of the group equal to c, as their top bits. It may
+// report a byte following a match, which comparing the keys rules out.
+func swissMatch(group uint64, c uint8) uint64 {
+	v := group ^ swissLSB*uint64(c)
+	return (v - swissLSB) &^ v & swissMSB
+}
+
+// swissMatchEmpty returns the empty bytes of the group, as their top bits.
+func swissMatchEmpty(group uint64) uint64 {
+	return group &^ (group << 6) & swissMSB
+}
+
+// swissMatchFree returns the empty or deleted bytes of the group.
+func swissMatchFree(group uint64) uint64 {
+	return group & swissMSB
+}
+
+// find returns the slot of a key, or -1 when the key is absent.
+func (s *swissShard[K, V]) find(h1 uint64, h2 uint8, key K) int {
+	g := int(h1) & s.mask
+	for step := 1; ; step++ {
+		group := s.ctrl[g]
+		for b := swissMatch(group, h2); b != 0; b &= b - 1 {
+			i := g*swissGroup + bits.TrailingZeros64(b)/8
+			if s.slots[i].key == key {
+				return i
+			}
+		}
+		if swissMatchEmpty(group) != 0 {
+			return -1
+		}
+		g = (g + step) & s.mask
+	}
+}
+
+// free returns the first empty or deleted slot of the probe sequence of h1.
+func (s *swissShard[K, V]) free(h1 uint64) int {
+	g := int(h1) & s.mask
+	for step := 1; ; step++ {
+		if b := swissMatchFree(s.ctrl[g]); b != 0 {
+			return g*swissGroup + bits.TrailingZeros64(b)/8
+		}
+		g = (g + step) & s.mask
+	}
+}
+
+func (s *swissShard[K, V]) control(i int) uint8 {
+	return uint8(s.ctrl[i/swissGroup] >> (i % swissGroup * 8))
+}
+
+func (s *swissShard[K, V]) setControl(i int, c uint8) {
+	shift := i % swissGroup * 8
+	s.ctrl[i/swissGroup] = s.ctrl[i/swissGroup]&^(0xFF<<shift) | uint64(c)<<shift
+}
+
+// insert adds an absent key.
+func (s *swissShard[K, V]) insert(m *SwissMap[K, V], h1 uint64, h2 uint8, key K, value V) {
+	i := s.free(h1)
+	if s.control(i) == swissEmpty {
+		if s.left == 0 {
+			s.rehash(m)
+			i = s.free(h1)
+		}
+		s.left--
+	}
+	s.setControl(i, h2)
+	s.slots[i] = swissSlot[K, V]{key, value}
+	s.length++
+}
+
+// remove deletes the key of a slot. The slot becomes empty again when its
+// group has an empty slot, which ends every probe through the group anyway.
+func (s *swissShard[K, V]) remove(i int) {
+	s.slots[i] = swissSlot[K, V]{}
+	if swissMatchEmpty(s.ctrl[i/swissGroup]) != 0 {
+		s.setControl(i, swissEmpty)
+		s.left++
+	} else {
+		s.setControl(i, swissDeleted)
+	}
+	s.length--
+}
+
+// rehash grows the shard, or only drops its deleted slots when they take
+// most of the room.
+func (s *swissShard[K, V]) rehash(m *SwissMap[K, V]) {
+	ctrl, slots := s.ctrl, s.slots
+	if float64(s.length) > float64(len(slots))*s.grow/2 {
+		s.alloc(s.length * 2)
+	} else {
+		s.alloc(s.length)
+	}
+	for i := range slots {
+		if c := uint8(ctrl[i/swissGroup] >> (i % swissGroup * 8)); c&swissEmpty == 0 {
+			j := s.free(m.hash(slots[i].key) >> m.shift)
+			s.setControl(j, c)
+			s.slots[j] = slots[i]
+		}
+	}
+}
+
+// split returns the shard of a hash, with the bits of the hash probing the
+// shard and the 7 bits kept in the control bytes.
+func (m *SwissMap[K, V]) split(key K) (i int, h1 uint64, h2 uint8) {
+	hash := m.hash(key)
+	return int(hash & uint64(len(m.shards)-1)), hash >> m.shift, uint8(hash >> 57)
+}
+
+// Get returns a value for a key.
+// Returns false when no value has been assign for key.
+func (m *SwissMap[K, V]) Get(key K) (value V, ok bool) {
+	i, h1, h2 := m.split(key)
+	m.mus[i].RLock()
+	s := &m.shards[i]
+	if j := s.find(h1, h2, key); j >= 0 {
+		value, ok = s.slots[j].value, true
+	}
+	m.mus[i].RUnlock()
+	return
+}
+
+// Set assigns a value to a key.
+// Returns the previous value, or false when no value was assigned.
+func (m *SwissMap[K, V]) Set(key K, value V) (prev V, replaced bool) {
+	i, h1, h2 := m.split(key)
+	m.mus[i].Lock()
+	s := &m.shards[i]
+	if j := s.find(h1, h2, key); j >= 0 {
+		prev, replaced = s.slots[j].value, true
+		s.slots[j].value = value
+	} else {
+		s.insert(m, h1, h2, key, value)
+	}
+	m.mus[i].Unlock()
+	return
+}
+
+// Delete deletes a value for a key.
+// Returns the deleted value, or false when no value was assigned.
+func (m *SwissMap[K, V]) Delete(key K) (prev V, deleted bool) {
+	i, h1, h2 := m.split(key)
+	m.mus[i].Lock()
+	s := &m.shards[i]
+	if j := s.find(h1, h2, key); j >= 0 {
+		prev, deleted = s.slots[j].value, true
+		s.remove(j)
+	}
+	m.mus[i].Unlock()
+	return
+}
+
+// Len returns the number of values in map.
+func (m *SwissMap[K, V]) Len() int {
+	var n int
+	for i := range m.shards {
+		m.mus[i].RLock()
+		n += m.shards[i].length
+		m.mus[i].RUnlock()
+	}
+	return n
+}
+
+// Range iterates over all key/values, one shard at a time under its read
+// lock. It's not safe to call Set or Delete while ranging.
+func (m *SwissMap[K, V]) Range(iter func(key K, value V) bool) {
+	for i := range m.shards {
+		m.mus[i].RLock()
+		s := &m.shards[i]
+		for j := range s.slots {
+			if s.control(j)&swissEmpty == 0 && !iter(s.slots[j].key, s.slots[j].value) {
+				m.mus[i].RUnlock()
+				return
+			}
+		}
+		m.mus[i].RUnlock()
+	}
+}
+
+// Clear out all values from map.
+func (m *SwissMap[K, V]) Clear() {
+	for i := range m.shards {
+		m.mus[i].Lock()
+		m.shards[i].init(0)
+		m.mus[i].Unlock()
+	}
+}
@@ -0,0 +1,125 @@
+package shardmap
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSwissMap(t *testing.T) {
+	m := NewSwiss[int, int](0, WithShards[int, int](4))
+	ref := make(map[int]int)
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	for i := 0; i < 100000; i++ {
+		key := r.Intn(5000)
+		switch r.Intn(3) {
+		case 0, 1:
+			prev, replaced := m.Set(key, i)
+			if want, ok := ref[key]; ok != replaced || prev != want {
+				t.Fatalf("expected '%v', got '%v'", want, prev)
+			}
+			ref[key] = i
+		case 2:
+			prev, deleted := m.Delete(key)
+			if want, ok := ref[key]; ok != deleted || prev != want {
+				t.Fatalf("expected '%v', got '%v'", want, prev)
+			}
+			delete(ref, key)
+		}
+	}
+	if m.Len() != len(ref) {
+		t.Fatalf("expected '%v', got '%v'", len(ref), m.Len())
+	}
+	for key := -100; key < 5100; key++ {
+		want, ok := ref[key]
+		if v, found := m.Get(key); found != ok || v != want {
+			t.Fatalf("expected '%v', got '%v'", want, v)
+		}
+	}
+	var n int
+	m.Range(func(key, value int) bool {
+		if ref[key] != value {
+			t.Fatalf("expected '%v', got '%v'", ref[key], value)
+		}
+		n++
+		return true
+	})
+	if n != len(ref) {
+		t.Fatalf("expected '%v', got '%v'", len(ref), n)
+	}
+	m.Clear()
+	if _, ok := m.Get(0); ok || m.Len() != 0 {
+		t.Fatalf("expected an empty map, got '%v'", m.Len())
+	}
+}
+
+func TestSwissMapOptions(t *testing.T) {
+	// colliding hashes and a full load factor still end every probe
+	m := NewSwiss[string, int](0,
+		WithShards[string, int](1),
+		WithHasher[string, int](func(key string) uint64 { return uint64(len(key)) }),
+		WithLoadFactor[string, int](0.99),
+	)
+	for i := 0; i < 1000; i++ {
+		m.Set(k(i), i)
+		if i%3 == 0 {
+			m.Delete(k(i / 2))
+		}
+	}
+	for i := 0; i < 1000; i++ {
+		if _, ok := m.Get("absent" + k(i)); ok {
+			t.Fatalf("expected '%v' to be absent", "absent"+k(i))
+		}
+	}
+	if v, ok := m.Get(k(999)); !ok || v != 999 {
+		t.Fatalf("expected '%v', got '%v'", 999, v)
+	}
+}
+
+func BenchmarkSwissGet(b *testing.B) {
+	b.Run("RobinHood", func(b *testing.B) {
+		m := New[string, int](0)
+		benchmarkGet(b, func(key string, i int) { m.Set(key, i) }, func(key string) { m.Get(key) })
+	})
+	b.Run("Swiss", func(b *testing.B) {
+		m := NewSwiss[string, int](0)
+		benchmarkGet(b, func(key string, i int) { m.Set(key, i) }, func(key string) { m.Get(key) })
+	})
+}
+
+// benchmarkGet gets half present and half absent keys in parallel.
+func benchmarkGet(b *testing.B, set func(key string, i int), get func(key string)) {
+	keys := make([]string, 1<<16)
+	for i := range keys {
+		keys[i] = "key:" + strconv.Itoa(i)
+		if i%2 == 0 {
+			set(keys[i], i)
+		}
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i int
+		for pb.Next() {
+			get(keys[i&(len(keys)-1)])
+			i++
+		}
+	})
+}
+
+func TestSwissMapUnsupportedOptions(t *testing.T) {
+	for _, opt := range []Option[int, int]{
+		WithLRU[int, int](100),
+		WithMaxCost[int, int](100, nil),
+		WithJanitor[int, int](time.Second),
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected a panic")
+				}
+			}()
+			NewSwiss[int, int](0, opt)
+		}()
+	}
+}
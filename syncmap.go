@@ -0,0 +1,146 @@
+package shardmap
+
+// SyncMap is a drop-in replacement of sync.Map backed by a sharded Map.
+// Its methods have the exact signatures of sync.Map, keys and values that
+// are not of type K and V cause a panic on write and a miss on read.
+//
+// The zero value is an empty map ready to use, like sync.Map.
+type SyncMap[K comparable, V any] struct {
+	m    *Map[K, V]
+	zero Map[K, V] // the map of the zero SyncMap
+}
+
+// NewSyncMap returns a new SyncMap with the specified capacity.
+func NewSyncMap[K comparable, V any](cap int, opts ...Option[K, V]) *SyncMap[K, V] {
+	return &SyncMap[K, V]{m: New[K, V](cap, opts...)}
+}
+
+// Map returns the underlying Map.
+func (m *SyncMap[K, V]) Map() *Map[K, V] {
+	if m.m == nil {
+		return &m.zero
+	}
+	return m.m
+}
+
+// Load returns the value stored in the map for a key, or nil if no value is
+// present. The ok result indicates whether value was found in the map.
+func (m *SyncMap[K, V]) Load(key any) (value any, ok bool) {
+	k, ok := key.(K)
+	if !ok {
+		return nil, false
+	}
+	v, ok := m.Map().Get(k)
+	if !ok {
+		return nil, false
+	}
+	return v, true
+}
+
+// Store sets the value for a key.
+func (m *SyncMap[K, V]) Store(key, value any) {
+	m.Map().Set(key.(K), syncValue[V](value))
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+func (m *SyncMap[K, V]) LoadOrStore(key, value any) (actual any, loaded bool) {
+	return m.Map().GetOrSet(key.(K), syncValue[V](value))
+}
+
+// LoadAndDelete deletes the value for a key, returning the previous value if any.
+// The loaded result reports whether the key was present.
+func (m *SyncMap[K, V]) LoadAndDelete(key any) (value any, loaded bool) {
+	k, ok := key.(K)
+	if !ok {
+		return nil, false
+	}
+	v, loaded := m.Map().Delete(k)
+	if !loaded {
+		return nil, false
+	}
+	return v, true
+}
+
+// Delete deletes the value for a key.
+func (m *SyncMap[K, V]) Delete(key any) {
+	if k, ok := key.(K); ok {
+		m.Map().Delete(k)
+	}
+}
+
+// Swap swaps the value for a key and returns the previous value if any.
+// The loaded result reports whether the key was present.
+func (m *SyncMap[K, V]) Swap(key, value any) (previous any, loaded bool) {
+	v, loaded := m.Map().Set(key.(K), syncValue[V](value))
+	if !loaded {
+		return nil, false
+	}
+	return v, true
+}
+
+// CompareAndSwap swaps the old and new values for key
+// if the value stored in the map is equal to old.
+// The old value must be of a comparable type.
+func (m *SyncMap[K, V]) CompareAndSwap(key, old, new any) (swapped bool) {
+	k, ok := key.(K)
+	if !ok {
+		return false
+	}
+	v := syncValue[V](new)
+	o, ok := toValue[V](old)
+	if !ok {
+		return false
+	}
+	return m.Map().CompareAndSwap(k, o, v)
+}
+
+// CompareAndDelete deletes the entry for key if its value is equal to old.
+// The old value must be of a comparable type.
+//
+// If there is no current value for key in the map, CompareAndDelete
+// returns false (even if the old value is the nil interface value).
+func (m *SyncMap[K, V]) CompareAndDelete(key, old any) (deleted bool) {
+	k, ok := key.(K)
+	if !ok {
+		return false
+	}
+	v, ok := toValue[V](old)
+	if !ok {
+		return false
+	}
+	return m.Map().CompareAndDelete(k, v)
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, range stops the iteration. Like sync.Map, f may call any
+// method of the map, as it's called outside of the shard locks.
+func (m *SyncMap[K, V]) Range(f func(key, value any) bool) {
+	m.Map().RangeSnapshot(func(key K, value V) bool {
+		return f(key, value)
+	})
+}
+
+// Clear deletes all the entries.
+func (m *SyncMap[K, V]) Clear() {
+	m.Map().Clear()
+}
+
+// toValue converts a value given to a SyncMap to V, where nil is the zero V
+// when V is an interface type, as sync.Map accepts nil values.
+func toValue[V any](value any) (v V, ok bool) {
+	if v, ok = value.(V); ok || value != nil {
+		return v, ok
+	}
+	return v, any(v) == nil
+}
+
+// syncValue converts a value given to a SyncMap to V like toValue, and
+// panics when it's not a V.
+func syncValue[V any](value any) V {
+	if v, ok := toValue[V](value); ok {
+		return v
+	}
+	return value.(V)
+}
@@ -0,0 +1,132 @@
+package shardmap
+
+import (
+	"testing"
+)
+
+var _ interface {
+	Load(key any) (value any, ok bool)
+	Store(key, value any)
+	LoadOrStore(key, value any) (actual any, loaded bool)
+	LoadAndDelete(key any) (value any, loaded bool)
+	Delete(key any)
+	Swap(key, value any) (previous any, loaded bool)
+	CompareAndSwap(key, old, new any) (swapped bool)
+	CompareAndDelete(key, old any) (deleted bool)
+	Range(f func(key, value any) bool)
+} = &SyncMap[string, int]{}
+
+func TestSyncMap(t *testing.T) {
+	m := NewSyncMap[string, int](0)
+	if v, ok := m.Load("hello"); ok || v != nil {
+		t.Fatalf("expected '%v', got '%v'", nil, v)
+	}
+	if v, ok := m.Load(1); ok || v != nil {
+		t.Fatalf("expected '%v', got '%v'", nil, v)
+	}
+	m.Store("hello", 1)
+	if v, ok := m.Load("hello"); !ok || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+	if v, loaded := m.LoadOrStore("hello", 2); !loaded || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+	if v, loaded := m.Swap("hello", 3); !loaded || v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+	if m.CompareAndSwap("hello", 1, 4) {
+		t.Fatal("expected false")
+	}
+	if !m.CompareAndSwap("hello", 3, 4) {
+		t.Fatal("expected true")
+	}
+	if m.CompareAndDelete("hello", 3) {
+		t.Fatal("expected false")
+	}
+	var n int
+	m.Range(func(key, value any) bool {
+		n++
+		if key != "hello" || value != 4 {
+			t.Fatalf("expected '%v', got '%v'", "hello:4", key)
+		}
+		return true
+	})
+	if n != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, n)
+	}
+	if v, loaded := m.LoadAndDelete("hello"); !loaded || v != 4 {
+		t.Fatalf("expected '%v', got '%v'", 4, v)
+	}
+	if v, loaded := m.Swap("hello", 5); loaded || v != nil {
+		t.Fatalf("expected '%v', got '%v'", nil, v)
+	}
+	m.Delete("hello")
+	if m.Map().Len() != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, m.Map().Len())
+	}
+}
+
+func TestSyncMapZeroValue(t *testing.T) {
+	var m SyncMap[string, int]
+	if _, ok := m.Load("hello"); ok {
+		t.Fatal("expected false")
+	}
+	m.Store("hello", 1)
+	var events int
+	m.Map().Subscribe(func(Event[string, int]) { events++ })
+	if m.CompareAndSwap("hello", 2, 3) || m.CompareAndSwap("hello", "1", 3) || events != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, events)
+	}
+	if !m.CompareAndSwap("hello", 1, 3) || events != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, events)
+	}
+	if v, ok := m.Load("hello"); !ok || v != 3 {
+		t.Fatalf("expected '%v', got '%v'", 3, v)
+	}
+}
+
+func TestSyncMapRangeMutate(t *testing.T) {
+	// like sync.Map, the callback of Range may write the map
+	m := NewSyncMap[int, int](0)
+	for i := 0; i < 100; i++ {
+		m.Store(i, i)
+	}
+	m.Range(func(key, value any) bool {
+		m.Delete(key)
+		m.Store(key.(int)+1000, value)
+		return true
+	})
+	if n := m.Map().Len(); n != 100 {
+		t.Fatalf("expected '%v', got '%v'", 100, n)
+	}
+	if _, ok := m.Load(0); ok {
+		t.Fatalf("expected '%v', got '%v'", false, ok)
+	}
+}
+
+func TestSyncMapNil(t *testing.T) {
+	// like sync.Map, nil values are stored when V is an interface
+	m := NewSyncMap[string, any](0)
+	m.Store("a", nil)
+	if v, ok := m.Load("a"); !ok || v != nil {
+		t.Fatalf("expected '%v', got '%v'", nil, v)
+	}
+	if v, loaded := m.LoadOrStore("b", nil); loaded || v != nil {
+		t.Fatalf("expected '%v', got '%v'", nil, v)
+	}
+	if v, loaded := m.Swap("a", 1); !loaded || v != nil {
+		t.Fatalf("expected '%v', got '%v'", nil, v)
+	}
+	if !m.CompareAndSwap("b", nil, 2) {
+		t.Fatalf("expected '%v', got '%v'", true, false)
+	}
+	if !m.CompareAndDelete("a", 1) || !m.CompareAndDelete("b", 2) {
+		t.Fatalf("expected '%v', got '%v'", true, false)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected a panic storing nil as an int")
+		}
+	}()
+	NewSyncMap[string, int](0).Store("a", nil)
+}
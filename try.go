@@ -0,0 +1,128 @@
+package shardmap
+
+import (
+	"sync/atomic"
+)
+
+// TryGet returns a value for a key like Get, unless the shard of the key is
+// write locked, in which case it returns false right away as if the key was
+// absent. An expired value is only removed if its shard is not locked.
+func (m *Map[K, V]) TryGet(key K) (value V, ok bool) {
+	m.lazyInit()
+	hash := m.hash(key)
+	if m.hot != nil {
+		m.recordHot(hash, key)
+	}
+	value, ok = m.tryGet(hash, key)
+	if m.onGet != nil {
+		m.onGet(key, ok)
+	}
+	return value, ok
+}
+
+func (m *Map[K, V]) tryGet(hash uint64, key K) (value V, ok bool) {
+	if value, ok, done := m.getUnlocked(hash, key); done {
+		return value, ok
+	}
+	shard := m.shardOf(hash)
+	if atomic.LoadUint32(&m.debug) != 0 {
+		m.debugLock(shard, false)
+	}
+	if !m.mus[shard].TryRLock() {
+		return value, false
+	}
+	if m.shardOf(hash) != shard {
+		m.mus[shard].RUnlock()
+		return value, false
+	}
+	value, ok, expiring := m.shards[shard].fetch(hash, key, true)
+	m.mus[shard].RUnlock()
+	if expiring && m.mus[shard].TryLock() {
+		m.expireLocked(shard, hash, key)
+	}
+	return value, ok
+}
+
+// TrySet assigns a value to a key like Set, unless the shard of the key is
+// locked, in which case it returns right away with ok set to false.
+// Returns the previous value, or false when no value was assigned.
+func (m *Map[K, V]) TrySet(key K, value V) (prev V, replaced, ok bool) {
+	hash := m.hash(key)
+	shard, debug, ok := m.tryLockHash(hash)
+	if !ok {
+		return
+	}
+	prev, replaced = m.shards[shard].Set(hash, key, value)
+	m.unlock(shard, debug)
+	return prev, replaced, true
+}
+
+// TryDelete deletes a value for a key like Delete, unless the shard of the key
+// is locked, in which case it returns right away with ok set to false.
+// Returns the deleted value, or false when no value was assigned.
+func (m *Map[K, V]) TryDelete(key K) (prev V, deleted, ok bool) {
+	hash := m.hash(key)
+	shard, debug, ok := m.tryLockHash(hash)
+	if !ok {
+		return
+	}
+	prev, deleted = m.shards[shard].Delete(hash, key)
+	m.unlock(shard, debug)
+	return prev, deleted, true
+}
+
+// tryLock write locks shard i like lock, unless it's already locked. It
+// returns false if the shard is locked or the map is not writable, in which
+// case the shard is not locked.
+func (m *Map[K, V]) tryLock(i int) (debug uint32, ok bool) {
+	debug = atomic.LoadUint32(&m.debug)
+	if debug != 0 {
+		m.debugLock(i, true)
+	}
+	if !m.mus[i].TryLock() {
+		return debug, false
+	}
+	return debug, m.writable(i)
+}
+
+// tryLockHash write locks the shard of a hash like tryLock, and returns it.
+func (m *Map[K, V]) tryLockHash(hash uint64) (shard int, debug uint32, ok bool) {
+	shard = m.shardOf(hash)
+	if debug, ok = m.tryLock(shard); ok && m.shardOf(hash) != shard {
+		// moved by Rehash meanwhile
+		m.mus[shard].Unlock()
+		return shard, debug, false
+	}
+	return shard, debug, ok
+}
+
+// TryLock write locks the shard unless it's locked.
+func (mu *syncRWMutex) TryLock() bool {
+	if mu.spin {
+		if !atomic.CompareAndSwapUint32(&mu.spinState, 0, spinWriter) {
+			return false
+		}
+	} else if !mu.RWMutex.TryLock() {
+		return false
+	}
+	if mu.optimistic {
+		atomic.AddUint32(&mu.seq, 1)
+	}
+	return true
+}
+
+// TryRLock read locks the shard unless it's write locked.
+func (mu *syncRWMutex) TryRLock() bool {
+	if !mu.spin {
+		return mu.RWMutex.TryRLock()
+	}
+	for {
+		state := atomic.LoadUint32(&mu.spinState)
+		if state&spinWriter != 0 {
+			return false
+		}
+		if atomic.CompareAndSwapUint32(&mu.spinState, state, state+1) {
+			return true
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package shardmap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTry(t *testing.T) {
+	for _, opts := range [][]Option[int, int]{nil, {WithSpinLock[int, int]()}} {
+		m := New[int, int](0, append(opts, WithShards[int, int](1))...)
+		if _, _, ok := m.TrySet(1, 1); !ok {
+			t.Fatalf("expected an uncontended shard")
+		}
+		if v, ok := m.TryGet(1); !ok || v != 1 {
+			t.Fatalf("expected '%v', got '%v'", 1, v)
+		}
+		m.mus[0].RLock()
+		if v, ok := m.TryGet(1); !ok || v != 1 {
+			t.Fatalf("expected '%v', got '%v'", 1, v)
+		}
+		if _, _, ok := m.TrySet(2, 2); ok {
+			t.Fatalf("expected a contended shard")
+		}
+		m.mus[0].RUnlock()
+		m.mus[0].Lock()
+		if _, ok := m.TryGet(1); ok {
+			t.Fatalf("expected a contended shard")
+		}
+		if _, _, ok := m.TryDelete(1); ok {
+			t.Fatalf("expected a contended shard")
+		}
+		m.mus[0].Unlock()
+		if prev, deleted, ok := m.TryDelete(1); !ok || !deleted || prev != 1 {
+			t.Fatalf("expected '%v', got '%v'", 1, prev)
+		}
+		m.SetReadOnly(true)
+		if _, _, ok := m.TrySet(2, 2); ok {
+			t.Fatalf("expected a read-only map")
+		}
+	}
+}
+
+func TestTryGetHooks(t *testing.T) {
+	// TryGet is a lookup like Get for hooks, hot keys and expiry
+	var gets, misses int
+	m := New[int, int](0, WithHotKeys[int, int](4, 1), WithOnGet[int, int](func(key int, ok bool) {
+		gets++
+		if !ok {
+			misses++
+		}
+	}))
+	m.Set(1, 1)
+	m.SetWithTTL(2, 2, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	for i := 0; i < 10; i++ {
+		m.TryGet(1)
+	}
+	if _, ok := m.TryGet(2); ok || gets != 11 || misses != 1 {
+		t.Fatalf("expected '%v', got '%v'", 11, gets)
+	}
+	if n := m.Len(); n != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, n)
+	}
+	if hot := m.HotKeys(1); len(hot) != 1 || hot[0].Key != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, hot)
+	}
+}
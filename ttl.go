@@ -0,0 +1,184 @@
+package shardmap
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+var clockBase = time.Now()
+
+// clock returns the monotonic nanoseconds elapsed since the package was loaded.
+func clock() int64 {
+	return int64(time.Since(clockBase)) + 1
+}
+
+// SetWithTTL assigns a value to a key which expires after ttl, a ttl <= 0
+// means the value never expires. Expired values are invisible to all
+// operations, and are removed lazily or by the janitor of WithJanitor, so
+// Len may count expired values that have not been removed yet.
+// Returns the previous value, or false when no value was assigned.
+func (m *Map[K, V]) SetWithTTL(key K, value V, ttl time.Duration) (prev V, replaced bool) {
+	prev, replaced, _ = m.setWithTTL(key, value, ttl)
+	return prev, replaced
+}
+
+// setWithTTL is SetWithTTL, also returning false when the map is read-only.
+func (m *Map[K, V]) setWithTTL(key K, value V, ttl time.Duration) (prev V, replaced, ok bool) {
+	var md meta
+	if ttl > 0 {
+		md.expire = clock() + int64(ttl)
+	}
+	hash := m.hash(key)
+	if m.hot != nil {
+		m.recordHot(hash, key)
+	}
+	shard, debug, ok := m.lockHash(hash)
+	if !ok {
+		return
+	}
+	prev, replaced = m.shards[shard].SetMeta(hash, key, value, md)
+	m.unlock(shard, debug)
+	return prev, replaced, true
+}
+
+// Expire sets the ttl of the value of a key, keeping the value, a ttl <= 0
+// means the value never expires.
+// Returns false when no value has been assigned for key.
+func (m *Map[K, V]) Expire(key K, ttl time.Duration) (ok bool) {
+	var expire int64
+	if ttl > 0 {
+		expire = clock() + int64(ttl)
+	}
+	hash := m.hash(key)
+	shard, debug, ok := m.lockHash(hash)
+	if !ok {
+		return
+	}
+	s := &m.shards[shard]
+	i := s.find(hash, key)
+	switch {
+	case i < 0:
+	case s.metas != nil:
+		s.touch(i, expire)
+	case expire != 0:
+		s.SetMeta(hash, key, s.buckets[i].value, meta{expire: expire})
+	}
+	m.unlock(shard, debug)
+	return i >= 0
+}
+
+// TTL returns the time left before the value of a key expires, 0 when it
+// never expires.
+// Returns false when no value has been assigned for key.
+func (m *Map[K, V]) TTL(key K) (ttl time.Duration, ok bool) {
+	hash := m.hash(key)
+	shard := m.rlockHash(hash)
+	if expire, found := m.shards[shard].expireOf(hash, key); found {
+		ttl, ok = ttlOf(expire), true
+	}
+	m.mus[shard].RUnlock()
+	return ttl, ok
+}
+
+// getWithTTL returns the value of a key like Get, along with its ttl like
+// TTL, both read under the same lock.
+func (m *Map[K, V]) getWithTTL(key K) (value V, ttl time.Duration, ok bool) {
+	m.lazyInit()
+	hash := m.hash(key)
+	if m.hot != nil {
+		m.recordHot(hash, key)
+	}
+	shard := m.rlockHash(hash)
+	s := &m.shards[shard]
+	value, ok, expiring := s.fetch(hash, key, true)
+	if ok {
+		expire, _ := s.expireOf(hash, key)
+		ttl = ttlOf(expire)
+	}
+	m.mus[shard].RUnlock()
+	if expiring {
+		m.expireKey(shard, hash, key)
+	}
+	if m.onGet != nil {
+		m.onGet(key, ok)
+	}
+	return value, ttl, ok
+}
+
+// ttlOf returns the time left before a deadline, 0 for none.
+func ttlOf(expire int64) time.Duration {
+	if expire == 0 {
+		return 0
+	}
+	if ttl := time.Duration(expire - clock()); ttl > 0 {
+		return ttl
+	}
+	return 1
+}
+
+// WithJanitor starts a background goroutine which removes expired values
+// every interval, until the map is closed.
+func WithJanitor[K comparable, V any](interval time.Duration) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.janitor = interval
+	}
+}
+
+// WithOnExpire registers fn to be called with every expired key/value when it
+// is removed from the map, by the janitor or lazily by other operations.
+// The fn is called outside of the shard lock.
+func WithOnExpire[K comparable, V any](fn func(key K, value V)) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.onExpire = fn
+	}
+}
+
+func (m *Map[K, V]) runJanitor(done <-chan struct{}) {
+	ticker := time.NewTicker(m.janitor)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			m.expire()
+		}
+	}
+}
+
+// expire removes the expired values of all shards, one shard at a time.
+func (m *Map[K, V]) expire() (n int) {
+	var buf []entry[K, V]
+	for i := 0; i < len(m.mus); i++ {
+		var expired int
+		m.mus[i].Lock()
+		if atomic.LoadUint32(&m.state) != stateOpen {
+			m.mus[i].Unlock()
+			return
+		}
+		expired, buf = m.shards[i].Expire(buf)
+		m.unlock(i, 0)
+		n += expired
+	}
+	return n
+}
+
+// expireKey removes the value of a key if it has expired.
+func (m *Map[K, V]) expireKey(shard int, hash uint64, key K) {
+	m.mus[shard].Lock()
+	m.expireLocked(shard, hash, key)
+}
+
+// expireLocked removes the value of a key like expireKey, with its shard
+// already write locked, and unlocks it.
+func (m *Map[K, V]) expireLocked(shard int, hash uint64, key K) {
+	if atomic.LoadUint32(&m.state) == stateOpen {
+		s := &m.shards[shard]
+		// the shard may have been cleared meanwhile, dropping its metas
+		if i := s.index(hash, key); i >= 0 && s.metas != nil && s.metas[i].expired(new(int64)) {
+			s.drop(i, ReasonExpired)
+			s.remove(i)
+		}
+	}
+	m.unlock(shard, 0)
+}
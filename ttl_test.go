@@ -0,0 +1,211 @@
+package shardmap
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetWithTTL(t *testing.T) {
+	m := New[int, int](0)
+	m.SetDebugLevel(DebugVerify)
+	for i := 0; i < 1000; i++ {
+		if i%2 == 0 {
+			m.SetWithTTL(i, i, 100*time.Millisecond)
+		} else {
+			m.SetWithTTL(i, i, time.Hour)
+		}
+	}
+	m.Set(1000, 1000)
+	if v, ok := m.Get(0); !ok || v != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, v)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := m.Get(0); ok {
+		t.Fatal("expected false")
+	}
+	if m.Len() != 1000 {
+		t.Fatalf("expected '%v', got '%v'", 1000, m.Len())
+	}
+	if _, ok := m.Delete(2); ok {
+		t.Fatal("expected false")
+	}
+	if _, replaced := m.Set(4, 4); replaced {
+		t.Fatal("expected false")
+	}
+	var n int
+	m.Range(func(key, value int) bool {
+		if key%2 == 0 && key != 4 && key != 1000 {
+			t.Fatalf("expected '%v', got '%v'", "odd key", key)
+		}
+		n++
+		return true
+	})
+	if n != 502 {
+		t.Fatalf("expected '%v', got '%v'", 502, n)
+	}
+	m.expire()
+	if m.Len() != 502 {
+		t.Fatalf("expected '%v', got '%v'", 502, m.Len())
+	}
+	if v, ok := m.Get(4); !ok || v != 4 {
+		t.Fatalf("expected '%v', got '%v'", 4, v)
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	m := New[int, int](0, WithJanitor[int, int](time.Millisecond))
+	defer m.Close()
+	for i := 0; i < 1000; i++ {
+		m.SetWithTTL(i, i, time.Millisecond)
+	}
+	for start := time.Now(); m.Len() != 0; {
+		if time.Since(start) > time.Second {
+			t.Fatalf("expected '%v', got '%v'", 0, m.Len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOnExpire(t *testing.T) {
+	var mu sync.Mutex
+	expired := make(map[int]int)
+	m := New[int, int](0, WithOnExpire(func(key, value int) {
+		mu.Lock()
+		expired[key] = value
+		mu.Unlock()
+	}))
+	for i := 0; i < 100; i++ {
+		m.SetWithTTL(i, i, time.Millisecond)
+	}
+	time.Sleep(5 * time.Millisecond)
+	m.Get(0)     // lazy
+	m.Delete(1)  // lazy
+	m.Set(2, -2) // overwritten
+	m.expire()
+	if m.Len() != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, m.Len())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(expired) != 100 {
+		t.Fatalf("expected '%v', got '%v'", 100, len(expired))
+	}
+	for key, value := range expired {
+		if key != value {
+			t.Fatalf("expected '%v', got '%v'", key, value)
+		}
+	}
+}
+
+func TestTTL(t *testing.T) {
+	m := New[int, int](0)
+	m.Set(1, 1)
+	m.SetWithTTL(2, 2, time.Hour)
+	m.SetWithTTL(3, 3, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if ttl, ok := m.TTL(1); !ok || ttl != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, ttl)
+	}
+	if ttl, ok := m.TTL(2); !ok || ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("expected about '%v', got '%v'", time.Hour, ttl)
+	}
+	if _, ok := m.TTL(3); ok {
+		t.Fatalf("expected '%v', got '%v'", false, ok)
+	}
+	if _, ok := m.TTL(4); ok {
+		t.Fatalf("expected '%v', got '%v'", false, ok)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	m := New[int, int](0)
+	m.Set(1, 1)
+	m.SetWithTTL(2, 2, time.Hour)
+	if !m.Expire(1, time.Nanosecond) || !m.Expire(2, -1) {
+		t.Fatalf("expected '%v', got '%v'", true, false)
+	}
+	if m.Expire(3, time.Hour) {
+		t.Fatalf("expected '%v', got '%v'", false, true)
+	}
+	time.Sleep(time.Millisecond)
+	if _, ok := m.Get(1); ok {
+		t.Fatalf("expected '%v', got '%v'", false, ok)
+	}
+	if ttl, ok := m.TTL(2); !ok || ttl != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, ttl)
+	}
+}
+
+func TestExpireKeyClear(t *testing.T) {
+	// a Clear between a missed Get and its lazy expiry drops the metas
+	m := New[int, int](0, WithShards[int, int](1))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20000; i++ {
+			m.SetWithTTL(0, 0, time.Nanosecond)
+			m.Clear()
+			m.Set(1, 1)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+			m.Get(1)
+		}
+	}
+}
+
+func TestSnapshotTTL(t *testing.T) {
+	// snapshots keep the time left before the values expire
+	m := New[int, int](0)
+	m.Set(1, 1)
+	m.SetWithTTL(2, 2, time.Hour)
+	m.SetWithTTL(3, 3, time.Nanosecond)
+	var b bytes.Buffer
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatalf("expected '%v', got '%v'", nil, err)
+	}
+	data := b.Bytes()
+	for _, n := range []*Map[int, int]{New[int, int](0), New[int, int](0, WithShards[int, int](2))} {
+		if _, err := n.ReadFrom(bytes.NewReader(data)); err != nil {
+			t.Fatalf("expected '%v', got '%v'", nil, err)
+		}
+		if ttl, ok := n.TTL(1); !ok || ttl != 0 {
+			t.Fatalf("expected '%v', got '%v'", 0, ttl)
+		}
+		if ttl, ok := n.TTL(2); !ok || ttl <= time.Hour-time.Minute || ttl > time.Hour {
+			t.Fatalf("expected about '%v', got '%v'", time.Hour, ttl)
+		}
+		if _, ok := n.Get(3); ok {
+			t.Fatalf("expected '%v', got '%v'", false, ok)
+		}
+	}
+}
+
+func TestGetMissReadLocked(t *testing.T) {
+	// misses only write lock the shard to remove an expired key
+	m := New[int, int](0, WithShards[int, int](1), WithLRU[int, int](100))
+	m.Set(1, 1)
+	m.SetWithTTL(2, 2, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	m.mus[0].RLock()
+	done := make(chan struct{})
+	go func() {
+		m.Get(3)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("expected the miss to take the read lock only")
+	}
+	m.mus[0].RUnlock()
+	if _, ok := m.Get(2); ok || m.Len() != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, m.Len())
+	}
+}
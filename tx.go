@@ -0,0 +1,131 @@
+package shardmap
+
+import (
+	"sort"
+)
+
+// Tx gives access to the keys of a Transact while their shards are locked.
+type Tx[K comparable, V any] struct {
+	m      *Map[K, V]
+	shards []int // locked shards, in ascending order
+}
+
+// Transact write locks the shards of keys, in ascending order so that
+// concurrent transactions can't deadlock, then calls fn, whose changes are
+// observed at once by other goroutines when the shards are unlocked. The tx
+// only gives access to keys, or to keys sharing their shards, and must not be
+// used after fn returns. The fn function must not access the map.
+// Returns ErrReadOnly without calling fn when the map is read-only.
+func (m *Map[K, V]) Transact(keys []K, fn func(tx *Tx[K, V])) error {
+	tx := &Tx[K, V]{m: m}
+	hashes := make([]uint64, len(keys))
+	for i, key := range keys {
+		hashes[i] = m.hash(key)
+	}
+	var debug uint32
+	var locked, pushed int // released on every exit, including panics
+	defer func() {
+		for ; pushed > 0; pushed-- {
+			m.debugPop()
+		}
+		tx.unlock(locked, debug)
+		tx.m = nil
+	}()
+	for {
+		tx.shards = tx.shards[:0]
+		for _, hash := range hashes {
+			tx.shards = append(tx.shards, m.shardOf(hash))
+		}
+		sort.Ints(tx.shards)
+		n := 0
+		for _, shard := range tx.shards {
+			if n == 0 || tx.shards[n-1] != shard {
+				tx.shards[n] = shard
+				n++
+			}
+		}
+		tx.shards = tx.shards[:n]
+		for _, shard := range tx.shards {
+			var ok bool
+			if debug, ok = m.lock(shard); !ok {
+				return ErrReadOnly
+			}
+			locked++
+		}
+		if tx.holds(hashes) {
+			break
+		}
+		// moved by Rehash meanwhile
+		tx.unlock(locked, debug)
+		locked = 0
+	}
+	if debug != 0 {
+		for _, shard := range tx.shards {
+			m.debugPush(shard, false)
+			pushed++
+		}
+	}
+	fn(tx)
+	return nil
+}
+
+// holds reports whether the shards of all hashes are locked.
+func (tx *Tx[K, V]) holds(hashes []uint64) bool {
+	for _, hash := range hashes {
+		if tx.find(hash) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// find returns the locked shard of a hash, or -1 when it's not locked.
+func (tx *Tx[K, V]) find(hash uint64) int {
+	shard := tx.m.shardOf(hash)
+	if j := sort.SearchInts(tx.shards, shard); j < len(tx.shards) && tx.shards[j] == shard {
+		return shard
+	}
+	return -1
+}
+
+// unlock unlocks the first n locked shards.
+func (tx *Tx[K, V]) unlock(n int, debug uint32) {
+	for _, shard := range tx.shards[:n] {
+		tx.m.unlock(shard, debug)
+	}
+}
+
+// shard returns the hash of a key and its locked shard, and panics when the
+// shard is not locked.
+func (tx *Tx[K, V]) shard(key K) (uint64, *shard[K, V]) {
+	if tx.m == nil {
+		panic("shardmap: Tx used after Transact")
+	}
+	hash := tx.m.hash(key)
+	i := tx.find(hash)
+	if i < 0 {
+		panic("shardmap: Tx key outside of the Transact keys")
+	}
+	return hash, &tx.m.shards[i]
+}
+
+// Get returns a value for a key.
+// Returns false when no value has been assign for key.
+func (tx *Tx[K, V]) Get(key K) (value V, ok bool) {
+	hash, s := tx.shard(key)
+	return s.Get(hash, key, true)
+}
+
+// Set assigns a value to a key.
+// Returns the previous value, or false when no value was assigned.
+func (tx *Tx[K, V]) Set(key K, value V) (prev V, replaced bool) {
+	hash, s := tx.shard(key)
+	return s.Set(hash, key, value)
+}
+
+// Delete deletes a value for a key.
+// Returns the deleted value, or false when no value was assigned.
+func (tx *Tx[K, V]) Delete(key K) (prev V, deleted bool) {
+	hash, s := tx.shard(key)
+	return s.Delete(hash, key)
+}
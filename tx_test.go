@@ -0,0 +1,116 @@
+package shardmap
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTransact(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](4))
+	for i := 0; i < 10; i++ {
+		m.Set(i, 100)
+	}
+	m.SetDebugLevel(DebugVerify)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				a, b := (g+i)%10, (g+i*7+1)%10
+				m.Transact([]int{a, b}, func(tx *Tx[int, int]) {
+					va, _ := tx.Get(a)
+					vb, _ := tx.Get(b)
+					tx.Set(a, va-1)
+					tx.Set(b, vb+1)
+				})
+			}
+		}(g)
+	}
+	wg.Wait()
+	var sum int
+	m.Range(func(key, value int) bool {
+		sum += value
+		return true
+	})
+	if sum != 1000 {
+		t.Fatalf("expected '%v', got '%v'", 1000, sum)
+	}
+
+	var tx *Tx[int, int]
+	m.Transact([]int{1}, func(t *Tx[int, int]) {
+		tx = t
+		tx.Delete(1)
+	})
+	if _, ok := m.Get(1); ok {
+		t.Fatalf("expected '%v', got '%v'", false, ok)
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expected a use after Transact to panic")
+			}
+		}()
+		tx.Get(1)
+	}()
+}
+
+func TestTransactReadOnly(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](2), WithReadOnlyPanic[int, int]())
+	var keys [2]int // a key of each shard
+	for k := 0; k < 100; k++ {
+		keys[m.ShardIndex(k)] = k
+	}
+	held, release := make(chan struct{}), make(chan struct{})
+	go m.DoShard(1, func() {
+		close(held)
+		<-release
+	})
+	<-held
+	panicked := make(chan any)
+	go func() {
+		defer func() { panicked <- recover() }()
+		m.Transact(keys[:], func(tx *Tx[int, int]) {})
+	}()
+	// Transact locks shard 0 then waits for shard 1, which it finds read-only
+	time.Sleep(10 * time.Millisecond)
+	readonly := make(chan struct{})
+	go func() {
+		m.SetReadOnly(true)
+		close(readonly)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if r := <-panicked; r != ErrReadOnly {
+		t.Fatalf("expected '%v', got '%v'", ErrReadOnly, r)
+	}
+	select {
+	case <-readonly:
+	case <-time.After(time.Second):
+		t.Fatal("expected the shards to be unlocked")
+	}
+	m.SetReadOnly(false)
+	for _, key := range keys {
+		m.Set(key, key)
+		if v, _ := m.Get(key); v != key {
+			t.Fatalf("expected '%v', got '%v'", key, v)
+		}
+	}
+}
+
+func TestTransactReadOnlyError(t *testing.T) {
+	m := New[int, int](0, WithShards[int, int](2))
+	m.SetReadOnly(true)
+	called := false
+	if err := m.Transact([]int{1, 2}, func(tx *Tx[int, int]) { called = true }); err != ErrReadOnly || called {
+		t.Fatalf("expected '%v', got '%v'", ErrReadOnly, err)
+	}
+	m.SetReadOnly(false)
+	if err := m.Transact([]int{1, 2}, func(tx *Tx[int, int]) { tx.Set(1, 1) }); err != nil {
+		t.Fatalf("expected '%v', got '%v'", nil, err)
+	}
+	if v, _ := m.Get(1); v != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, v)
+	}
+}
@@ -0,0 +1,85 @@
+package shardmap
+
+import (
+	"sync/atomic"
+)
+
+// WithVersions stamps every value with the wall clock time of its last write
+// as its version, which MergeLWW compares to keep the newest values of two
+// maps.
+func WithVersions[K comparable, V any]() Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.stamp = true
+	}
+}
+
+// Version returns the version of the value of a key, in unix nanoseconds.
+// Returns false when no value has been assign for key, and 0 when the map
+// was not created with WithVersions.
+func (m *Map[K, V]) Version(key K) (version int64, ok bool) {
+	hash := m.hash(key)
+	shard := m.rlockHash(hash)
+	s := &m.shards[shard]
+	if i := s.find(hash, key); i >= 0 {
+		if s.metas != nil {
+			version = s.metas[i].stamp
+		}
+		ok = true
+	}
+	m.mus[shard].RUnlock()
+	return version, ok
+}
+
+// MergeLWW copies the key/values of other into the map like Merge, but keeps
+// the value with the latest version of every key, the current one on ties,
+// for writers exchanging their maps. Both maps should be created with
+// WithVersions. Versions and expirations are copied along with the values.
+// Deletions are not merged, as deleted keys leave no version behind.
+func (m *Map[K, V]) MergeLWW(other *Map[K, V]) {
+	if other == m {
+		return
+	}
+	var entries []entry[K, V]
+	var metas []meta
+	for i := 0; i < len(other.mus); i++ {
+		if atomic.LoadUint32(&other.debug) != 0 {
+			other.debugLock(i, false)
+		}
+		other.mus[i].RLock()
+		entries, metas = entries[:0], metas[:0]
+		var now int64
+		for t := &other.shards[i]; t != nil; t = t.old {
+			for j := 0; j < len(t.buckets); j++ {
+				if t.live(j, &now) {
+					md := meta{}
+					if t.metas != nil {
+						md = meta{expire: t.metas[j].expire, stamp: t.metas[j].stamp}
+					}
+					entries, metas = append(entries, t.buckets[j]), append(metas, md)
+				}
+			}
+		}
+		other.mus[i].RUnlock()
+		for j, e := range entries {
+			if !m.mergeLWW(e.key, e.value, metas[j]) {
+				return
+			}
+		}
+	}
+}
+
+// mergeLWW assigns a value to a key unless its current version is as recent.
+// Returns false when the map is not writable.
+func (m *Map[K, V]) mergeLWW(key K, value V, md meta) bool {
+	hash := m.hash(key)
+	shard, debug, ok := m.lockHash(hash)
+	if !ok {
+		return false
+	}
+	s := &m.shards[shard]
+	if i := s.find(hash, key); i < 0 || s.metas != nil && s.metas[i].stamp < md.stamp {
+		s.SetMeta(hash, key, value, md)
+	}
+	m.unlock(shard, debug)
+	return true
+}
@@ -0,0 +1,70 @@
+package shardmap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMergeLWW(t *testing.T) {
+	a := New[int, string](0, WithVersions[int, string]())
+	b := New[int, string](0, WithVersions[int, string](), WithShards[int, string](4))
+	for i := 0; i < 100; i++ {
+		a.Set(i, "a")
+	}
+	time.Sleep(time.Millisecond)
+	for i := 50; i < 150; i++ {
+		b.Set(i, "b")
+	}
+	b.SetWithTTL(200, "b", time.Hour)
+	a.Update(60, func(value *string) { *value = "a" })
+
+	va, _ := a.Version(60)
+	if vb, _ := b.Version(60); va <= vb {
+		t.Fatalf("expected '%v' > '%v'", va, vb)
+	}
+	if v, ok := New[int, int](0).Version(0); ok || v != 0 {
+		t.Fatalf("expected '%v', got '%v'", 0, v)
+	}
+
+	a.MergeLWW(b)
+	b.MergeLWW(a)
+	for _, m := range []*Map[int, string]{a, b} {
+		for i := 0; i < 150; i++ {
+			want := "b"
+			if i < 50 || i == 60 {
+				want = "a"
+			}
+			if v, _ := m.Get(i); v != want {
+				t.Fatalf("expected '%v', got '%v' for %d", want, v, i)
+			}
+		}
+	}
+	if a.Fingerprint() != b.Fingerprint() {
+		t.Fatalf("expected '%v', got '%v'", b.Fingerprint(), a.Fingerprint())
+	}
+	if v1, _ := a.Version(60); v1 != va {
+		t.Fatalf("expected '%v', got '%v'", va, v1)
+	}
+	s := &a.shards[a.ShardIndex(200)]
+	if i := s.find(a.Hash(200), 200); i < 0 || s.metas[i].expire == 0 {
+		t.Fatalf("expected the expiration to be kept")
+	}
+}
+
+func TestCloneVersions(t *testing.T) {
+	old := New[int, string](0, WithVersions[int, string]())
+	old.Set(1, "old")
+	time.Sleep(time.Millisecond)
+	m := New[int, string](0, WithVersions[int, string]())
+	m.Set(1, "new")
+	c := m.Clone()
+	want, _ := m.Version(1)
+	if v, ok := c.Version(1); !ok || v != want {
+		t.Fatalf("expected '%v', got '%v'", want, v)
+	}
+	// the value of the clone is newer than the older write
+	old.MergeLWW(c)
+	if v, _ := old.Get(1); v != "new" {
+		t.Fatalf("expected '%v', got '%v'", "new", v)
+	}
+}
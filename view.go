@@ -0,0 +1,128 @@
+package shardmap
+
+import (
+	"sync/atomic"
+)
+
+// View calls fn with a pointer to the value of a key while holding the shard
+// read lock, so that large values are read in place and consistently instead
+// of being copied out like Get does. The value is nil and ok false when the
+// key is absent. The fn function must not modify the value, retain the
+// pointer, or access the map.
+func (m *Map[K, V]) View(key K, fn func(value *V, ok bool)) {
+	hash := m.hash(key)
+	if m.hot != nil {
+		m.recordHot(hash, key)
+	}
+	shard := m.rlockHash(hash)
+	defer m.mus[shard].RUnlock()
+	if atomic.LoadUint32(&m.debug) != 0 {
+		m.debugPush(shard, true)
+		defer m.debugPop()
+	}
+	value, _ := m.shards[shard].ref(hash, key, true)
+	fn(value, value != nil)
+}
+
+// Has reports whether a key has a value like Peek, without copying the value
+// out.
+func (m *Map[K, V]) Has(key K) bool {
+	hash := m.hash(key)
+	if found, done := m.hasUnlocked(hash, key); done {
+		return found
+	}
+	shard := m.rlockHash(hash)
+	p, _ := m.shards[shard].ref(hash, key, false)
+	found := p != nil
+	m.mus[shard].RUnlock()
+	return found
+}
+
+// hasUnlocked looks up a key without locking its shard like getUnlocked,
+// through the bloom filter or the read-only copy of the shard.
+func (m *Map[K, V]) hasUnlocked(hash uint64, key K) (found, done bool) {
+	gen := atomic.LoadUint32(&m.gen)
+	if gen&1 != 0 {
+		return
+	}
+	shard := m.shardOf(hash)
+	switch {
+	case m.filters != nil && !m.filters[shard].has(hash):
+		done = true
+	case m.tables != nil:
+		t := m.table(shard)
+		found, done = false, true
+		if t != nil {
+			p, _ := t.ref(hash, key, false)
+			found = p != nil
+		}
+	}
+	return found, done && atomic.LoadUint32(&m.gen) == gen
+}
+
+// Update calls fn with a pointer to the value of a key under the shard write
+// lock, to modify it in place instead of copying it out and back in like
+// Mutate. The fn function must not retain the pointer or access the map.
+// Returns false, without calling fn, when the key is absent.
+func (m *Map[K, V]) Update(key K, fn func(value *V)) (updated bool) {
+	hash := m.hash(key)
+	if m.hot != nil {
+		m.recordHot(hash, key)
+	}
+	shard, debug, ok := m.lockHash(hash)
+	if !ok {
+		return
+	}
+	defer m.unlock(shard, debug)
+	s := &m.shards[shard]
+	if i := s.find(hash, key); i >= 0 {
+		if debug != 0 {
+			m.debugPush(shard, false)
+			defer m.debugPop()
+		}
+		s.update(i, fn)
+		updated = true
+	}
+	return updated
+}
+
+// Acquire write locks the shard of a key and returns a pointer to its value,
+// to read or modify it in place until release unlocks the shard. Nothing may
+// access the shard meanwhile, including the caller, which would deadlock, and
+// release must be called once from the same goroutine, it panics when called
+// again. Returns false with the shard unlocked when the key is absent.
+func (m *Map[K, V]) Acquire(key K) (value *V, release func(), ok bool) {
+	hash := m.hash(key)
+	if m.hot != nil {
+		m.recordHot(hash, key)
+	}
+	shard, debug, ok := m.lockHash(hash)
+	if !ok {
+		return nil, nil, false
+	}
+	s := &m.shards[shard]
+	i := s.find(hash, key)
+	if i < 0 {
+		m.unlock(shard, debug)
+		return nil, nil, false
+	}
+	if s.indexes != nil {
+		s.indexDel(s.buckets[i].key, s.buckets[i].value)
+	}
+	if debug != 0 {
+		m.debugPush(shard, false)
+	}
+	var released bool
+	release = func() {
+		if released {
+			panic("shardmap: Acquire released twice")
+		}
+		released = true
+		if debug != 0 {
+			m.debugPop()
+		}
+		s.updated(i)
+		m.unlock(shard, debug)
+	}
+	return &s.buckets[i].value, release, true
+}
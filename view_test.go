@@ -0,0 +1,99 @@
+package shardmap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestView(t *testing.T) {
+	type page struct {
+		id   int
+		data [4096]byte
+	}
+	m := New[int, page](0)
+	m.Set(1, page{id: 1})
+	m.SetDebugLevel(DebugVerify)
+	m.View(1, func(value *page, ok bool) {
+		if !ok || value.id != 1 {
+			t.Fatalf("expected '%v', got '%v'", 1, value.id)
+		}
+	})
+	m.View(2, func(value *page, ok bool) {
+		if ok || value != nil {
+			t.Fatalf("expected '%v', got '%v'", false, ok)
+		}
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	type counter struct{ hits, misses int }
+	m := New[string, counter](0, WithCopyOnWrite[string, counter](),
+		WithIndex[string, counter]("hits", func(v counter) string { return k(v.hits) }))
+	m.Set(k(1), counter{})
+	for i := 0; i < 10; i++ {
+		if !m.Update(k(1), func(value *counter) { value.hits++ }) {
+			t.Fatalf("expected '%v', got '%v'", true, false)
+		}
+	}
+	if m.Update(k(2), func(value *counter) { t.Fatalf("unexpected call") }) {
+		t.Fatalf("expected '%v', got '%v'", false, true)
+	}
+	if v, _ := m.Get(k(1)); v.hits != 10 {
+		t.Fatalf("expected '%v', got '%v'", 10, v.hits)
+	}
+	if keys := m.GetByIndex("hits", k(10)); len(keys) != 1 {
+		t.Fatalf("expected '%v', got '%v'", 1, len(keys))
+	}
+}
+
+func TestHas(t *testing.T) {
+	for _, opt := range []Option[int, int]{WithShards[int, int](4), WithBloomFilter[int, int](), WithCopyOnWrite[int, int]()} {
+		m := New[int, int](0, opt)
+		for i := 0; i < 100; i += 2 {
+			m.Set(i, i)
+		}
+		m.SetWithTTL(1, 1, -time.Second)
+		m.SetWithTTL(3, 3, time.Nanosecond)
+		time.Sleep(time.Millisecond)
+		for i := 0; i < 100; i++ {
+			if want := i%2 == 0 || i == 1; m.Has(i) != want {
+				t.Fatalf("expected '%v', got '%v' for %d", want, !want, i)
+			}
+		}
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	m := New[int, []int](0, WithCopyOnWrite[int, []int]())
+	m.Set(1, []int{1})
+	m.SetDebugLevel(DebugVerify)
+	value, release, ok := m.Acquire(1)
+	if !ok {
+		t.Fatalf("expected '%v', got '%v'", true, ok)
+	}
+	*value = append(*value, 2)
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expected a re-entrant call to panic")
+			}
+		}()
+		m.Set(1, nil)
+	}()
+	release()
+	if v, _ := m.Get(1); len(v) != 2 {
+		t.Fatalf("expected '%v', got '%v'", 2, len(v))
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expected a second release to panic")
+			}
+		}()
+		release()
+	}()
+	if _, release, ok := m.Acquire(2); ok || release != nil {
+		t.Fatalf("expected '%v', got '%v'", false, ok)
+	}
+	m.Set(2, nil)
+}
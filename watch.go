@@ -0,0 +1,148 @@
+package shardmap
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// EventType tells what happened to a key in an Event. The removals match the
+// EvictReason of WithOnEvict.
+type EventType uint8
+
+const (
+	// EventSet means a value was assigned to the key.
+	EventSet EventType = iota
+	// EventExpired means the value outlived its ttl.
+	EventExpired
+	// EventEvicted means the value was evicted to bound the map.
+	EventEvicted
+	// EventDeleted means the value was deleted or cleared.
+	EventDeleted
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventSet:
+		return "set"
+	case EventExpired:
+		return "expired"
+	case EventEvicted:
+		return "evicted"
+	case EventDeleted:
+		return "deleted"
+	}
+	return "EventType(" + strconv.Itoa(int(t)) + ")"
+}
+
+// Event is a change of a key of the map, as seen by Subscribe and Watch.
+type Event[K comparable, V any] struct {
+	Type  EventType
+	Key   K
+	Value V // the value assigned or removed
+}
+
+// subscription is a function of Subscribe.
+type subscription[K comparable, V any] struct {
+	fn func(event Event[K, V])
+}
+
+// watchBuffer is the size of the channels of Watch.
+const watchBuffer = 64
+
+// Subscribe registers fn to be called with every change of the map: values
+// set, including in place by Update, and values removed for any reason. The
+// fn is called outside of the shard lock once the shard of the key is
+// unlocked, by the goroutine which made the change, so it may be called
+// concurrently, and the changes of concurrent writers of a key may reach it
+// in another order than they were made. Use WithWriteBehind for changes in
+// order.
+// Returns a function cancelling the subscription.
+func (m *Map[K, V]) Subscribe(fn func(event Event[K, V])) (cancel func()) {
+	m.lazyInit()
+	sub := &subscription[K, V]{fn: fn}
+	m.subMu.Lock()
+	old := m.subscriptions()
+	subs := append(old[:len(old):len(old)], sub)
+	atomic.StorePointer(&m.subs, unsafe.Pointer(&subs))
+	if len(subs) == 1 {
+		m.watch(true)
+	}
+	m.subMu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.subMu.Lock()
+			defer m.subMu.Unlock()
+			var subs []*subscription[K, V]
+			for _, s := range m.subscriptions() {
+				if s != sub {
+					subs = append(subs, s)
+				}
+			}
+			atomic.StorePointer(&m.subs, unsafe.Pointer(&subs))
+			if len(subs) == 0 {
+				m.watch(false)
+			}
+		})
+	}
+}
+
+// Watch returns a channel receiving the changes of a key like Subscribe, and
+// a function cancelling the watch which closes the channel. The channel is
+// buffered, and a receiver falling behind misses the events which don't fit.
+func (m *Map[K, V]) Watch(key K) (<-chan Event[K, V], func()) {
+	ch := make(chan Event[K, V], watchBuffer)
+	var mu sync.Mutex
+	var closed bool
+	unsubscribe := m.Subscribe(func(event Event[K, V]) {
+		if event.Key != key {
+			return
+		}
+		mu.Lock()
+		if !closed {
+			select {
+			case ch <- event:
+			default:
+			}
+		}
+		mu.Unlock()
+	})
+	return ch, func() {
+		unsubscribe()
+		mu.Lock()
+		if !closed {
+			closed = true
+			close(ch)
+		}
+		mu.Unlock()
+	}
+}
+
+// subscriptions returns the functions of Subscribe.
+func (m *Map[K, V]) subscriptions() []*subscription[K, V] {
+	if p := atomic.LoadPointer(&m.subs); p != nil {
+		return *(*[]*subscription[K, V])(p)
+	}
+	return nil
+}
+
+// records reports whether the shards always record their changes, for the
+// change log, the write-behind queues or the hooks of WithOnSet and
+// WithOnDelete.
+func (m *Map[K, V]) records() bool {
+	return m.logs != nil || m.dirty != nil || m.onSet != nil || m.onDelete != nil
+}
+
+// watch makes the shards record their changes for the subscriptions, or
+// stop recording those only needed by them.
+func (m *Map[K, V]) watch(on bool) {
+	for i := 0; i < len(m.mus); i++ {
+		m.mus[i].Lock()
+		c := &m.shards[i].conf
+		c.watch = on || m.records()
+		c.notify = c.watch || m.onExpire != nil || m.onEvict != nil
+		m.mus[i].Unlock()
+	}
+}
@@ -0,0 +1,72 @@
+package shardmap
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	var evicted []int
+	m := New[int, int](0, WithShards[int, int](1), WithLRU[int, int](4),
+		WithOnEvict[int, int](func(key, value int, reason EvictReason) { evicted = append(evicted, key) }))
+	var mu sync.Mutex
+	var events []Event[int, int]
+	cancel := m.Subscribe(func(event Event[int, int]) {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	})
+	m.Set(1, 1)
+	m.Set(1, 2)
+	m.Update(1, func(value *int) { *value = 3 })
+	m.Delete(1)
+	m.SetWithTTL(2, 2, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	m.Get(2)
+	for i := 10; i < 15; i++ {
+		m.Set(i, i)
+	}
+	want := []Event[int, int]{
+		{EventSet, 1, 1}, {EventSet, 1, 2}, {EventSet, 1, 3}, {EventDeleted, 1, 3},
+		{EventSet, 2, 2}, {EventExpired, 2, 2},
+		{EventSet, 10, 10}, {EventSet, 11, 11}, {EventSet, 12, 12}, {EventSet, 13, 13},
+		{EventSet, 14, 14}, {EventEvicted, 10, 10},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("expected '%v', got '%v'", want, events)
+	}
+	for i := range want {
+		if events[i] != want[i] {
+			t.Fatalf("expected '%v', got '%v'", want[i], events[i])
+		}
+	}
+	if len(evicted) != 3 {
+		t.Fatalf("expected '%v', got '%v'", 3, len(evicted))
+	}
+	cancel()
+	cancel()
+	m.Set(3, 3)
+	if len(events) != len(want) || m.shards[0].conf.watch || !m.shards[0].conf.notify {
+		t.Fatalf("expected the subscription to be cancelled")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	m := New[string, int](0)
+	ch, cancel := m.Watch(k(1))
+	m.Set(k(1), 1)
+	m.Set(k(2), 2)
+	m.Delete(k(1))
+	if e := <-ch; e.Type != EventSet || e.Value != 1 {
+		t.Fatalf("expected '%v', got '%v'", EventSet, e.Type)
+	}
+	if e := <-ch; e.Type != EventDeleted || e.Key != k(1) {
+		t.Fatalf("expected '%v', got '%v'", EventDeleted, e.Type)
+	}
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Fatalf("expected the channel to be closed")
+	}
+	m.Set(k(1), 1)
+}
@@ -0,0 +1,137 @@
+package shardmap
+
+// WithWriteBehind makes the map hand its sets and deletions over to flush, in
+// batches, from workers goroutines draining a queue of up to n changes per
+// shard, to write them to a store such as a database. Writers wait while the
+// queue of their shard is full. The changes of each shard are flushed in the
+// order they were made. Closing the map flushes the queued changes.
+// Evictions and expirations are not flushed, as they only concern the map.
+func WithWriteBehind[K comparable, V any](n, workers int, flush func(events []Event[K, V])) Option[K, V] {
+	return func(m *Map[K, V]) {
+		m.flush, m.backlog, m.flushers = flush, n, workers
+	}
+}
+
+// writeQueue is the write-behind queue of a shard. Events are numbered under
+// the shard lock but queued after it's released, so they may be received out
+// of order, and are put back in order by the worker of the shard.
+type writeQueue[K comparable, V any] struct {
+	events chan queued[K, V]
+	seq    uint64                 // of the last numbered event, under the shard lock
+	next   uint64                 // of the next event to flush, owned by the worker
+	held   map[uint64]Event[K, V] // events received ahead of next, owned by the worker
+}
+
+// queued is an event with its number in the queue of its shard.
+type queued[K comparable, V any] struct {
+	seq   uint64
+	event Event[K, V]
+}
+
+func (m *Map[K, V]) initWriteBehind(shards int) {
+	if m.backlog <= 0 {
+		m.backlog = 1
+	}
+	if m.flushers <= 0 {
+		m.flushers = 1
+	}
+	if m.flushers > shards {
+		m.flushers = shards
+	}
+	m.dirty = make([]writeQueue[K, V], shards)
+	for i := range m.dirty {
+		m.dirty[i] = writeQueue[K, V]{
+			events: make(chan queued[K, V], m.backlog),
+			next:   1,
+			held:   make(map[uint64]Event[K, V]),
+		}
+	}
+	m.wakes = make([]chan struct{}, m.flushers)
+	for i := range m.wakes {
+		m.wakes[i] = make(chan struct{}, 1)
+	}
+}
+
+// flushed reports whether the write-behind workers flush a change of type t.
+func flushed(t EventType) bool {
+	return t == EventSet || t == EventDeleted
+}
+
+// enqueue queues an event of shard i numbered seq for the write-behind
+// workers, waiting while the queue is full unless the map is closed. The
+// events of changes made once the map is closed are dropped, as the workers
+// have stopped.
+func (m *Map[K, V]) enqueue(i int, seq uint64, event Event[K, V]) {
+	select {
+	case <-m.done:
+		return
+	default:
+	}
+	q := queued[K, V]{seq, event}
+	select {
+	case m.dirty[i].events <- q:
+	default:
+		// the queue is full, wake its worker before waiting for room
+		m.wake(i)
+		select {
+		case m.dirty[i].events <- q:
+		case <-m.done:
+			return
+		}
+	}
+	m.wake(i)
+}
+
+// wake signals the worker of shard i that its queue has events.
+func (m *Map[K, V]) wake(i int) {
+	select {
+	case m.wakes[i%len(m.wakes)] <- struct{}{}:
+	default:
+	}
+}
+
+// runFlusher flushes the queues of the shards of worker w, which are the
+// shards w, w+flushers, w+2*flushers and so on.
+func (m *Map[K, V]) runFlusher(w int, done <-chan struct{}) {
+	var batch []Event[K, V]
+	for {
+		select {
+		case <-done:
+			m.drain(w, batch[:0], true)
+			return
+		case <-m.wakes[w]:
+		}
+		batch = m.drain(w, batch[:0], false)
+	}
+}
+
+// drain flushes the queued events of the shards of worker w in the order
+// they were numbered, using batch as scratch space. Events received ahead of
+// a missing one are held until it comes, or flushed anyway when final, as the
+// missing ones were dropped by the map being closed.
+func (m *Map[K, V]) drain(w int, batch []Event[K, V], final bool) []Event[K, V] {
+	for i := w; i < len(m.dirty); i += len(m.wakes) {
+		q := &m.dirty[i]
+		for n := len(q.events); n > 0; n-- {
+			e := <-q.events
+			q.held[e.seq] = e.event
+		}
+		for len(q.held) > 0 {
+			event, ok := q.held[q.next]
+			if !ok {
+				if !final {
+					break
+				}
+				q.next++
+				continue
+			}
+			delete(q.held, q.next)
+			q.next++
+			batch = append(batch, event)
+		}
+	}
+	if len(batch) > 0 {
+		m.flush(batch)
+	}
+	return batch
+}
@@ -0,0 +1,130 @@
+package shardmap
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteBehind(t *testing.T) {
+	var mu sync.Mutex
+	db := make(map[int]int)
+	var batches int
+	var evicted sync.Map
+	m := New[int, int](0, WithShards[int, int](4), WithLRU[int, int](100),
+		WithOnEvict[int, int](func(key, value int, reason EvictReason) { evicted.Store(key, true) }),
+		WithWriteBehind[int, int](8, 2, func(events []Event[int, int]) {
+			mu.Lock()
+			defer mu.Unlock()
+			batches++
+			for _, e := range events {
+				switch e.Type {
+				case EventSet:
+					db[e.Key] = e.Value
+				case EventDeleted:
+					delete(db, e.Key)
+				default:
+					t.Errorf("unexpected event '%v'", e.Type)
+				}
+			}
+		}))
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := g * 1000; i < (g+1)*1000; i++ {
+				m.Set(i, i)
+				if i%2 == 0 {
+					m.Delete(i)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	m.Close()
+	// the deleted keys evicted by other writers beforehand were not deleted
+	for key := 0; key < 4000; key++ {
+		_, ok := db[key]
+		_, gone := evicted.Load(key)
+		if ok != (key%2 == 1) && !(key%2 == 0 && gone) {
+			t.Fatalf("unexpected key '%v'", key)
+		}
+	}
+	for key, value := range db {
+		if key != value {
+			t.Fatalf("unexpected key/value '%v' '%v'", key, value)
+		}
+	}
+	if batches == 0 || batches >= 6000 {
+		t.Fatalf("unexpected number of batches '%v'", batches)
+	}
+}
+
+func TestWriteBehindWakes(t *testing.T) {
+	// every change is flushed without waiting for later ones or for Close
+	flushed := make(chan int, 1)
+	m := New[int, int](0, WithShards[int, int](1),
+		WithWriteBehind[int, int](1, 1, func(events []Event[int, int]) {
+			for _, e := range events {
+				flushed <- e.Key
+			}
+		}))
+	defer m.Close()
+	for i := 0; i < 10000; i++ {
+		m.Set(i, i)
+		select {
+		case key := <-flushed:
+			if key != i {
+				t.Fatalf("expected '%v', got '%v'", i, key)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected '%v' to be flushed", i)
+		}
+	}
+}
+
+func TestWriteBehindOrder(t *testing.T) {
+	// the last change of a key is flushed last, though the writers of the
+	// key race to queue their changes once the shard is unlocked
+	for round := 0; round < 20; round++ {
+		var mu sync.Mutex
+		db := make(map[int]int)
+		m := New[int, int](0, WithShards[int, int](1),
+			WithOnSet[int, int](func(key, value int, replaced bool) {
+				if value%3 == 0 {
+					runtime.Gosched()
+				}
+			}),
+			WithWriteBehind[int, int](4, 1, func(events []Event[int, int]) {
+				mu.Lock()
+				defer mu.Unlock()
+				for _, e := range events {
+					db[e.Key] = e.Value
+				}
+			}))
+		var wg sync.WaitGroup
+		for g := 0; g < 8; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					m.Set(i%10, g*100+i)
+				}
+			}(g)
+		}
+		wg.Wait()
+		want := make(map[int]int)
+		m.Range(func(key, value int) bool {
+			want[key] = value
+			return true
+		})
+		m.Close()
+		for key, value := range want {
+			if db[key] != value {
+				t.Fatalf("expected '%v', got '%v'", value, db[key])
+			}
+		}
+	}
+}